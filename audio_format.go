@@ -0,0 +1,134 @@
+package hal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Microsoft/cognitive-services-speech-sdk-go/common"
+)
+
+var ErrUnsupportedAudioFormat = errors.New("unsupported audio format")
+
+// AudioFormat is the output format of speech synthesis.
+type AudioFormat struct {
+	Name      string // the name of azure, e.g. audio-16khz-32kbitrate-mono-mp3
+	Container string // mp3, ogg, webm, riff (wav) or raw (PCM without header)
+	PCM       PCMFormat
+	azure     common.SpeechSynthesisOutputFormat
+}
+
+// IsPCM reports whether the audio is PCM (riff or raw).
+func (f AudioFormat) IsPCM() bool {
+	return f.Container == "riff" || f.Container == "raw"
+}
+
+// Ext returns the extension of file saving the audio, the raw PCM is saved as wav.
+func (f AudioFormat) Ext() string {
+	if f.IsPCM() {
+		return ".wav"
+	}
+
+	return "." + f.Container
+}
+
+var AUDIO_FORMATS = map[string]AudioFormat{}
+
+var DefaultAudioFormat = addAudioFormat("audio-16khz-32kbitrate-mono-mp3", common.Audio16Khz32KBitRateMonoMp3)
+
+// EspeakAudioFormat is the format of espeak-ng output, it only speaks PCM.
+var EspeakAudioFormat = addAudioFormat("riff-22050hz-16bit-mono-pcm", common.Riff22050Hz16BitMonoPcm)
+
+func init() {
+	addAudioFormat("audio-16khz-64kbitrate-mono-mp3", common.Audio16Khz64KBitRateMonoMp3)
+	addAudioFormat("audio-16khz-128kbitrate-mono-mp3", common.Audio16Khz128KBitRateMonoMp3)
+	addAudioFormat("audio-24khz-48kbitrate-mono-mp3", common.Audio24Khz48KBitRateMonoMp3)
+	addAudioFormat("audio-24khz-96kbitrate-mono-mp3", common.Audio24Khz96KBitRateMonoMp3)
+	addAudioFormat("audio-24khz-160kbitrate-mono-mp3", common.Audio24Khz160KBitRateMonoMp3)
+	addAudioFormat("audio-48khz-96kbitrate-mono-mp3", common.Audio48Khz96KBitRateMonoMp3)
+	addAudioFormat("audio-48khz-192kbitrate-mono-mp3", common.Audio48Khz192KBitRateMonoMp3)
+	addAudioFormat("riff-8khz-16bit-mono-pcm", common.Riff8Khz16BitMonoPcm)
+	addAudioFormat("riff-16khz-16bit-mono-pcm", common.Riff16Khz16BitMonoPcm)
+	addAudioFormat("riff-24khz-16bit-mono-pcm", common.Riff24Khz16BitMonoPcm)
+	addAudioFormat("riff-48khz-16bit-mono-pcm", common.Riff48Khz16BitMonoPcm)
+	addAudioFormat("riff-44100hz-16bit-mono-pcm", common.Riff44100Hz16BitMonoPcm)
+	addAudioFormat("raw-8khz-16bit-mono-pcm", common.Raw8Khz16BitMonoPcm)
+	addAudioFormat("raw-16khz-16bit-mono-pcm", common.Raw16Khz16BitMonoPcm)
+	addAudioFormat("raw-24khz-16bit-mono-pcm", common.Raw24Khz16BitMonoPcm)
+	addAudioFormat("raw-48khz-16bit-mono-pcm", common.Raw48Khz16BitMonoPcm)
+	addAudioFormat("raw-22050hz-16bit-mono-pcm", common.Raw22050Hz16BitMonoPcm)
+	addAudioFormat("raw-44100hz-16bit-mono-pcm", common.Raw44100Hz16BitMonoPcm)
+	addAudioFormat("ogg-16khz-16bit-mono-opus", common.Ogg16Khz16BitMonoOpus)
+	addAudioFormat("ogg-24khz-16bit-mono-opus", common.Ogg24Khz16BitMonoOpus)
+	addAudioFormat("ogg-48khz-16bit-mono-opus", common.Ogg48Khz16BitMonoOpus)
+	addAudioFormat("webm-16khz-16bit-mono-opus", common.Webm16Khz16BitMonoOpus)
+	addAudioFormat("webm-24khz-16bit-mono-opus", common.Webm24Khz16BitMonoOpus)
+}
+
+// addAudioFormat registers the format, the container and sample rate are parsed from its name.
+func addAudioFormat(name string, azure common.SpeechSynthesisOutputFormat) AudioFormat {
+	f := AudioFormat{Name: name, azure: azure, PCM: PCMFormat{Channels: 1, BitsPerSample: 16}}
+	parts := strings.Split(name, "-")
+	if _, err := fmt.Sscanf(parts[1], "%dkhz", &f.PCM.SampleRate); err == nil {
+		f.PCM.SampleRate *= 1000
+	} else {
+		fmt.Sscanf(parts[1], "%dhz", &f.PCM.SampleRate)
+	}
+
+	f.Container = parts[0]
+	if f.Container == "audio" {
+		f.Container = parts[len(parts)-1]
+	}
+
+	AUDIO_FORMATS[name] = f
+	return f
+}
+
+// ParseAudioFormat returns the format by its name, DefaultAudioFormat if the name is empty.
+func ParseAudioFormat(name string) (AudioFormat, error) {
+	if name == "" {
+		return DefaultAudioFormat, nil
+	}
+
+	f, ok := AUDIO_FORMATS[strings.ToLower(name)]
+	if !ok {
+		return f, fmt.Errorf("%w: %s", ErrUnsupportedAudioFormat, name)
+	}
+
+	return f, nil
+}
+
+// formatsForExt is the format for the extension of file if the preferred one doesn't match, 24khz is good
+// enough for speech.
+var formatsForExt = map[string]string{
+	".mp3":  "audio-24khz-48kbitrate-mono-mp3",
+	".ogg":  "ogg-24khz-16bit-mono-opus",
+	".webm": "webm-24khz-16bit-mono-opus",
+	".wav":  "riff-24khz-16bit-mono-pcm",
+}
+
+// AudioFormatForExt returns the format matches the extension of file, the preferred one is returned if it matches.
+func AudioFormatForExt(ext string, preferred AudioFormat) (AudioFormat, error) {
+	ext = strings.ToLower(ext)
+	if preferred.Ext() == ext {
+		return preferred, nil
+	}
+
+	if name, ok := formatsForExt[ext]; ok {
+		return AUDIO_FORMATS[name], nil
+	}
+
+	return preferred, fmt.Errorf("%w: %s", ErrUnsupportedAudioFormat, ext)
+}
+
+// AudioFormatNames returns the names of formats supported, sorted.
+func AudioFormatNames() []string {
+	var res []string
+	for k := range AUDIO_FORMATS {
+		res = append(res, k)
+	}
+
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,52 @@
+package hal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAudioFormat(t *testing.T) {
+	f, err := ParseAudioFormat("")
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultAudioFormat, f)
+	assert.Equal(t, "mp3", f.Container)
+	assert.Equal(t, ".mp3", f.Ext())
+
+	f, err = ParseAudioFormat("RIFF-24khz-16bit-mono-pcm")
+	assert.Nil(t, err)
+	assert.True(t, f.IsPCM())
+	assert.Equal(t, PCMFormat{SampleRate: 24000, Channels: 1, BitsPerSample: 16}, f.PCM)
+	assert.Equal(t, ".wav", f.Ext())
+
+	f, err = ParseAudioFormat("raw-22050hz-16bit-mono-pcm")
+	assert.Nil(t, err)
+	assert.Equal(t, "raw", f.Container)
+	assert.Equal(t, 22050, f.PCM.SampleRate)
+	assert.Equal(t, ".wav", f.Ext())
+
+	f, err = ParseAudioFormat("ogg-48khz-16bit-mono-opus")
+	assert.Nil(t, err)
+	assert.Equal(t, ".ogg", f.Ext())
+	assert.False(t, f.IsPCM())
+
+	_, err = ParseAudioFormat("audio-16khz-16kbps-mono-siren")
+	assert.ErrorIs(t, err, ErrUnsupportedAudioFormat)
+}
+
+func TestAudioFormatForExt(t *testing.T) {
+	f, err := AudioFormatForExt(".MP3", DefaultAudioFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultAudioFormat, f)
+
+	f, err = AudioFormatForExt(".wav", DefaultAudioFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, "riff-24khz-16bit-mono-pcm", f.Name)
+
+	f, err = AudioFormatForExt(".wav", EspeakAudioFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, EspeakAudioFormat, f)
+
+	_, err = AudioFormatForExt(".flac", DefaultAudioFormat)
+	assert.ErrorIs(t, err, ErrUnsupportedAudioFormat)
+}
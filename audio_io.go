@@ -0,0 +1,209 @@
+package hal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AudioCapture captures the microphone in frames of PCM, so the audio heard can be inspected, gated or recorded
+// before it is pushed to the speech recognition.
+type AudioCapture interface {
+	// Start starts capturing, the frames are sent until Stop is called or it fails, then the channel is closed.
+	Start() (<-chan []byte, error)
+	// Stop stops capturing, and returns the error occurred in capturing.
+	Stop() error
+}
+
+// ArecordCapture captures the microphone (Device) by arecord (alsa-utils), the echo of speech played is
+// suppressed by Echo.
+type ArecordCapture struct {
+	Format PCMFormat
+	Frame  time.Duration
+	Device string           // the input device, empty for the default one
+	Echo   *EchoSuppression // nil for no suppression
+
+	binary string
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	stop   chan struct{}
+	done   chan struct{}
+	err    error
+}
+
+// NewArecordCapture creates the capture of frames lasting frame in format.
+func NewArecordCapture(format PCMFormat, frame time.Duration) (*ArecordCapture, error) {
+	path, err := exec.LookPath("arecord")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ArecordCapture{Format: format, Frame: frame, binary: path}, nil
+}
+
+func (c *ArecordCapture) Start() (<-chan []byte, error) {
+	if c.cmd != nil {
+		return nil, errors.New("audio capture started")
+	}
+
+	cmd := alsaCommand(c.binary, c.Device, true, "-q", "-t", "raw", "-f", "S16_LE", "-r", strconv.Itoa(c.Format.SampleRate),
+		"-c", strconv.Itoa(c.Format.Channels))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	size := int(int64(c.Format.BytesPerSecond()) * int64(c.Frame) / int64(time.Second))
+	size -= size % (c.Format.Channels * c.Format.BitsPerSample / 8)
+	frames := make(chan []byte, 16)
+	c.cmd, c.stderr, c.stop, c.done, c.err = cmd, stderr, make(chan struct{}), make(chan struct{}), nil
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		defer close(frames)
+		for {
+			frame := make([]byte, size)
+			if _, err := io.ReadFull(stdout, frame); err != nil {
+				c.err = err
+				return
+			}
+
+			select {
+			case frames <- c.Echo.Process(frame):
+			case <-stop:
+				return
+			}
+		}
+	}(c.stop, c.done)
+
+	return frames, nil
+}
+
+func (c *ArecordCapture) Stop() error {
+	if c.cmd == nil {
+		return nil
+	}
+
+	// arecord exited by itself if the frames ended before stopping, e.g. the input device is wrong
+	var exited bool
+	select {
+	case <-c.done:
+		exited = true
+	default:
+	}
+
+	close(c.stop)
+	if !exited {
+		c.cmd.Process.Kill()
+	}
+
+	<-c.done
+	waitErr := c.cmd.Wait()
+	c.cmd = nil
+	if exited && waitErr != nil {
+		return fmt.Errorf("arecord: %s: %s", waitErr, strings.TrimSpace(c.stderr.String()))
+	}
+
+	// the pipe is closed by killing arecord
+	if errors.Is(c.err, io.EOF) || errors.Is(c.err, io.ErrUnexpectedEOF) || errors.Is(c.err, io.ErrClosedPipe) {
+		return nil
+	}
+
+	return c.err
+}
+
+// CanPlay reports whether the audio in format can be played by AudioOutput, PCM by aplay and MP3 by mpg123.
+func CanPlay(format AudioFormat) bool {
+	binary := "aplay"
+	switch {
+	case format.Container == "mp3":
+		binary = "mpg123"
+	case !format.IsPCM():
+		return false
+	}
+
+	_, err := exec.LookPath(binary)
+	return err == nil
+}
+
+// AudioOutput plays the audio on the speaker while it is written chunk by chunk, PCM by aplay and MP3 by mpg123.
+type AudioOutput struct {
+	format AudioFormat
+	echo   *EchoSuppression
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	output strings.Builder
+	once   sync.Once
+	err    error
+}
+
+// NewAudioOutput creates the output playing on the device (empty for the default one), the audio played is the
+// reference of echo (nil for no suppression).
+func NewAudioOutput(format AudioFormat, device string, echo *EchoSuppression) (*AudioOutput, error) {
+	var cmd *exec.Cmd
+	switch {
+	case format.IsPCM():
+		cmd = alsaCommand("aplay", device, false, aplayArgs(format)...)
+	case format.Container == "mp3":
+		cmd = mpg123Command(device)
+	default:
+		return nil, fmt.Errorf("%w: only PCM and MP3 can be played, got %s", ErrUnsupportedAudioFormat, format.Name)
+	}
+
+	o := &AudioOutput{format: format, echo: echo, cmd: cmd}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	o.stdin = stdin
+	cmd.Stdout, cmd.Stderr = &o.output, &o.output
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	echo.startPlaying()
+	return o, nil
+}
+
+func (o *AudioOutput) Write(chunk []byte) (int, error) {
+	o.echo.play(o.format, chunk)
+	return o.stdin.Write(chunk)
+}
+
+// Close waits until the audio written is played.
+func (o *AudioOutput) Close() error {
+	o.once.Do(func() {
+		o.stdin.Close()
+		if err := o.cmd.Wait(); err != nil {
+			o.err = fmt.Errorf("%s: %s: %s", o.cmd.Args[0], err, strings.TrimSpace(o.output.String()))
+		}
+
+		o.echo.stopPlaying()
+	})
+
+	return o.err
+}
+
+// mpg123Command plays MP3 from stdin on the output device, the pulse devices by the pulse output of mpg123.
+func mpg123Command(device string) *exec.Cmd {
+	args := []string{"-q"}
+	if strings.HasPrefix(device, pulseDevicePrefix) {
+		args = append(args, "-o", "pulse", "-a", strings.TrimPrefix(device, pulseDevicePrefix))
+	} else if device != "" {
+		args = append(args, "-o", "alsa", "-a", device)
+	}
+
+	return exec.Command("mpg123", append(args, "-")...)
+}
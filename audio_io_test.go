@@ -0,0 +1,29 @@
+package hal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArecordCaptureExited(t *testing.T) {
+	dir, err := os.MkdirTemp("./test_data", "arecord")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// arecord fails at once with a wrong input device
+	binary := filepath.Join(dir, "arecord")
+	assert.Nil(t, os.WriteFile(binary, []byte("#!/bin/sh\necho 'audio open error: No such file or directory' >&2\nexit 1\n"), 0o700))
+	c := &ArecordCapture{Format: DefaultPCMFormat, Frame: 30 * time.Millisecond, binary: binary}
+	frames, err := c.Start()
+	assert.Nil(t, err)
+	for range frames {
+	}
+
+	err = c.Stop()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "audio open error")
+}
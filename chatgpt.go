@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"os"
 	"strings"
@@ -19,8 +18,11 @@ type ChatGPT struct {
 	History    []*openai.ChatCompletionMessage `json:"history"`
 	MaxHistory int                             `json:"maxHistory"`
 	Model      string                          `json:"model"`
-	Key        string                          `json:"key"`
+	Key        string                          `json:"key,omitempty"`        // the key of session, before credentials are referenced
+	Credential string                          `json:"credential,omitempty"` // the name of credential in SECRETS, e.g. openai
 	IsDefault  bool                            `json:"default"`
+	Prosody    *Prosody                        `json:"prosody,omitempty"` // how the answers are spoken
+	model      string                          // overrides Model in this run (e.g. by the profile), not saved
 }
 
 type streamResultCallBack func(content string)
@@ -65,13 +67,38 @@ func (s *StreamResult) Next() string {
 
 func NewChatGPT(key string, model string) *ChatGPT {
 	return &ChatGPT{
-		client:     openai.NewClient(key),
+		client:     newOpenaiClient(key),
 		Model:      model,
 		MaxHistory: 4,
 		Key:        key,
 	}
 }
 
+// newOpenaiClient creates the client of openai by the key, to the OpenaiBaseURL of PARAMS if set.
+func newOpenaiClient(key string) *openai.Client {
+	config := openai.DefaultConfig(key)
+	if PARAMS.OpenaiBaseURL != "" {
+		config.BaseURL = PARAMS.OpenaiBaseURL
+	}
+
+	return openai.NewClientWithConfig(config)
+}
+
+// SetCredential uses the key of the credential in SECRETS, the key is not saved in the session.
+func (c *ChatGPT) SetCredential(name string) {
+	c.Credential, c.Key = name, ""
+	c.client = newOpenaiClient(LookupSecret(name))
+}
+
+// APIKey returns the key of session, from its credential or saved in it.
+func (c *ChatGPT) APIKey() string {
+	if c.Credential != "" {
+		return LookupSecret(c.Credential)
+	}
+
+	return c.Key
+}
+
 func (c *ChatGPT) SetRole(text string) {
 	c.System = &openai.ChatCompletionMessage{
 		Role:    openai.ChatMessageRoleSystem,
@@ -131,7 +158,7 @@ func (c *ChatGPT) Prompt(text string) (string, int, error) {
 	resp, err := c.client.CreateChatCompletion(
 		context.Background(),
 		openai.ChatCompletionRequest{
-			Model:    c.Model,
+			Model:    c.CurrentModel(),
 			Messages: c.buildMessages(text),
 		},
 	)
@@ -169,7 +196,7 @@ func (c *ChatGPT) buildMessages(text string) []openai.ChatCompletionMessage {
 func (c *ChatGPT) PromptStream(text string) (*StreamResult, error) {
 	ctx := context.Background()
 	req := openai.ChatCompletionRequest{
-		Model:     c.Model,
+		Model:     c.CurrentModel(),
 		MaxTokens: 2048,
 		Messages:  c.buildMessages(text),
 		Stream:    true,
@@ -193,6 +220,20 @@ func (c *ChatGPT) SetModel(model string) {
 	c.Model = model
 }
 
+// UseModel overrides the model of session in this run, empty to use its Model.
+func (c *ChatGPT) UseModel(model string) {
+	c.model = model
+}
+
+// CurrentModel returns the model talked to.
+func (c *ChatGPT) CurrentModel() string {
+	if c.model != "" {
+		return c.model
+	}
+
+	return c.Model
+}
+
 func (c *ChatGPT) String() string {
 	json, err := json.MarshalIndent(c, "", " ")
 	if err != nil {
@@ -206,24 +247,36 @@ type ChatGPTs struct {
 	Clients map[string]*ChatGPT `json:"clients"`
 }
 
+// UseModel overrides the models of the sessions talking to the default model in this run (see ChatGPT.UseModel),
+// the sessions set to another model keep theirs.
+func (c *ChatGPTs) UseModel(model, defaultModel string) {
+	for _, chatgpt := range c.Clients {
+		if chatgpt.Model == "" || chatgpt.Model == defaultModel {
+			chatgpt.UseModel(model)
+		}
+	}
+}
+
 func newChatGPTs() ChatGPTs {
 	return ChatGPTs{Clients: map[string]*ChatGPT{}}
 }
 
-func (c ChatGPTs) NewSessionWithName(sessionName string, key string, model string) *ChatGPT {
+// NewSessionWithName creates the session using the key of credential (e.g. openai), or returns the existing one.
+func (c ChatGPTs) NewSessionWithName(sessionName string, credential string, model string) *ChatGPT {
 	sessionName = strings.ToLower(sessionName)
 	if client, ok := c.Clients[sessionName]; ok {
 		return client
 	}
 
-	client := NewChatGPT(key, model)
+	client := NewChatGPT("", model)
+	client.SetCredential(credential)
 	c.Clients[sessionName] = client
 
 	return client
 }
 
-func (c ChatGPTs) NewDefaultSession(key string, model string) *ChatGPT {
-	return c.NewSessionWithName("default", key, model)
+func (c ChatGPTs) NewDefaultSession(credential string, model string) *ChatGPT {
+	return c.NewSessionWithName("default", credential, model)
 }
 
 func (c ChatGPTs) DelSession(sessionName string) {
@@ -286,27 +339,33 @@ func (c ChatGPTs) GetDefaultGPT() (string, *ChatGPT) {
 
 var CHATGPTS = newChatGPTs()
 
-func (c ChatGPTs) SaveChatGPTs(file string) error {
-	json, err := json.MarshalIndent(c, "", " ")
-	if err != nil {
-		return err
+// migrateSessionKey references the key saved in the session by credential, the credential openai if it is the
+// same key, or openai-<session> kept in SECRETS. The key is left in the session if it can't be kept.
+func migrateSessionKey(name string, chatgpt *ChatGPT) {
+	credential := OpenaiCredential
+	if chatgpt.Key != LookupSecret(credential) {
+		credential += "-" + name
+		if err := SECRETS.Set(credential, chatgpt.Key); err != nil {
+			tlog.Debugf("keep the key of session %s: %s", name, err)
+			return
+		}
 	}
 
-	f, err := os.Create(file)
+	chatgpt.Credential, chatgpt.Key = credential, ""
+}
+
+func (c ChatGPTs) SaveChatGPTs(file string) error {
+	json, err := json.MarshalIndent(c, "", " ")
 	if err != nil {
 		return err
 	}
 
-	defer f.Close()
-	writer := bufio.NewWriter(f)
-	_, err = writer.Write(json)
-	if err != nil {
+	if err = writeFileAtomic(file, json); err != nil {
 		return err
 	}
 
 	tlog.Debugf("save chatgpts succeeded.")
-
-	return writer.Flush()
+	return nil
 }
 
 func (c *ChatGPTs) LoadChatGPTs(file string) error {
@@ -328,45 +387,15 @@ func (c *ChatGPTs) LoadChatGPTs(file string) error {
 	}
 
 	// create clients for each session
-	for _, chatgpt := range c.Clients {
-		chatgpt.client = openai.NewClient(chatgpt.Key)
-	}
-
-	tlog.Debugf("load chatgpts succeeded.")
-
-	return nil
-}
-
-type StreamSplitter struct {
-	segment strings.Builder
-	stream  *StreamResult
-}
-
-func NewStreamSplitter(stream *StreamResult) StreamSplitter {
-	return StreamSplitter{
-		segment: strings.Builder{},
-		stream:  stream,
-	}
-}
-
-func (ss StreamSplitter) Segment(echo bool) string {
-	var content string
-	for content = ss.stream.Next(); ss.stream.Err == nil && !strings.Contains(content, "\n"); content = ss.stream.Next() {
-		ss.segment.WriteString(content)
-		if echo {
-			fmt.Print(content)
+	for name, chatgpt := range c.Clients {
+		if chatgpt.Credential == "" && chatgpt.Key != "" {
+			migrateSessionKey(name, chatgpt)
 		}
-	}
 
-	if strings.Contains(content, "\n") {
-		ss.segment.WriteString(content)
-		if echo {
-			fmt.Print(content)
-		}
+		chatgpt.client = newOpenaiClient(chatgpt.APIKey())
 	}
 
-	res := ss.segment.String()
-	ss.segment.Reset()
+	tlog.Debugf("load chatgpts succeeded.")
 
-	return res
+	return nil
 }
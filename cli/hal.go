@@ -1,29 +1,80 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 
 	hal "github.com/neotse/hal"
 	"github.com/sashabaranov/go-openai"
 )
 
 func init() {
-	hal.PARAMS.LoadParams("params.json")
-	hal.CHATGPTS.LoadChatGPTs("sessions.json")
-	hal.HOOKS.LoadHooks("hooks.json")
+	// the config dir is needed before the flags are parsed, as their defaults are from params
+	dirs, err := hal.XDGDirs(argValue(os.Args[1:], "config-dir"))
+	if err == nil {
+		err = dirs.Create()
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	hal.DIRS = dirs
+	// only the first dir found with the params of HAL is copied
+	for _, old := range hal.OldDirs() {
+		if copied, err := dirs.Migrate(old); err != nil {
+			fmt.Println(err)
+			break
+		} else if len(copied) > 0 {
+			fmt.Printf("Copied %s to %s and %s\n", strings.Join(copied, ", "), dirs.Config, dirs.Data)
+			break
+		}
+	}
+
+	hal.PARAMS.LoadParams(hal.ConfigPath(hal.ParamsFile))
+	// the keys in params are moved to the secret store
+	if err = hal.PARAMS.ResolveSecrets(); err != nil {
+		fmt.Println(err)
+	} else if err = hal.PARAMS.StoreSecrets(); err != nil {
+		fmt.Println(err)
+	}
+
+	// the profile overrides params and the keys resolved, so it is chosen before the sessions are loaded
+	profile, defaultModel := argValue(os.Args[1:], "profile"), hal.PARAMS.ChatgptModel
+	if profile != "" {
+		if err = hal.PARAMS.UseProfile(profile); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+
+	hal.CHATGPTS.LoadChatGPTs(hal.ConfigPath(hal.SessionsFile))
+	if profile != "" {
+		hal.CHATGPTS.UseModel(hal.PARAMS.Profiles[profile].ChatgptModel, defaultModel)
+		// the hooks session keeps its fixed model
+		if hooks, ok := hal.CHATGPTS.Clients["hooks"]; ok {
+			hooks.UseModel("")
+		}
+	}
+
+	hal.HOOKS.LoadHooks(hal.PARAMS.HooksPath())
 }
 
 var (
 	forceInit     bool
 	verbose       bool
 	slient        bool
+	dictate       bool
 	listSession   bool
 	selectSession bool
 	deleteSession bool
@@ -35,39 +86,203 @@ var (
 	chatGPTModel  string
 	stopWord      string
 
+	recognitionEngine string
+	synthesisEngine   string
+	synthesisFormat   string
+	lookahead         int
+	speechCache       int
+	vadSensitivity    float64
+	fullDuplex        bool
+	echoCancel        bool
+
+	segmentationSilence int
+	initialSilence      int
+	recognitionDelay    int
+	synthesisDelay      int
+	maxBlank            int
+
 	showKeyword     bool
 	akeyword        string
 	keywordModel    string
 	keywordLanguage string
+	wakeWordEngine  string
+
+	recordAnswers bool
+	recordPrompts bool
+	subtitles     string
+	karaoke       bool
+	audioIO       string
+	inputDevice   string
+	outputDevice  string
+	listDevices   bool
+
+	speakText      string
+	speakOut       string
+	speakSubtitles string
+
+	listVoices    bool
+	voicesFilter  hal.VoiceFilter
+	voicesJSON    bool
+	voicesRefresh bool
+	voicesPreview bool
+	voicesText    string
+
+	transcribeFile     string
+	transcribeRaw      bool
+	transcribeRate     int
+	transcribeChannels int
+	transcribeSession  string
+
+	listProfiles     bool
+	createProfile    string
+	copyProfile      string
+	profileOverrides hal.Profile
 )
 
+// argValue returns the value of flag name in args (-name value, or -name=value), before the flags are parsed.
+func argValue(args []string, name string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || flagName != name {
+			continue
+		}
+
+		if hasValue {
+			return value
+		}
+
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+
+	return ""
+}
+
 func parseArgs() bool {
+	var configDir, profileName string
+	flag.StringVar(&configDir, "config-dir", "", "the dir of params.json, sessions.json and hooks.json. (default $XDG_CONFIG_HOME/hal)")
+	flag.StringVar(&profileName, "profile", "", "the profile overriding params, e.g. work or home. (see hal profile -list)")
 	flag.BoolVar(&forceInit, "init", false, "following a process to setup HAL (recommend for the first use).")
 	flag.BoolVar(&verbose, "verbose", false, "show more details.")
 	flag.BoolVar(&slient, "slient", false, "keep HAL slient.")
+	flag.BoolVar(&dictate, "dictate", false, "dictate long prompts across pauses with live captions, the prompt ends by a long silence.")
 	flag.IntVar(&maxHistory, "history", hal.PARAMS.MaxHistory, "the max history you want to keep when talk to chatgpt (Warning: the more history you have, the more tokens you use).")
 	flag.StringVar(&language, "language", "", "the language you want to talking with HAL. (see https://learn.microsoft.com/en-us/azure/cognitive-services/speech-service/language-support?tabs=stt)")
 	flag.StringVar(&voice, "voice", "", "the voice you want to HAL speaking if you allow it to speak. (see https://learn.microsoft.com/en-us/azure/cognitive-services/speech-service/language-support?tabs=tts).")
 	flag.StringVar(&chatGPTModel, "model", "", "the model you want to use int chatgpt (gpt-4-32k-0314, gpt-4-32k, gpt-4-0314, gpt-4, gpt-3.5-turbo-0301, gpt-3.5-turbo).")
 	flag.StringVar(&stopWord, "stopWord", "", "the keyword used to deactivate HAL.")
+	flag.StringVar(&recognitionEngine, "recognition", "", "the speech recognition engine, azure or whisper (offline, need whisper.cpp and its model).")
+	flag.StringVar(&synthesisEngine, "synthesis", "", "the speech synthesis engine, azure or espeak (offline, need espeak-ng).")
+	flag.StringVar(&synthesisFormat, "format", "", "the output format of speech synthesis, e.g. riff-24khz-16bit-mono-pcm or ogg-24khz-16bit-mono-opus. (see params.json)")
+	flag.IntVar(&lookahead, "lookahead", -1, "the segments of answer synthesized ahead of the one playing, 0 to speak one by one. (-1 for the value in params)")
+	flag.IntVar(&speechCache, "speechCache", -1, "the MB of speeches synthesized cached on disk, 0 to disable the cache. (-1 for the value in params)")
+	flag.Float64Var(&vadSensitivity, "vad", -1, "the sensitivity (0 to 1) of detecting speech, the higher the quieter speech is heard, 0 to push all the audio. (-1 for the value in params)")
+	flag.BoolVar(&fullDuplex, "fullDuplex", false, "keep the microphone open while HAL is speaking, better with -echoCancel.")
+	flag.BoolVar(&echoCancel, "echoCancel", false, "cancel the speech of HAL from the microphone, so it doesn't hear itself.")
+	flag.IntVar(&segmentationSilence, "segmentationSilence", 0, "the silence (ms) ends an utterance, longer for slow speakers. (0 for the value in params)")
+	flag.IntVar(&initialSilence, "initialSilence", 0, "the silence (ms) before speaking ends the recognition. (0 for the value in params)")
+	flag.IntVar(&recognitionDelay, "recognitionDelay", 0, "the max delay (s) of speech recognition. (0 for the value in params)")
+	flag.IntVar(&synthesisDelay, "synthesisDelay", 0, "the max delay (s) of speech synthesis. (0 for the value in params)")
+	flag.IntVar(&maxBlank, "maxBlank", 0, "HAL is deactivated after nothing heard for the times. (0 for the value in params)")
+	flag.BoolVar(&recordAnswers, "recordAnswers", false, "save the spoken answers to audio files linked from the transcript.")
+	flag.BoolVar(&recordPrompts, "recordPrompts", false, "save the prompts heard from microphone to audio files linked from the transcript (not for azure, which listens to microphone by itself).")
+	flag.StringVar(&subtitles, "subtitles", "", "save the subtitles (srt or vtt) beside the spoken answers recorded.")
+	flag.BoolVar(&karaoke, "karaoke", false, "show the answers word by word when they are spoken.")
+	flag.StringVar(&audioIO, "audio", "", "hal captures and plays the audio (needs alsa-utils, default if found), or azure by the speech SDK.")
+	flag.StringVar(&inputDevice, "input", "", "the microphone, an alsa device (e.g. plughw:CARD=USB,DEV=0) or pulse:<source>. (see hal devices)")
+	flag.StringVar(&outputDevice, "output", "", "the speaker, an alsa device (e.g. plughw:CARD=PCH,DEV=0) or pulse:<sink>. (see hal devices)")
 	session := flag.NewFlagSet("session", flag.ExitOnError)
 	session.BoolVar(&listSession, "list", false, "list current chatgpt sessions.")
 	session.BoolVar(&deleteSession, "delete", false, "delete the 'session' for talk. ")
 	session.BoolVar(&selectSession, "select", false, "select the 'session' for start to talk. If not set, it will select the session recently used.")
 	session.BoolVar(&createSession, "create", false, "create the 'session' for talk. ")
 	session.BoolVar(&configSession, "config", false, "config the 'session' for talk. ")
+	transcribe := flag.NewFlagSet("transcribe", flag.ExitOnError)
+	transcribe.Usage = func() {
+		fmt.Fprintln(transcribe.Output(), "Usage of transcribe: hal transcribe [flags] <file.wav|->")
+		transcribe.PrintDefaults()
+	}
+	transcribe.BoolVar(&transcribeRaw, "raw", false, "the audio is raw PCM (16 bits, little endian) but not wav.")
+	transcribe.IntVar(&transcribeRate, "rate", 16000, "the sample rate of raw PCM.")
+	transcribe.IntVar(&transcribeChannels, "channels", 1, "the channels of raw PCM.")
+	transcribe.StringVar(&transcribeSession, "session", "", "send the text as a prompt to the session, and print the answer.")
+	speak := flag.NewFlagSet("speak", flag.ExitOnError)
+	speak.Usage = func() {
+		fmt.Fprintln(speak.Output(), "Usage of speak: hal speak [flags] <text>")
+		speak.PrintDefaults()
+	}
+	speak.StringVar(&speakOut, "out", "", "save the speech to the audio file (.mp3, .ogg, .webm or .wav), but not play it.")
+	speak.StringVar(&speakSubtitles, "subtitles", "", "save the subtitles of the speech to the file (.srt or .vtt).")
+	voices := flag.NewFlagSet("voices", flag.ExitOnError)
+	voices.StringVar(&voicesFilter.Locale, "locale", "", "only the voices of the locale, e.g. en-US, or the language, e.g. en.")
+	voices.StringVar(&voicesFilter.Gender, "gender", "", "only the voices of the gender, female or male.")
+	voices.StringVar(&voicesFilter.Style, "style", "", "only the voices speaking in the style, e.g. cheerful.")
+	voices.BoolVar(&voicesFilter.Neural, "neural", false, "only the neural voices.")
+	voices.BoolVar(&voicesJSON, "json", false, "print the voices in JSON.")
+	voices.BoolVar(&voicesRefresh, "refresh", false, "retrieve the voices from azure but not the catalog saved.")
+	voices.BoolVar(&voicesPreview, "preview", false, "speak a sample sentence in each voice listed (10 at most), a filter is needed.")
+	voices.StringVar(&voicesText, "text", "", "the sentence to preview the voices, empty for a greeting in the language of each voice.")
 	keyword := flag.NewFlagSet("keyword", flag.ExitOnError)
 	keyword.BoolVar(&showKeyword, "show", false, "show the current config of keyword for activate.")
 	keyword.StringVar(&akeyword, "keyword", "", "set the keyword for activate (case insensitive), path and lang must be set at same time.")
 	keyword.StringVar(&keywordModel, "path", "", "set the path of model file of keyword.")
 	keyword.StringVar(&keywordLanguage, "lang", "", "set the language of keyword. (see https://learn.microsoft.com/en-us/azure/cognitive-services/speech-service/language-support?tabs=stt)")
+	keyword.StringVar(&wakeWordEngine, "engine", "", "set the engine of keyword detection, azure (need model file) or transcription (any keyword, no model file, recognized by the speech recognition engine).")
+	profile := flag.NewFlagSet("profile", flag.ExitOnError)
+	profile.BoolVar(&listProfiles, "list", false, "list the profiles and their overrides.")
+	profile.StringVar(&createProfile, "create", "", "create the profile of name, with the overrides set by the other flags.")
+	profile.StringVar(&copyProfile, "copy", "", "create the profile as a copy of the profile of name, along with -create.")
+	profile.StringVar(&profileOverrides.OpenaiCredential, "openaiCredential", "", "the name of credential used as the openai key, e.g. openai-work (HAL_OPENAI_WORK or in the secret store).")
+	profile.StringVar(&profileOverrides.SpeechKeyCredential, "speechKeyCredential", "", "the name of credential used as the azure speech key.")
+	profile.StringVar(&profileOverrides.SpeechRegionCredential, "speechRegionCredential", "", "the name of credential used as the azure speech region.")
+	profile.StringVar(&profileOverrides.OpenaiBaseURL, "openaiURL", "", "the API of openai, e.g. the proxy of company.")
+	profile.StringVar(&profileOverrides.ChatgptModel, "model", "", "the model of chatgpt.")
+	profile.StringVar(&profileOverrides.Language, "language", "", "the language talking with HAL.")
+	profile.StringVar(&profileOverrides.Voice, "voice", "", "the voice of HAL.")
+	profile.StringVar(&profileOverrides.Keyword, "keyword", "", "the keyword for activate.")
+	profile.StringVar(&profileOverrides.KeywordModel, "keywordModel", "", "the path of model file of keyword.")
+	profile.StringVar(&profileOverrides.KeywordLanguage, "keywordLanguage", "", "the language of keyword.")
+	profile.StringVar(&profileOverrides.Hooks, "hooks", "", "the hooks file in the config dir, e.g. hooks-work.json.")
 
 	flag.Parse()
-	if len(os.Args) > 1 {
-		if os.Args[1] == "session" {
-			session.Parse(os.Args[2:])
-		} else if os.Args[1] == "keyword" {
-			keyword.Parse(os.Args[2:])
+	// the subcommand is after the global flags
+	if flag.NArg() > 0 {
+		if flag.Arg(0) == "session" {
+			session.Parse(flag.Args()[1:])
+		} else if flag.Arg(0) == "keyword" {
+			keyword.Parse(flag.Args()[1:])
+		} else if flag.Arg(0) == "transcribe" {
+			transcribe.Parse(flag.Args()[1:])
+			if transcribe.NArg() != 1 {
+				transcribe.Usage()
+				os.Exit(2)
+			}
+
+			transcribeFile = transcribe.Arg(0)
+		} else if flag.Arg(0) == "speak" {
+			speak.Parse(flag.Args()[1:])
+			if speak.NArg() == 0 {
+				speak.Usage()
+				os.Exit(2)
+			}
+
+			speakText = strings.Join(speak.Args(), " ")
+		} else if flag.Arg(0) == "devices" {
+			listDevices = true
+		} else if flag.Arg(0) == "voices" {
+			voices.Parse(flag.Args()[1:])
+			listVoices = true
+		} else if flag.Arg(0) == "profile" {
+			profile.Parse(flag.Args()[1:])
+			if !listProfiles && createProfile == "" {
+				profile.Usage()
+				os.Exit(2)
+			}
 		}
 	}
 
@@ -89,22 +304,60 @@ func parseArgs() bool {
 	} else if showKeyword {
 		hal.Showkeyword()
 		return true
+	} else if createProfile != "" {
+		// the relative path in params is in the data dir
+		if profileOverrides.KeywordModel != "" {
+			if path, err := filepath.Abs(profileOverrides.KeywordModel); err == nil {
+				profileOverrides.KeywordModel = path
+			}
+		}
+
+		if err := hal.PARAMS.CreateProfile(createProfile, copyProfile, profileOverrides); err != nil {
+			panic(err)
+		}
+
+		hal.PARAMS.SaveParams(hal.ConfigPath(hal.ParamsFile))
+		fmt.Printf("Profile %s created, use it by hal -profile %s\n", createProfile, createProfile)
+		return true
+	} else if listProfiles {
+		showProfiles()
+		return true
+	}
+
+	if wakeWordEngine != "" {
+		hal.PARAMS.WakeWordEngine = wakeWordEngine
 	}
 
 	if akeyword != "" {
-		if keywordModel == "" || keywordLanguage == "" {
-			panic("path and lang must be set at the same time")
-		}
+		// the keyword detected by transcription needs no model
+		if hal.PARAMS.WakeWordEngine == hal.TranscriptionEngine {
+			if keywordLanguage != "" {
+				hal.PARAMS.KeywordLanguage = keywordLanguage
+			}
+		} else {
+			if keywordModel == "" || keywordLanguage == "" {
+				panic("path and lang must be set at the same time")
+			}
 
-		_, err := os.Stat(keywordModel)
-		if err != nil {
-			panic(err)
+			_, err := os.Stat(keywordModel)
+			if err != nil {
+				panic(err)
+			}
+
+			// the relative path in params is in the data dir
+			if path, err := filepath.Abs(keywordModel); err == nil {
+				keywordModel = path
+			}
+
+			hal.PARAMS.KeywordModel = keywordModel
+			hal.PARAMS.KeywordLanguage = keywordLanguage
 		}
 
 		hal.PARAMS.Keyword = akeyword
-		hal.PARAMS.KeywordModel = keywordModel
-		hal.PARAMS.KeywordLanguage = keywordLanguage
+	}
 
+	if akeyword != "" || wakeWordEngine != "" {
+		hal.PARAMS.SaveParams(hal.ConfigPath(hal.ParamsFile))
 		return true
 	}
 
@@ -126,25 +379,395 @@ func parseArgs() bool {
 		hal.PARAMS.StopWord = stopWord
 	}
 
+	if recognitionEngine != "" {
+		hal.PARAMS.RecognitionEngine = recognitionEngine
+	}
+
+	if synthesisEngine != "" {
+		hal.PARAMS.SynthesisEngine = synthesisEngine
+	}
+
+	if synthesisFormat != "" {
+		hal.PARAMS.SynthesisFormat = synthesisFormat
+	}
+
+	if lookahead >= 0 {
+		hal.PARAMS.SynthesisLookahead = lookahead
+	}
+
+	if speechCache >= 0 {
+		hal.PARAMS.SpeechCacheSize = speechCache
+	}
+
+	if vadSensitivity >= 0 {
+		hal.PARAMS.VADSensitivity = vadSensitivity
+	}
+
+	if fullDuplex {
+		hal.PARAMS.HalfDuplex = false
+	}
+
+	if echoCancel {
+		hal.PARAMS.EchoCancellation = true
+	}
+
+	if segmentationSilence != 0 {
+		hal.PARAMS.SegmentationSilenceTimeoutMs = segmentationSilence
+	}
+
+	if initialSilence != 0 {
+		hal.PARAMS.InitialSilenceTimeoutMs = initialSilence
+	}
+
+	if recognitionDelay != 0 {
+		hal.PARAMS.MaxSpeechRecognitionDelay = recognitionDelay
+	}
+
+	if synthesisDelay != 0 {
+		hal.PARAMS.MaxSpeechSynthesisDelay = synthesisDelay
+	}
+
+	if maxBlank != 0 {
+		hal.PARAMS.MaxBlankSpeeches = maxBlank
+	}
+
+	if recordAnswers {
+		hal.PARAMS.RecordAnswers = true
+	}
+
+	if recordPrompts {
+		hal.PARAMS.RecordPrompts = true
+	}
+
+	if subtitles != "" {
+		hal.PARAMS.Subtitles = subtitles
+	}
+
+	if karaoke {
+		hal.PARAMS.Karaoke = true
+	}
+
+	if audioIO != "" {
+		hal.PARAMS.AudioIO = audioIO
+	}
+
+	if inputDevice != "" {
+		hal.PARAMS.InputDevice = inputDevice
+	}
+
+	if outputDevice != "" {
+		hal.PARAMS.OutputDevice = outputDevice
+	}
+
+	if err := hal.PARAMS.Validate(); err != nil {
+		panic(err)
+	}
+
+	// the default timeouts of every command, the speech recognition keeps the ones of the language detected
+	hal.TIMEOUTS = hal.PARAMS.TimeoutsFor(hal.PARAMS.Language)
+
 	if verbose {
 		hal.SetLevel(hal.DEBUG)
 	}
 
+	if transcribeFile != "" {
+		transcribeAudio(transcribeFile)
+		return true
+	}
+
+	if speakText != "" {
+		speakTo(speakText, speakOut, speakSubtitles)
+		return true
+	}
+
+	if listVoices {
+		showVoices()
+		return true
+	}
+
+	if listDevices {
+		showDevices()
+		return true
+	}
+
 	return false
 }
 
+func transcribeAudio(file string) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			panic(err)
+		}
+
+		defer f.Close()
+		r = f
+	}
+
+	format := hal.PCMFormat{SampleRate: transcribeRate, Channels: transcribeChannels, BitsPerSample: 16}
+	if !transcribeRaw {
+		var err error
+		format, r, err = hal.ReadWav(r)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	audio, err := hal.NewPCMConverter(r, format, hal.DefaultPCMFormat)
+	if err != nil {
+		panic(err)
+	}
+
+	sr, err := hal.NewContinuousSpeechRecognitionFromParams(hal.PARAMS)
+	if err != nil {
+		panic(err)
+	}
+
+	defer sr.Close()
+	text, err := hal.Transcribe(sr, audio, os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	if transcribeSession == "" || text == "" {
+		return
+	}
+
+	cg := hal.CHATGPTS.Clients[strings.ToLower(transcribeSession)]
+	if cg == nil {
+		fmt.Printf("session %s not exists.\n", transcribeSession)
+		return
+	}
+
+	fmt.Println("Prompt:\n", text)
+	res, err := cg.PromptStream(text)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("ChatGPT:")
+	for content := res.Next(); res.Err == nil; content = res.Next() {
+		fmt.Print(content)
+	}
+	fmt.Println()
+
+	hal.CHATGPTS.SaveChatGPTs(hal.ConfigPath(hal.SessionsFile))
+}
+
+// showProfiles prints the profiles and their overrides, the one in use is marked.
+func showProfiles() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tNAME\tOVERRIDES")
+	for _, name := range hal.PARAMS.ProfileNames() {
+		mark := ""
+		if name == hal.PARAMS.ActiveProfile() {
+			mark = "*"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", mark, name, hal.PARAMS.Profiles[name])
+	}
+
+	w.Flush()
+}
+
+// showDevices prints the audio devices can be used as the microphone or speaker, the ones in use are marked.
+func showDevices() {
+	devices, err := hal.ListAudioDevices()
+	if err != nil {
+		panic(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tINPUT\tOUTPUT\tDESCRIPTION")
+	mark := func(can bool, name, used string) string {
+		switch {
+		case name == used:
+			return "*"
+		case can:
+			return "yes"
+		}
+
+		return ""
+	}
+
+	for _, d := range devices {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Name, mark(d.Input, d.Name, hal.PARAMS.InputDevice),
+			mark(d.Output, d.Name, hal.PARAMS.OutputDevice), d.Description)
+	}
+
+	w.Flush()
+}
+
+// maxVoicePreviews is the voices previewed at most.
+const maxVoicePreviews = 10
+
+// showVoices prints the voices of azure matching the filter, and previews them if asked.
+func showVoices() {
+	all, err := hal.LoadVoiceCatalog(hal.PARAMS, voicesRefresh)
+	if err != nil {
+		panic(err)
+	}
+
+	voices := hal.FilterVoices(all, voicesFilter)
+	if voicesJSON {
+		out, err := json.MarshalIndent(voices, "", " ")
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Println(string(out))
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tLOCALE\tGENDER\tNEURAL\tSTYLES")
+		for _, v := range voices {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", v.Name, v.Locale, v.Gender, v.Neural, strings.Join(v.StyleList, ","))
+		}
+
+		w.Flush()
+		fmt.Printf("%d of %d voices.\n", len(voices), len(all))
+	}
+
+	if !voicesPreview {
+		return
+	}
+
+	// each preview is a call to azure
+	if voicesFilter == (hal.VoiceFilter{}) {
+		fmt.Println("-preview needs a filter, e.g. -locale en-US.")
+		return
+	}
+
+	if len(voices) > maxVoicePreviews {
+		fmt.Printf("Previewing the first %d voices, narrow the filter to preview the others.\n", maxVoicePreviews)
+		voices = voices[:maxVoicePreviews]
+	}
+
+	for _, v := range voices {
+		text := voicesText
+		if text == "" {
+			text = hal.VoiceSample(v.Locale)
+		}
+
+		fmt.Printf("%s: %s\n", v.Name, text)
+		if err = previewVoice(v.Name, text); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+func previewVoice(voice, text string) error {
+	p := hal.PARAMS
+	p.SynthesisEngine = hal.AzureEngine
+	p.SynthesisFormat = ""
+	p.Voice = voice
+	ss, err := hal.NewSpeechSynthesisFromParams(p)
+	if err != nil {
+		return err
+	}
+
+	defer ss.Close()
+	if err = ss.TextToSpeech(text); err != nil {
+		return err
+	}
+
+	for _, _, err = ss.Result(); err == nil; _, _, err = ss.Result() {
+	}
+
+	if !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return ss.Error()
+}
+
+// speakTo speaks the text, and saves the speech to the file if out is set, in the format matches its extension.
+// The subtitles are saved if subtitlesOut is set.
+func speakTo(text, out, subtitlesOut string) {
+	p := hal.PARAMS
+	newSpeechSynthesis := hal.NewSpeechSynthesisFromParams
+	if out != "" {
+		newSpeechSynthesis = hal.NewSpeechSynthesisStreamFromParams
+		preferred, _ := p.AudioFormat()
+		format, err := hal.AudioFormatForExt(filepath.Ext(out), preferred)
+		if err != nil {
+			panic(err)
+		}
+
+		p.SynthesisFormat = format.Name
+	}
+
+	ss, err := newSpeechSynthesis(p)
+	if err != nil {
+		panic(err)
+	}
+
+	defer ss.Close()
+	recorder := &hal.AudioRecorder{}
+	if out != "" && !hal.Record(ss, recorder) {
+		panic("the speech synthesis engine not support recording")
+	}
+
+	err = ss.TextToSpeech(text)
+	if err != nil {
+		panic(err)
+	}
+
+	subtitles := hal.NewSubtitles()
+	var karaoke *hal.Karaoke
+	if out == "" && p.Karaoke {
+		karaoke = hal.NewKaraoke(os.Stdout)
+	}
+
+	var w *hal.WordBoundery
+	for w, _, err = ss.Result(); err == nil; w, _, err = ss.Result() {
+		subtitles.Add(w)
+		if karaoke != nil {
+			karaoke.Show(w)
+		}
+	}
+
+	if karaoke != nil {
+		karaoke.End()
+	}
+
+	if err = ss.Error(); err != nil {
+		panic(err)
+	}
+
+	subtitles.EndSpeech(hal.SpeechDuration(ss))
+	if subtitlesOut != "" {
+		if err = subtitles.Save(subtitlesOut); err != nil {
+			panic(err)
+		}
+
+		fmt.Println("Saved to", subtitlesOut)
+	}
+
+	if out == "" {
+		return
+	}
+
+	if err = recorder.Save(out); err != nil {
+		panic(err)
+	}
+
+	fmt.Println("Saved to", out)
+}
+
 func registerSignalHandler() {
 	schan := make(chan os.Signal, 2)
 	signal.Notify(schan, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-schan
-		hal.PARAMS.SaveParams("params.json")
+		hal.PARAMS.SaveParams(hal.ConfigPath(hal.ParamsFile))
 		fmt.Println("Params saved.")
 
-		hal.CHATGPTS.SaveChatGPTs("sessions.json")
+		hal.CHATGPTS.SaveChatGPTs(hal.ConfigPath(hal.SessionsFile))
 		fmt.Println("Sessions saved.")
 
-		hal.HOOKS.SaveHooks("hooks.json")
+		hal.HOOKS.SaveHooks(hal.PARAMS.HooksPath())
 		fmt.Println("Hooks saved.")
 		os.Exit(1)
 	}()
@@ -167,21 +790,22 @@ func main() {
 	fmt.Println("Params:")
 	fmt.Println(p)
 
-	var sr *hal.SpeechRecognitionStandalone
-	var err error
-	l := p.Language
-	if l != "" {
-		sr, err = hal.NewSpeechRecognitionStandalone(p.SpeechKey, p.SpeechRegion, []string{l})
-	} else {
-		sr, err = hal.NewAutoDetectedSpeechRecognitionStandalone(p.SpeechKey, p.SpeechRegion)
-		l = "auto detected"
-	}
-
+	sr, err := hal.NewSpeechRecognitionFromParams(p)
 	if err != nil {
 		panic(err)
 	}
 
-	sk, err := hal.NewKeywordRecognitionStandalone(p.SpeechKey, p.SpeechRegion, []string{p.KeywordLanguage}, p.KeywordModel, p.Keyword)
+	csr, ok := sr.(hal.ContinuousSpeechRecognition)
+	if dictate && !ok {
+		panic("the speech recognition engine not support dictation")
+	}
+
+	l := p.Language
+	if l == "" {
+		l = "auto detected"
+	}
+
+	sk, err := hal.NewWakeWordDetectorFromParams(p)
 	if err != nil {
 		panic(err)
 	}
@@ -192,59 +816,112 @@ func main() {
 	}
 
 	defer sk.Close()
-	fmt.Printf("Speech Recognition Initialized. Language: %s\n", l)
+	fmt.Printf("Speech Recognition Initialized. Engine: %s, Language: %s\n", p.RecognitionEngine, l)
 	defer sr.Close()
 
-	var ss *hal.SpeechSynthesisStandalone
+	// the speech pipelines speaking the answers in the languages detected, and the questions of dialog
+	pipelines := map[string]*hal.SpeechPipeline{}
+	var speaker hal.Speaker
 	// slient without Speech Synthesis
 	if !slient {
-		var err error
-		if p.Voice != "" {
-			ss, err = hal.NewSpeechSynthesisStandalone(p.SpeechKey, p.SpeechRegion, p.Voice)
-		} else {
-			ss, err = hal.NewAutoDetectedSpeechSynthesisStandalone(p.SpeechKey, p.SpeechRegion)
-			p.Voice = "auto detected"
-		}
-
+		pipeline, err := hal.NewSpeechPipelineFromParams(p)
 		if err != nil {
 			panic(err)
 		}
 
-		defer ss.Close()
+		pipelines[p.Language], speaker = pipeline, pipeline
+		defer func() {
+			for _, pipeline := range pipelines {
+				pipeline.Close()
+			}
+		}()
 
-		fmt.Printf("Speech Synthesis Initialized. Voice: %s\n", p.Voice)
+		if p.Voice == "" {
+			p.Voice = "auto detected"
+		}
+
+		fmt.Printf("Speech Synthesis Initialized. Engine: %s, Voice: %s\n", p.SynthesisEngine, p.Voice)
 	}
 
 	name, cg := hal.CHATGPTS.GetDefaultGPT()
 	if cg == nil { // no default chatGPT or not specified session, create default session
-		cg = hal.CHATGPTS.NewDefaultSession(hal.PARAMS.OpenaiKey, hal.PARAMS.ChatgptModel)
+		cg = hal.CHATGPTS.NewDefaultSession(hal.OpenaiCredential, hal.PARAMS.ChatgptModel)
 		cg.IsDefault = true
 	}
 
+	// hooks are triggered by voice, so the session flows of them talk by voice too.
+	hal.DIALOG = hal.NewVoiceDialog(sr, speaker)
+
 	initHooksChatGPT()
 
-	hal.CHATGPTS.SaveChatGPTs("sessions.json")
+	hal.CHATGPTS.SaveChatGPTs(hal.ConfigPath(hal.SessionsFile))
 
-	fmt.Printf("ChatGPT Initialized. Name: %s, Model: %s\n", name, cg.Model)
+	fmt.Printf("ChatGPT Initialized. Name: %s, Model: %s\n", name, cg.CurrentModel())
 
+	var transcript *hal.Transcript
+	if p.TranscriptDir != "" {
+		transcript, err = hal.NewTranscript(hal.DataPath(p.TranscriptDir), name)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// the audio of a turn, saved beside the transcript
+	var promptRecorder, answerRecorder *hal.AudioRecorder
+	if transcript != nil && p.RecordPrompts {
+		promptRecorder = &hal.AudioRecorder{}
+		if !hal.Record(sr, promptRecorder) {
+			fmt.Println("the speech recognition engine not support recording, try -audio hal.")
+		}
+	}
+
+	var subtitles *hal.Subtitles
+	if transcript != nil && p.RecordAnswers && !slient {
+		answerRecorder = &hal.AudioRecorder{}
+		if p.Subtitles != "" {
+			subtitles = hal.NewSubtitles()
+		}
+	}
+
+	var karaoke *hal.Karaoke
+	if p.Karaoke && !slient {
+		karaoke = hal.NewKaraoke(os.Stdout)
+	}
+
+	timeouts := p.TimeoutsFor(p.Language)
 	for {
-		fmt.Printf("Say %s activate and Say %s deactivate. Ctrl+C to quit\n", sk.KeyWord, hal.PARAMS.StopWord)
+		fmt.Printf("Say %s activate and Say %s deactivate. Ctrl+C to quit\n", p.Keyword, hal.PARAMS.StopWord)
 		r, err := sk.Result()
 		if err != nil {
 			panic(err)
 		}
 
 		fmt.Printf("%s here. \n", r)
+		// the sessions and hooks may be changed in the last activation
+		if err = hal.SetPhrases(sr, hal.CollectPhrases(hal.PARAMS)); err != nil {
+			fmt.Println(err)
+		}
+
 		var blank int
 		for {
-			if blank >= 3 {
+			if blank >= timeouts.MaxBlankSpeeches {
 				fmt.Println("long time no speak, deactivated.")
 				break
 			}
 
 			fmt.Println("Please speaking")
-			sr.Start()
-			text, err := sr.Result()
+			if promptRecorder != nil {
+				promptRecorder.Reset()
+			}
+
+			var speech hal.RecognitionResult
+			if dictate {
+				speech, err = hal.Dictate(csr, os.Stdout)
+			} else {
+				sr.Start()
+				speech, err = sr.Result()
+			}
+
 			if err != nil {
 				if !errors.Is(err, hal.ErrSpeechRecognitionTimeout) {
 					panic(err)
@@ -254,6 +931,15 @@ func main() {
 				}
 			}
 
+			// the next turns are in the language detected
+			if p.Language == "" && speech.Language != "" {
+				timeouts = p.TimeoutsFor(speech.Language)
+				if err = hal.SetTimeouts(sr, timeouts); err != nil {
+					fmt.Println(err)
+				}
+			}
+
+			text := speech.Text
 			if text == "" {
 				blank++
 				continue
@@ -268,7 +954,12 @@ func main() {
 				continue
 			}
 
-			fmt.Println("Prompt:\n", text)
+			fmt.Printf("Prompt (%s):\n %s\n", describeSpeech(speech), text)
+			if transcript != nil {
+				if err = transcript.LogPrompt(speech, saveAudio(transcript, promptRecorder, "prompt")); err != nil {
+					fmt.Println(err)
+				}
+			}
 
 			res, err := cg.PromptStream(text)
 			if err != nil {
@@ -276,35 +967,117 @@ func main() {
 				continue
 			}
 
+			if answerRecorder != nil {
+				answerRecorder.Reset()
+			}
+
+			if subtitles != nil {
+				subtitles.Reset()
+			}
+
 			fmt.Println("ChatGPT:")
 			streamSpitter := hal.NewStreamSplitter(res)
-			for content := streamSpitter.Segment(true); content != ""; content = streamSpitter.Segment(true) {
-				if !slient {
-					err = ss.TextToSpeech(content)
-					if err != nil {
-						panic(err)
-					}
-				}
+			streamSpitter.MinLength = p.MinSegmentLength
+			streamSpitter.MaxLength = p.MaxSegmentLength
+			streamSpitter.CodeBlock = p.CodeBlockSpeech
+			// the answer is in the language of prompt, it is read in the way of the language
+			streamSpitter.Normalizer = hal.NewSpeechNormalizer(p.ForLanguage(speech.Language).Language)
+			// the karaoke shows the words when they are spoken instead
+			echo := karaoke == nil
+			next := func() string {
+				return streamSpitter.Segment(echo)
+			}
 
-				for _, _, err := ss.Result(); err == nil; _, _, err = ss.Result() {
-					if err != nil {
-						fmt.Println(err)
-						break
-					}
+			if slient {
+				for content := next(); content != ""; content = next() {
 				}
-
-				if ss.Error() != nil {
+			} else {
+				// reply in the voice of the language spoken
+				pipeline := speechPipeline(pipelines, p, speech.Language)
+				pipeline.Prosody = cg.Prosody
+				pipeline.Recorder = answerRecorder
+				pipeline.Subtitles = subtitles
+				pipeline.Karaoke = karaoke
+				if err = pipeline.Run(next); err != nil {
 					panic(err)
 				}
 			}
 
 			fmt.Println()
+			if transcript != nil {
+				audio := saveAudio(transcript, answerRecorder, "answer")
+				if err = transcript.LogAnswer(streamSpitter.Text(), audio); err != nil {
+					fmt.Println(err)
+				}
+
+				if subtitles != nil && audio != "" {
+					saveSubtitles(subtitles, audio, p.Subtitles)
+				}
+			}
 		}
 	}
 }
 
+// saveAudio saves the audio recorded in the turn beside the transcript, and returns the file.
+func saveAudio(transcript *hal.Transcript, recorder *hal.AudioRecorder, role string) string {
+	if recorder == nil || recorder.Len() == 0 {
+		return ""
+	}
+
+	file, err := transcript.AudioFile(role, recorder.Ext())
+	if err == nil {
+		err = recorder.Save(file)
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+
+	return file
+}
+
+// saveSubtitles saves the subtitles of the answer beside its audio, with the same name.
+func saveSubtitles(subtitles *hal.Subtitles, audio, kind string) {
+	file := strings.TrimSuffix(audio, filepath.Ext(audio)) + "." + kind
+	if err := subtitles.Save(file); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// speechPipeline returns the speech pipeline speaking the language, it is created at the first time the
+// language is detected. The one of params is used if the language is unknown or fails to create.
+func speechPipeline(pipelines map[string]*hal.SpeechPipeline, p hal.Params, language string) *hal.SpeechPipeline {
+	lp := p.ForLanguage(language)
+	if pipeline, ok := pipelines[lp.Language]; ok {
+		return pipeline
+	}
+
+	pipeline, err := hal.NewSpeechPipelineFromParams(lp)
+	if err != nil {
+		fmt.Printf("speech synthesis for %s: %s\n", language, err)
+		return pipelines[p.Language]
+	}
+
+	pipelines[lp.Language] = pipeline
+	return pipeline
+}
+
+func describeSpeech(res hal.RecognitionResult) string {
+	l := res.Language
+	if l == "" {
+		l = "unknown language"
+	}
+
+	if res.Confidence > 0 {
+		l = fmt.Sprintf("%s, confidence %.0f%%", l, res.Confidence*100)
+	}
+
+	return l
+}
+
 func initHooksChatGPT() {
-	hooks := hal.CHATGPTS.NewSessionWithName("hooks", hal.PARAMS.OpenaiKey, openai.GPT3Dot5Turbo) // fix model
+	hooks := hal.CHATGPTS.NewSessionWithName("hooks", hal.OpenaiCredential, openai.GPT3Dot5Turbo) // fix model
 	if hooks != nil {
 		return
 	}
@@ -0,0 +1,204 @@
+package hal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Microsoft/cognitive-services-speech-sdk-go/audio"
+)
+
+// AudioDevices are the microphone and speaker used, empty for the default ones. A device is the name of alsa
+// (e.g. plughw:CARD=USB,DEV=0, see hal devices), or pulse:<name> for the source or sink of pulseaudio, which
+// is used through the pulse plugin of alsa.
+type AudioDevices struct {
+	InputDevice  string
+	OutputDevice string
+}
+
+// AudioDevice is an audio device can be used as InputDevice or OutputDevice.
+type AudioDevice struct {
+	Name        string
+	Description string
+	Input       bool
+	Output      bool
+}
+
+const pulseDevicePrefix = "pulse:"
+
+// ListAudioDevices lists the devices of alsa (by arecord and aplay), and the sources and sinks of pulseaudio
+// (by pactl) if it is running. The devices listed by any of them are returned, it fails only if all of them fail.
+func ListAudioDevices() ([]*AudioDevice, error) {
+	var devices []*AudioDevice
+	index := map[string]*AudioDevice{}
+	add := func(d *AudioDevice) {
+		if e, ok := index[d.Name]; ok {
+			e.Input, e.Output = e.Input || d.Input, e.Output || d.Output
+			return
+		}
+
+		index[d.Name] = d
+		devices = append(devices, d)
+	}
+
+	var listed bool
+	var errs []string
+	for _, binary := range []string{"arecord", "aplay"} {
+		out, err := exec.Command(binary, "-L").Output()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", binary, err))
+			continue
+		}
+
+		listed = true
+		for _, d := range parseAlsaDevices(string(out), binary == "arecord") {
+			add(d)
+		}
+	}
+
+	if _, err := exec.LookPath("pactl"); err == nil {
+		for _, kind := range []string{"sources", "sinks"} {
+			cmd := exec.Command("pactl", "list", kind)
+			// the field names are translated in other locales
+			cmd.Env = append(os.Environ(), "LC_ALL=C")
+			out, err := cmd.Output()
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("pactl: %s", err))
+				continue
+			}
+
+			listed = true
+			for _, d := range parsePulseDevices(string(out), kind == "sources") {
+				add(d)
+			}
+		}
+	}
+
+	if !listed {
+		return nil, errors.New(strings.Join(errs, ", "))
+	}
+
+	for _, err := range errs {
+		tlog.Debugf("list audio devices: %s", err)
+	}
+
+	return devices, nil
+}
+
+// parseAlsaDevices parses the output of arecord -L or aplay -L, a device name is followed by the indented
+// lines of description.
+func parseAlsaDevices(out string, input bool) []*AudioDevice {
+	var devices []*AudioDevice
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+			devices = append(devices, &AudioDevice{Name: line, Input: input, Output: !input})
+			continue
+		}
+
+		if len(devices) > 0 {
+			d := devices[len(devices)-1]
+			d.Description = strings.TrimSpace(d.Description + " " + strings.TrimSpace(line))
+		}
+	}
+
+	return devices
+}
+
+// parsePulseDevices parses the output of pactl list sources (or sinks), a device is the Name and Description
+// fields of a section. The monitors of sinks are not inputs of speech.
+func parsePulseDevices(out string, input bool) []*AudioDevice {
+	var devices []*AudioDevice
+	var d *AudioDevice
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if name, ok := cutPrefix(line, "Name: "); ok {
+			d = nil
+			if !strings.HasSuffix(name, ".monitor") {
+				d = &AudioDevice{Name: pulseDevicePrefix + name, Input: input, Output: !input}
+				devices = append(devices, d)
+			}
+		} else if description, ok := cutPrefix(line, "Description: "); ok && d != nil {
+			d.Description = description
+		}
+	}
+
+	return devices
+}
+
+// cutPrefix returns s without the prefix, and reports whether s has it.
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+
+	return s[len(prefix):], true
+}
+
+// alsaDevice returns the alsa device of the device, and the environment variable chooses the source (or sink) of
+// pulseaudio for the pulse plugin.
+func alsaDevice(device string, input bool) (string, string) {
+	if !strings.HasPrefix(device, pulseDevicePrefix) {
+		return device, ""
+	}
+
+	env := "PULSE_SINK="
+	if input {
+		env = "PULSE_SOURCE="
+	}
+
+	return "pulse", env + strings.TrimPrefix(device, pulseDevicePrefix)
+}
+
+// alsaCommand runs arecord or aplay (the binary) on the input or output device, the default one if it is empty.
+func alsaCommand(binary, device string, input bool, args ...string) *exec.Cmd {
+	name, env := alsaDevice(device, input)
+	if name != "" {
+		args = append([]string{"-D", name}, args...)
+	}
+
+	cmd := exec.Command(binary, args...)
+	if env != "" {
+		cmd.Env = append(os.Environ(), env)
+	}
+
+	return cmd
+}
+
+// microphoneAudioConfig returns the audio config of azure from the input device, the default one if it is empty.
+func microphoneAudioConfig(device string) (*audio.AudioConfig, error) {
+	if device == "" {
+		return audio.NewAudioConfigFromDefaultMicrophoneInput()
+	}
+
+	return audio.NewAudioConfigFromMicrophoneInput(inProcessDevice(device))
+}
+
+// speakerAudioConfig returns the audio config of azure to the output device, the default one if it is empty.
+func speakerAudioConfig(device string) (*audio.AudioConfig, error) {
+	if device == "" {
+		return audio.NewAudioConfigFromDefaultSpeakerOutput()
+	}
+
+	return audio.NewAudioConfigFromSpeakerOutput(inProcessDevice(device))
+}
+
+// inProcessDevice returns the alsa device opened by azure in process. The source or sink of pulseaudio is chosen
+// by the environment of the process, which is not changed by HAL, so the default one of pulseaudio is used.
+func inProcessDevice(device string) string {
+	if !strings.HasPrefix(device, pulseDevicePrefix) {
+		return device
+	}
+
+	tlog.Warningf("the audio of azure uses the default device of pulseaudio instead of %s, set AudioIO to hal to use it", device)
+	return "pulse"
+}
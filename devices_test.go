@@ -0,0 +1,58 @@
+package hal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAlsaDevices(t *testing.T) {
+	out := "null\n    Discard all samples (playback) or generate zero samples (capture)\n" +
+		"plughw:CARD=USB,DEV=0\n    Conference Speakerphone, USB Audio\n    Hardware device with all software conversions\n"
+	assert.Equal(t, []*AudioDevice{
+		{Name: "null", Description: "Discard all samples (playback) or generate zero samples (capture)", Input: true},
+		{Name: "plughw:CARD=USB,DEV=0", Description: "Conference Speakerphone, USB Audio Hardware device with all software conversions", Input: true},
+	}, parseAlsaDevices(out, true))
+}
+
+func TestParsePulseDevices(t *testing.T) {
+	out := "Source #0\n\tState: SUSPENDED\n\tName: alsa_output.usb-speakerphone.analog-stereo.monitor\n" +
+		"\tDescription: Monitor of Conference Speakerphone\n\tDriver: module-alsa-card.c\n\n" +
+		"Source #1\n\tState: RUNNING\n\tName: alsa_input.usb-speakerphone.mono-fallback\n" +
+		"\tDescription: Conference Speakerphone Mono\n\tDriver: module-alsa-card.c\n\tSample Specification: s16le 1ch 16000Hz\n"
+	assert.Equal(t, []*AudioDevice{
+		{Name: "pulse:alsa_input.usb-speakerphone.mono-fallback", Description: "Conference Speakerphone Mono", Input: true},
+	}, parsePulseDevices(out, true))
+}
+
+func TestListAudioDevices(t *testing.T) {
+	dir, err := os.MkdirTemp("./test_data", "devices")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// the devices of aplay are listed, even if arecord fails
+	path, err := filepath.Abs(dir)
+	assert.Nil(t, err)
+	t.Setenv("PATH", path)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "arecord"), []byte("#!/bin/sh\nexit 1\n"), 0o700))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "aplay"), []byte("#!/bin/sh\necho null\n"), 0o700))
+	devices, err := ListAudioDevices()
+	assert.Nil(t, err)
+	assert.Equal(t, []*AudioDevice{{Name: "null", Output: true}}, devices)
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "aplay"), []byte("#!/bin/sh\nexit 1\n"), 0o700))
+	_, err = ListAudioDevices()
+	assert.NotNil(t, err)
+}
+
+func TestAlsaCommand(t *testing.T) {
+	cmd := alsaCommand("arecord", "pulse:usb-mic", true, "-q")
+	assert.Equal(t, []string{"arecord", "-D", "pulse", "-q"}, cmd.Args)
+	assert.Contains(t, cmd.Env, "PULSE_SOURCE=usb-mic")
+	cmd = alsaCommand("aplay", "plughw:1,0", false, "-")
+	assert.Equal(t, []string{"aplay", "-D", "plughw:1,0", "-"}, cmd.Args)
+	assert.Nil(t, cmd.Env)
+	assert.Equal(t, []string{"aplay", "-"}, alsaCommand("aplay", "", false, "-").Args)
+}
@@ -0,0 +1,371 @@
+package hal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Dialog is the way HAL asks the user questions in the interactive flows
+// (create/select/config/delete session), either from terminal or by voice.
+type Dialog interface {
+	// Say tells the user something without waiting for an answer.
+	Say(text string)
+	// Ask asks a question and returns the answer. ok is false if the user cancelled.
+	Ask(question string) (answer string, ok bool)
+	// Choose asks the user to choose one of the options. It returns the index (start from 1)
+	// of the chosen option, 0 if the user cancelled, or -1 if no answer (keep the default).
+	Choose(question string, options []string) int
+	// Confirm asks a yes/no question.
+	Confirm(question string) bool
+}
+
+// DIALOG is used by the session flows, default from terminal.
+var DIALOG Dialog = NewTerminalDialog()
+
+type terminalDialog struct{}
+
+func NewTerminalDialog() Dialog {
+	return &terminalDialog{}
+}
+
+func (d *terminalDialog) Say(text string) {
+	fmt.Println(text)
+}
+
+func (d *terminalDialog) Ask(question string) (string, bool) {
+	fmt.Println(question)
+	return readStringFromStdin(), true
+}
+
+func (d *terminalDialog) Choose(question string, options []string) int {
+	for {
+		fmt.Println(question)
+		fmt.Println(formatOptions(options, "\n"))
+
+		choose := readIntFromStdin()
+		if choose >= -1 && choose <= len(options) {
+			return choose
+		}
+
+		fmt.Println("Invalid choice, please try again.")
+	}
+}
+
+func (d *terminalDialog) Confirm(question string) bool {
+	choice := "unknown"
+	for choice != "n" && choice != "no" && choice != "y" && choice != "yes" {
+		fmt.Println(question + " (yes/no)")
+		choice = strings.ToLower(readStringFromStdin())
+	}
+
+	return choice == "y" || choice == "yes"
+}
+
+// MaxDialogRetries is the times of voice dialog ask again when nothing (or nothing understandable) is heard.
+var MaxDialogRetries = 3
+
+// Speaker speaks the text and returns after it is spoken, e.g. SpeechPipeline.
+type Speaker interface {
+	Speak(text string) error
+}
+
+type voiceDialog struct {
+	sr      SpeechRecognition
+	speaker Speaker
+}
+
+// NewVoiceDialog creates a dialog that speaks the questions by speaker and listens the answers by sr.
+// speaker can be nil for slient mode, then the questions are only printed.
+func NewVoiceDialog(sr SpeechRecognition, speaker Speaker) Dialog {
+	return &voiceDialog{sr: sr, speaker: speaker}
+}
+
+func (d *voiceDialog) Say(text string) {
+	fmt.Println(text)
+	if d.speaker == nil {
+		return
+	}
+
+	if err := d.speaker.Speak(text); err != nil {
+		tlog.Errorf("dialog speak: %s", err)
+	}
+}
+
+func (d *voiceDialog) listen() string {
+	err := d.sr.Start()
+	if err != nil {
+		tlog.Errorf("dialog listen: %s", err)
+		return ""
+	}
+
+	res, err := d.sr.Result()
+	if err != nil {
+		tlog.Warningf("dialog listen: %s", err)
+		return ""
+	}
+
+	text := strings.TrimSpace(strings.TrimRightFunc(res.Text, unicode.IsPunct))
+	if text != "" {
+		fmt.Println(">", text)
+	}
+
+	return text
+}
+
+func (d *voiceDialog) Ask(question string) (string, bool) {
+	for i := 0; i < MaxDialogRetries; i++ {
+		d.Say(question)
+		text := d.listen()
+		if text == "" {
+			continue
+		}
+
+		if isCancel(text) {
+			return "", false
+		}
+
+		return text, true
+	}
+
+	return "", false
+}
+
+func (d *voiceDialog) Choose(question string, options []string) int {
+	for i := 0; i < MaxDialogRetries; i++ {
+		d.Say(question)
+		d.Say(formatOptions(options, ". "))
+		text := d.listen()
+		if text == "" {
+			continue
+		}
+
+		if isCancel(text) {
+			return 0
+		}
+
+		if idx := chooseOption(text, options); idx > 0 {
+			return idx
+		}
+
+		d.Say("Sorry, I didn't get it.")
+	}
+
+	return 0
+}
+
+func (d *voiceDialog) Confirm(question string) bool {
+	for i := 0; i < MaxDialogRetries; i++ {
+		d.Say(question)
+		text := d.listen()
+		if text == "" {
+			continue
+		}
+
+		if yes, ok := parseYesNo(text); ok {
+			return yes
+		}
+
+		d.Say("Please answer yes or no.")
+	}
+
+	return false
+}
+
+func formatOptions(options []string, sep string) string {
+	var b strings.Builder
+	for i, option := range options {
+		b.WriteString(fmt.Sprintf("%d. %s", i+1, option))
+		if i != len(options)-1 {
+			b.WriteString(sep)
+		}
+	}
+
+	return b.String()
+}
+
+// normalize lower the text and replace all punctuations and symbols with space.
+func normalize(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return ' '
+		}
+
+		return unicode.ToLower(r)
+	}, text)
+
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// chooseOption returns the index (start from 1) of the option chosen by text: the option said in it first, then its
+// number (e.g. "3" is the third option but not gpt-3.5-turbo), then the option partially said, or 0.
+func chooseOption(text string, options []string) int {
+	if idx := mentionOption(text, options); idx > 0 {
+		return idx
+	}
+
+	// zero is not an option, cancel is said by words
+	if n, ok := parseNumber(text); ok && n >= 1 && n <= len(options) {
+		return n
+	}
+
+	return matchOption(text, options)
+}
+
+// mentionOption returns the index (start from 1) of the option said as a whole in text, the longest one if more than
+// one, or 0.
+func mentionOption(text string, options []string) int {
+	t := strings.ReplaceAll(normalize(text), " ", "")
+	var idx, length int
+	for i, option := range options {
+		o := strings.ReplaceAll(normalize(option), " ", "")
+		if o != "" && strings.Contains(t, o) && len(o) > length {
+			idx, length = i+1, len(o)
+		}
+	}
+
+	return idx
+}
+
+// matchOption returns the index (start from 1) of the option mentioned in text, the longest one if more than one, or 0.
+func matchOption(text string, options []string) int {
+	t := strings.ReplaceAll(normalize(text), " ", "")
+	var idx, length int
+	for i, option := range options {
+		o := strings.ReplaceAll(normalize(option), " ", "")
+		if o == "" {
+			continue
+		}
+
+		if (strings.Contains(t, o) || strings.Contains(o, t)) && len(o) > length {
+			idx, length = i+1, len(o)
+		}
+	}
+
+	return idx
+}
+
+var numberWords = map[string]int{
+	// English
+	"zero": 0, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+	"eleven": 11, "twelve": 12, "thirteen": 13, "fourteen": 14, "fifteen": 15, "sixteen": 16, "seventeen": 17, "eighteen": 18, "nineteen": 19,
+	"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5, "sixth": 6, "seventh": 7, "eighth": 8, "ninth": 9, "tenth": 10,
+	// French
+	"zéro": 0, "un": 1, "une": 1, "deux": 2, "trois": 3, "quatre": 4, "cinq": 5, "sept": 7, "huit": 8, "neuf": 9, "dix": 10,
+	"onze": 11, "douze": 12, "treize": 13, "quatorze": 14, "quinze": 15, "seize": 16,
+	"premier": 1, "première": 1, "deuxième": 2, "seconde": 2, "troisième": 3, "quatrième": 4, "cinquième": 5,
+	"sixième": 6, "septième": 7, "huitième": 8, "neuvième": 9, "dixième": 10,
+	// Spanish
+	"cero": 0, "uno": 1, "una": 1, "dos": 2, "tres": 3, "cuatro": 4, "cinco": 5, "seis": 6, "siete": 7, "ocho": 8, "nueve": 9, "diez": 10,
+	"once": 11, "doce": 12, "trece": 13, "catorce": 14, "quince": 15,
+	"primero": 1, "primera": 1, "segundo": 2, "segunda": 2, "tercero": 3, "tercera": 3, "cuarto": 4, "cuarta": 4, "quinto": 5, "quinta": 5,
+	"sexto": 6, "sexta": 6, "séptimo": 7, "séptima": 7, "octavo": 8, "octava": 8, "noveno": 9, "novena": 9, "décimo": 10, "décima": 10,
+}
+
+var tensWords = map[string]int{
+	"twenty": 20, "thirty": 30, "forty": 40, "fifty": 50,
+	"vingt": 20, "trente": 30, "quarante": 40, "cinquante": 50,
+	"veinte": 20, "treinta": 30, "cuarenta": 40, "cincuenta": 50,
+}
+
+var chineseDigits = map[rune]int{'零': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+
+// parseNumber finds the first number in text, which can be digits, or number words in English, French, Spanish and Chinese.
+func parseNumber(text string) (int, bool) {
+	words := strings.Fields(normalize(text))
+	for i, w := range words {
+		if n, err := strconv.Atoi(w); err == nil {
+			return n, true
+		}
+
+		if n, ok := tensWords[w]; ok {
+			if i+1 < len(words) && numberWords[words[i+1]] > 0 && numberWords[words[i+1]] < 10 {
+				n += numberWords[words[i+1]]
+			}
+
+			return n, true
+		}
+
+		if n, ok := numberWords[w]; ok {
+			return n, true
+		}
+	}
+
+	return parseChineseNumber(text)
+}
+
+// parseChineseNumber parses the first chinese number (less than 100) in text, e.g. 三, 十二, 第二十一个
+func parseChineseNumber(text string) (int, bool) {
+	var n, digit int
+	var found, ten bool
+	for _, r := range text {
+		if d, ok := chineseDigits[r]; ok {
+			digit, found = d, true
+			continue
+		}
+
+		if r == '十' {
+			if digit == 0 {
+				digit = 1
+			}
+
+			n, digit, found, ten = digit*10, 0, true, true
+			continue
+		}
+
+		if found {
+			break
+		}
+	}
+
+	if !found {
+		return 0, false
+	}
+
+	if !ten {
+		return digit, true
+	}
+
+	return n + digit, true
+}
+
+var (
+	yesWords    = map[string]bool{"yes": true, "yeah": true, "yep": true, "sure": true, "ok": true, "okay": true, "confirm": true, "oui": true, "ouais": true, "accord": true, "sí": true, "si": true, "claro": true, "vale": true}
+	noWords     = map[string]bool{"no": true, "nope": true, "nah": true, "not": true, "non": true}
+	cancelWords = map[string]bool{"quit": true, "cancel": true, "exit": true, "nevermind": true, "annuler": true, "quitter": true, "cancelar": true, "salir": true}
+)
+
+// parseYesNo parses the answer of a yes/no question in English, French, Spanish and Chinese.
+func parseYesNo(text string) (yes bool, ok bool) {
+	for _, w := range strings.Fields(normalize(text)) {
+		if noWords[w] {
+			return false, true
+		}
+
+		if yesWords[w] {
+			return true, true
+		}
+	}
+
+	for _, r := range text {
+		switch r {
+		case '不', '否', '别':
+			return false, true
+		case '是', '好', '对', '行', '确':
+			return true, true
+		}
+	}
+
+	return false, false
+}
+
+func isCancel(text string) bool {
+	for _, w := range strings.Fields(normalize(text)) {
+		if cancelWords[w] {
+			return true
+		}
+	}
+
+	return strings.Contains(text, "退出") || strings.Contains(text, "取消") || strings.Contains(text, "算了")
+}
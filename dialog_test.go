@@ -0,0 +1,97 @@
+package hal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNumber(t *testing.T) {
+	cases := map[string]int{
+		"3":                             3,
+		"number 2.":                     2,
+		"The second one":                2,
+		"twenty one":                    21,
+		"Le troisième, s'il vous plaît": 3,
+		"la sesión cuatro":              4,
+		"第二个":                           2,
+		"十二":                            12,
+		"二十三号":                          23,
+		"zero":                          0,
+	}
+
+	for text, expected := range cases {
+		n, ok := parseNumber(text)
+		assert.True(t, ok, text)
+		assert.Equal(t, expected, n, text)
+	}
+
+	_, ok := parseNumber("the work session")
+	assert.False(t, ok)
+}
+
+func TestMatchOption(t *testing.T) {
+	options := []string{"[default] work", "translator", "work notes"}
+	assert.Equal(t, 1, matchOption("Work.", options))
+	assert.Equal(t, 2, matchOption("select the translator", options))
+	assert.Equal(t, 3, matchOption("work notes please", options))
+	assert.Equal(t, 0, matchOption("something else", options))
+}
+
+func TestChooseOption(t *testing.T) {
+	models := []string{"gpt-4-32k-0314", "gpt-4-32k", "gpt-4-0314", "gpt-4", "gpt-3.5-turbo-0301", "gpt-3.5-turbo"}
+	assert.Equal(t, 3, chooseOption("3", models))
+	assert.Equal(t, 4, chooseOption("four", models))
+	assert.Equal(t, 4, chooseOption("GPT 4", models))
+	assert.Equal(t, 6, chooseOption("gpt 3.5 turbo", models))
+	assert.Equal(t, 5, chooseOption("gpt 3.5 turbo 0301 please", models))
+	assert.Equal(t, 0, chooseOption("zero", models))
+	assert.Equal(t, 0, chooseOption("cero", models))
+	assert.Equal(t, 0, chooseOption("7", models))
+}
+
+func TestParseYesNo(t *testing.T) {
+	yes, ok := parseYesNo("Yes, please.")
+	assert.True(t, ok)
+	assert.True(t, yes)
+
+	yes, ok = parseYesNo("Non merci")
+	assert.True(t, ok)
+	assert.False(t, yes)
+
+	yes, ok = parseYesNo("不是")
+	assert.True(t, ok)
+	assert.False(t, yes)
+
+	yes, ok = parseYesNo("好的")
+	assert.True(t, ok)
+	assert.True(t, yes)
+
+	_, ok = parseYesNo("maybe later")
+	assert.False(t, ok)
+}
+
+func TestIsCancel(t *testing.T) {
+	assert.True(t, isCancel("Cancel."))
+	assert.True(t, isCancel("算了，退出吧"))
+	assert.False(t, isCancel("my session"))
+}
+
+func TestTerminalDialog(t *testing.T) {
+	d := NewTerminalDialog()
+
+	input = strings.NewReader("2\n")
+	assert.Equal(t, 2, d.Choose("choose", []string{"a", "b"}))
+
+	input = strings.NewReader("")
+	assert.Equal(t, -1, d.Choose("choose", []string{"a", "b"}))
+
+	input = strings.NewReader("yes\n")
+	assert.True(t, d.Confirm("sure?"))
+
+	input = strings.NewReader("my session\n")
+	answer, ok := d.Ask("name?")
+	assert.True(t, ok)
+	assert.Equal(t, "my session", answer)
+}
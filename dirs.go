@@ -0,0 +1,253 @@
+package hal
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Dirs are where HAL keeps its files: params.json, sessions.json, hooks.json, the key file and phrase files in
+// Config, the transcripts, caches and models (the other relative paths in params) in Data.
+type Dirs struct {
+	Config string
+	Data   string
+}
+
+// DIRS is empty for the working directory, it is set by the cli.
+var DIRS Dirs
+
+// The files in the config dir.
+const (
+	ParamsFile   = "params.json"
+	SessionsFile = "sessions.json"
+	HooksFile    = "hooks.json"
+)
+
+// configFiles are the files copied from the old install dir to the config dir on the first run.
+var configFiles = []string{ParamsFile, SessionsFile, HooksFile, "secrets.json"}
+
+// dataPaths are the default paths in params copied from the old install dir to the data dir on the first run.
+var dataPaths = []string{"transcripts", "cache", "model"}
+
+// XDGDirs returns the dirs of HAL by the XDG base directory specification, $XDG_CONFIG_HOME/hal (~/.config/hal
+// by default) and $XDG_DATA_HOME/hal (~/.local/share/hal by default). configDir overrides the config dir if set.
+func XDGDirs(configDir string) (Dirs, error) {
+	xdg := func(env, fallback string) (string, error) {
+		if dir := os.Getenv(env); filepath.IsAbs(dir) {
+			return filepath.Join(dir, "hal"), nil
+		}
+
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(home, fallback, "hal"), nil
+	}
+
+	var d Dirs
+	var err error
+	if configDir != "" {
+		d.Config, err = filepath.Abs(configDir)
+	} else {
+		d.Config, err = xdg("XDG_CONFIG_HOME", ".config")
+	}
+
+	if err != nil {
+		return d, err
+	}
+
+	d.Data, err = xdg("XDG_DATA_HOME", filepath.Join(".local", "share"))
+	return d, err
+}
+
+// Create makes the dirs, accessible by the owner only as the keys may be kept in.
+func (d Dirs) Create() error {
+	for _, dir := range []string{d.Config, d.Data} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OldDirs returns where the older versions of HAL kept their files, the working directory they ran in, and the
+// dir installed by install.sh.
+func OldDirs() []string {
+	var dirs []string
+	if wd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, wd)
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, "HAL", "go"))
+	}
+
+	return dirs
+}
+
+// Migrate copies the files of HAL in dir (one of OldDirs) to the dirs, if there is no
+// params.json in the config dir yet and the one in dir is of HAL. The files in dir are kept, and the existing
+// files in the dirs are not overwritten. It returns the files copied.
+func (d Dirs) Migrate(dir string) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(d.Config, ParamsFile)); err == nil {
+		return nil, nil
+	}
+
+	if !isHalParams(filepath.Join(dir, ParamsFile)) {
+		return nil, nil
+	}
+
+	var copied []string
+	migrate := func(name, to string) error {
+		from := filepath.Join(dir, name)
+		if _, err := os.Stat(to); err == nil {
+			return nil
+		}
+
+		if _, err := os.Stat(from); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		if err := copyPath(from, to); err != nil {
+			return err
+		}
+
+		copied = append(copied, from)
+		return nil
+	}
+
+	for _, name := range configFiles {
+		if err := migrate(name, filepath.Join(d.Config, name)); err != nil {
+			return copied, err
+		}
+	}
+
+	for _, name := range dataPaths {
+		if err := migrate(name, filepath.Join(d.Data, name)); err != nil {
+			return copied, err
+		}
+	}
+
+	return copied, nil
+}
+
+// isHalParams reports whether file is the params.json of HAL, with the fields every version of HAL saves.
+func isHalParams(file string) bool {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return false
+	}
+
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+
+	for _, name := range []string{"Initialized", "ChatgptModel", "MaxHistory"} {
+		if _, ok := fields[name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// copyPath copies the file or dir from to to, the files copied are accessible by the owner only.
+func copyPath(from, to string) error {
+	return filepath.WalkDir(from, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(to, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0o700)
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(to)
+	}
+
+	return err
+}
+
+// ConfigPath returns the path relative to the config dir, the absolute path (or empty) as it is.
+func ConfigPath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(DIRS.Config, path)
+}
+
+// DataPath returns the path relative to the data dir, the absolute path (or empty) as it is.
+func DataPath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(DIRS.Data, path)
+}
+
+// writeFileAtomic writes data to a temporary file (in 0600) and renames it to file, so the file is never left
+// partially written.
+func writeFileAtomic(file string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return err
+}
@@ -0,0 +1,113 @@
+package hal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXDGDirs(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/tmp/config")
+	t.Setenv("XDG_DATA_HOME", "/tmp/data")
+	d, err := XDGDirs("")
+	assert.Nil(t, err)
+	assert.Equal(t, Dirs{Config: "/tmp/config/hal", Data: "/tmp/data/hal"}, d)
+
+	d, err = XDGDirs("/tmp/work")
+	assert.Nil(t, err)
+	assert.Equal(t, Dirs{Config: "/tmp/work", Data: "/tmp/data/hal"}, d)
+
+	// the relative dir of XDG is ignored
+	t.Setenv("HOME", "/home/hal")
+	t.Setenv("XDG_CONFIG_HOME", "config")
+	t.Setenv("XDG_DATA_HOME", "")
+	d, err = XDGDirs("")
+	assert.Nil(t, err)
+	assert.Equal(t, Dirs{Config: "/home/hal/.config/hal", Data: "/home/hal/.local/share/hal"}, d)
+}
+
+func TestDirsPath(t *testing.T) {
+	defer func() { DIRS = Dirs{} }()
+	assert.Equal(t, "cache/speech", DataPath("cache/speech"))
+
+	DIRS = Dirs{Config: "/tmp/config/hal", Data: "/tmp/data/hal"}
+	assert.Equal(t, "/tmp/config/hal/params.json", ConfigPath(ParamsFile))
+	assert.Equal(t, "/tmp/data/hal/cache/speech", DataPath("cache/speech"))
+	assert.Equal(t, "/models/keyword.table", DataPath("/models/keyword.table"))
+	assert.Equal(t, "", DataPath(""))
+
+	// the model in the working directory is not used, whatever is there
+	assert.Equal(t, "/tmp/data/hal/dirs.go", DataPath("dirs.go"))
+}
+
+func TestDirsMigrate(t *testing.T) {
+	dir, err := os.MkdirTemp("./test_data", "dirs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	old := filepath.Join(dir, "old")
+	d := Dirs{Config: filepath.Join(dir, "config"), Data: filepath.Join(dir, "data")}
+	assert.Nil(t, os.MkdirAll(filepath.Join(old, "model"), 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(old, "model", "keyword.table"), []byte("table"), 0o644))
+	assert.Nil(t, d.Create())
+
+	// the params.json of others is not migrated
+	assert.Nil(t, os.WriteFile(filepath.Join(old, ParamsFile), []byte(`{"name":"other"}`), 0o644))
+	copied, err := d.Migrate(old)
+	assert.Nil(t, err)
+	assert.Empty(t, copied)
+
+	params := `{"Initialized":true,"ChatgptModel":"gpt-3.5-turbo","MaxHistory":4}`
+	assert.Nil(t, os.WriteFile(filepath.Join(old, ParamsFile), []byte(params), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(old, SessionsFile), []byte("{}"), 0o644))
+
+	// the existing file is kept
+	assert.Nil(t, os.WriteFile(filepath.Join(d.Config, SessionsFile), []byte(`{"clients":{}}`), 0o600))
+
+	copied, err = d.Migrate(old)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(old, ParamsFile), filepath.Join(old, "model")}, copied)
+	data, err := os.ReadFile(filepath.Join(d.Config, ParamsFile))
+	assert.Nil(t, err)
+	assert.Equal(t, params, string(data))
+	data, err = os.ReadFile(filepath.Join(d.Data, "model", "keyword.table"))
+	assert.Nil(t, err)
+	assert.Equal(t, "table", string(data))
+	data, err = os.ReadFile(filepath.Join(d.Config, SessionsFile))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"clients":{}}`, string(data))
+
+	// the files are copied, not moved
+	assert.FileExists(t, filepath.Join(old, ParamsFile))
+	assert.FileExists(t, filepath.Join(old, "model", "keyword.table"))
+
+	// only on the first run
+	assert.Nil(t, os.WriteFile(filepath.Join(old, HooksFile), []byte("{}"), 0o644))
+	copied, err = d.Migrate(old)
+	assert.Nil(t, err)
+	assert.Empty(t, copied)
+
+	// the older versions ran in the working directory
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Equal(t, wd, OldDirs()[0])
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := os.MkdirTemp("./test_data", "dirs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, ParamsFile)
+	assert.Nil(t, writeFileAtomic(file, []byte("1")))
+	assert.Nil(t, writeFileAtomic(file, []byte("2")))
+	data, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "2", string(data))
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,251 @@
+package hal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+)
+
+// maxEchoReference is the audio played kept as the reference of echo cancellation at most.
+const maxEchoReference = 30 * time.Second
+
+// maxEchoCancellerLength is the longest delay of echo cancelled, 1024 taps of filter in DefaultPCMFormat, so the
+// filter (two multiply-adds per tap and sample) keeps up with the capture in real time.
+const maxEchoCancellerLength = 64 * time.Millisecond
+
+// EchoSuppression keeps the speech of HAL from being heard as a prompt, when both the microphone and speaker are
+// used by HAL (see AudioIO). In half-duplex, the frames captured while HAL is speaking (and Tail after it) are
+// muted, otherwise the echo is cancelled by Canceller if it is set, with the audio played as the reference.
+type EchoSuppression struct {
+	HalfDuplex bool
+	Tail       time.Duration  // the echo lasting after the speech, by the latency of speaker and the room
+	Canceller  *EchoCanceller // nil for no cancellation
+
+	mu        sync.Mutex
+	playing   int          // the outputs playing
+	ended     time.Time    // the last output ended
+	reference bytes.Buffer // the audio played in DefaultPCMFormat, not heard yet
+}
+
+// echoSuppressions are shared by the audio captured and played with the same settings, see EchoSuppressionFor.
+var echoSuppressions = struct {
+	sync.Mutex
+	m map[echoSettings]*EchoSuppression
+}{m: map[echoSettings]*EchoSuppression{}}
+
+type echoSettings struct {
+	halfDuplex, cancel bool
+	tail               time.Duration
+}
+
+// EchoSuppressionFor returns the echo suppression of the settings, the same one for the ArecordCapture and
+// AudioOutput created with them, so the speech played is known by the capture. It is nil for no suppression.
+func EchoSuppressionFor(halfDuplex, cancel bool, tail time.Duration) *EchoSuppression {
+	if !halfDuplex && !cancel {
+		return nil
+	}
+
+	echoSuppressions.Lock()
+	defer echoSuppressions.Unlock()
+	key := echoSettings{halfDuplex: halfDuplex, cancel: cancel, tail: tail}
+	e, ok := echoSuppressions.m[key]
+	if !ok {
+		e = &EchoSuppression{}
+		e.Set(halfDuplex, cancel, tail)
+		echoSuppressions.m[key] = e
+	}
+
+	return e
+}
+
+// Set changes the settings, the canceller is kept if its length is not changed.
+func (e *EchoSuppression) Set(halfDuplex, cancel bool, tail time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.HalfDuplex, e.Tail = halfDuplex, tail
+	switch {
+	case !cancel:
+		e.Canceller = nil
+	case e.Canceller == nil || e.Canceller.Length() != echoCancellerLength(tail):
+		if tail > maxEchoCancellerLength {
+			tlog.Warningf("echo cancellation covers %s of the echo tail %s, the rest is not cancelled", maxEchoCancellerLength, tail)
+		}
+
+		e.Canceller = NewEchoCanceller(tail)
+	}
+}
+
+// startPlaying is called when an output starts playing.
+func (e *EchoSuppression) startPlaying() {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.playing++
+}
+
+// play keeps the audio played as the reference, only PCM can be cancelled.
+func (e *EchoSuppression) play(format AudioFormat, chunk []byte) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.Canceller == nil || !format.IsPCM() {
+		return
+	}
+
+	pcm, r := format.PCM, io.Reader(bytes.NewReader(chunk))
+	if bytes.HasPrefix(chunk, []byte("RIFF")) {
+		var err error
+		if pcm, r, err = ReadWav(r); err != nil {
+			tlog.Debugf("echo reference: %s", err)
+			return
+		}
+	}
+
+	r, err := NewPCMConverter(r, pcm, DefaultPCMFormat)
+	if err == nil {
+		_, err = e.reference.ReadFrom(r)
+	}
+
+	if err != nil {
+		tlog.Debugf("echo reference: %s", err)
+	}
+
+	if max := int(int64(DefaultPCMFormat.BytesPerSecond()) * int64(maxEchoReference) / int64(time.Second)); e.reference.Len() > max {
+		e.reference.Next((e.reference.Len() - max) &^ 1)
+	}
+}
+
+// stopPlaying is called when an output ends playing.
+func (e *EchoSuppression) stopPlaying() {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.playing--
+	e.ended = time.Now()
+}
+
+// Process returns the frame captured (in DefaultPCMFormat) without the echo, the silence if it is muted. The frame
+// is returned as is by nil.
+func (e *EchoSuppression) Process(frame []byte) []byte {
+	if e == nil {
+		return frame
+	}
+
+	e.mu.Lock()
+	echoing := e.playing > 0 || time.Since(e.ended) < e.Tail
+	canceller := e.Canceller
+	var reference []byte
+	if canceller != nil {
+		// the reference is consumed as the microphone hears it, even muted
+		reference = append(reference, e.reference.Next(len(frame))...)
+	}
+
+	muted := e.HalfDuplex && echoing
+	e.mu.Unlock()
+
+	switch {
+	case muted:
+		return make([]byte, len(frame))
+	case canceller != nil && (echoing || len(reference) > 0):
+		return canceller.Cancel(frame, reference)
+	}
+
+	return frame
+}
+
+// EchoCanceller cancels the echo of the reference signal from the microphone by an adaptive filter (NLMS), both
+// in 16 bits mono PCM (DefaultPCMFormat). The filter covers the echo delayed up to its length.
+type EchoCanceller struct {
+	Step float64 // the step size of adaption, 0 to 1
+
+	weights []float64
+	history []float64 // the reference samples twice, so the latest ones are contiguous
+	pos     int       // the latest reference sample is history[pos]
+	power   float64   // the energy of reference samples in the filter
+}
+
+// NewEchoCanceller creates the canceller of the echo delayed up to length, maxEchoCancellerLength at most.
+func NewEchoCanceller(length time.Duration) *EchoCanceller {
+	n := int(int64(DefaultPCMFormat.SampleRate) * int64(echoCancellerLength(length)) / int64(time.Second))
+	if n < 1 {
+		n = 1
+	}
+
+	return &EchoCanceller{Step: 0.5, weights: make([]float64, n), history: make([]float64, 2*n)}
+}
+
+func echoCancellerLength(length time.Duration) time.Duration {
+	if length > maxEchoCancellerLength {
+		return maxEchoCancellerLength
+	}
+
+	return length
+}
+
+// Length returns the longest delay of echo can be cancelled.
+func (c *EchoCanceller) Length() time.Duration {
+	return time.Duration(len(c.weights)) * time.Second / time.Duration(DefaultPCMFormat.SampleRate)
+}
+
+// Cancel returns the frame without the echo of the reference played along with it, the missing reference is
+// silence.
+func (c *EchoCanceller) Cancel(frame, reference []byte) []byte {
+	n := len(c.weights)
+	out := make([]byte, len(frame))
+	for i := 0; i+1 < len(frame); i += 2 {
+		var x float64
+		if i+1 < len(reference) {
+			x = float64(int16(binary.LittleEndian.Uint16(reference[i:])))
+		}
+
+		// slides the window of reference samples
+		oldest := c.history[c.pos+n-1]
+		c.pos = (c.pos + n - 1) % n
+		c.history[c.pos], c.history[c.pos+n] = x, x
+		c.power += x*x - oldest*oldest
+		if c.power < 0 {
+			c.power = 0
+		}
+
+		window := c.history[c.pos : c.pos+n]
+		var echo float64
+		for k, w := range c.weights {
+			echo += w * window[k]
+		}
+
+		d := float64(int16(binary.LittleEndian.Uint16(frame[i:])))
+		e := d - echo
+		if c.power > 0 {
+			g := c.Step * e / (c.power + 1)
+			for k := range c.weights {
+				c.weights[k] += g * window[k]
+			}
+		}
+
+		binary.LittleEndian.PutUint16(out[i:], uint16(clampInt16(e)))
+	}
+
+	return out
+}
+
+func clampInt16(v float64) int16 {
+	switch {
+	case v > 32767:
+		return 32767
+	case v < -32768:
+		return -32768
+	}
+
+	return int16(v)
+}
@@ -0,0 +1,96 @@
+package hal
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEchoSuppressionHalfDuplex(t *testing.T) {
+	e := &EchoSuppression{HalfDuplex: true, Tail: 50 * time.Millisecond}
+	frame := toneFrame(3000)
+	assert.Equal(t, frame, e.Process(frame))
+
+	e.startPlaying()
+	assert.Equal(t, make([]byte, len(frame)), e.Process(frame))
+
+	// the tail after the speech
+	e.stopPlaying()
+	assert.Equal(t, make([]byte, len(frame)), e.Process(frame))
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, frame, e.Process(frame))
+}
+
+func TestEchoSuppressionReference(t *testing.T) {
+	e := &EchoSuppression{}
+	e.Set(false, true, 10*time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, e.Canceller.Length())
+
+	canceller := e.Canceller
+	e.Set(false, true, 10*time.Millisecond)
+	assert.Same(t, canceller, e.Canceller)
+
+	// the long tail is cancelled up to maxEchoCancellerLength, and the canceller is kept as well
+	e.Set(false, true, 200*time.Millisecond)
+	assert.Equal(t, maxEchoCancellerLength, e.Canceller.Length())
+	canceller = e.Canceller
+	e.Set(false, true, 200*time.Millisecond)
+	assert.Same(t, canceller, e.Canceller)
+
+	// the reference is converted to DefaultPCMFormat
+	format, err := ParseAudioFormat("raw-48khz-16bit-mono-pcm")
+	assert.Nil(t, err)
+	e.startPlaying()
+	e.play(format, make([]byte, 3*len(toneFrame(0))))
+	assert.InDelta(t, len(toneFrame(0)), e.reference.Len(), 4)
+	e.stopPlaying()
+
+	// the speech played is cancelled while the other is kept
+	frame := toneFrame(3000)
+	assert.Equal(t, frame, e.Process(frame))
+	assert.Equal(t, 0, e.reference.Len())
+
+	e.Set(false, false, 10*time.Millisecond)
+	assert.Nil(t, e.Canceller)
+}
+
+func TestEchoSuppressionFor(t *testing.T) {
+	assert.Nil(t, EchoSuppressionFor(false, false, 100*time.Millisecond))
+
+	e := EchoSuppressionFor(true, false, 100*time.Millisecond)
+	assert.True(t, e.HalfDuplex)
+	assert.Nil(t, e.Canceller)
+	assert.Same(t, e, EchoSuppressionFor(true, false, 100*time.Millisecond))
+	assert.NotSame(t, e, EchoSuppressionFor(true, false, 200*time.Millisecond))
+}
+
+func TestEchoCanceller(t *testing.T) {
+	c := NewEchoCanceller(5 * time.Millisecond)
+	r := rand.New(rand.NewSource(1))
+	frameSize := len(toneFrame(0))
+	delayed := make([]float64, 20)
+	var echoLevel, residualLevel float64
+	for f := 0; f < 100; f++ {
+		reference, frame := make([]byte, frameSize), make([]byte, frameSize)
+		for i := 0; i < frameSize; i += 2 {
+			x := 8000 * (2*r.Float64() - 1)
+			binary.LittleEndian.PutUint16(reference[i:], uint16(int16(x)))
+
+			// the echo is delayed by 20 samples and weakened
+			delayed = append(delayed, x)
+			binary.LittleEndian.PutUint16(frame[i:], uint16(int16(0.6*delayed[0])))
+			delayed = delayed[1:]
+		}
+
+		out := c.Cancel(frame, reference)
+		if f >= 90 {
+			echoLevel += pcmLevel(frame)
+			residualLevel += pcmLevel(out)
+		}
+	}
+
+	assert.Less(t, residualLevel, echoLevel/20)
+}
@@ -0,0 +1,379 @@
+package hal
+
+import (
+	"fmt"
+	"time"
+)
+
+// NewSpeechRecognitionFromParams creates the speech recognition from microphone by the engine in params,
+// and uses the timeouts of its language.
+func NewSpeechRecognitionFromParams(p Params) (SpeechRecognition, error) {
+	sr, err := newSpeechRecognition(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = withTimeouts(sr, p.TimeoutsFor(p.Language)); err != nil {
+		return nil, err
+	}
+
+	if err = withPhrases(sr, CollectPhrases(p)); err != nil {
+		return nil, err
+	}
+
+	return sr, nil
+}
+
+func newSpeechRecognition(p Params) (SpeechRecognition, error) {
+	switch p.RecognitionEngine {
+	case "", AzureEngine:
+		if p.halAudioIO() {
+			return newLocalSpeechRecognition(p)
+		}
+
+		languages := GetAutoDetectedLanguages()
+		if p.Language != "" {
+			languages = []string{p.Language}
+		}
+
+		return newSpeechRecognitionStandalone(p.SpeechKey, p.SpeechRegion, languages, p.InputDevice)
+	case WhisperEngine:
+		languages := GetAutoDetectedLanguages()
+		if p.Language != "" {
+			languages = []string{p.Language}
+		}
+
+		sr, err := NewWhisperSpeechRecognitionStandalone(p.WhisperBinary, DataPath(p.WhisperModel), languages)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.VADSensitivity > 0 {
+			sr.VAD.Sensitivity = p.VADSensitivity
+		}
+
+		if capture, ok := sr.capture.(*ArecordCapture); ok {
+			capture.Device, capture.Echo = p.InputDevice, p.echoSuppression()
+		}
+
+		return sr, nil
+	}
+
+	return nil, fmt.Errorf("unknown speech recognition engine: %s", p.RecognitionEngine)
+}
+
+// newLocalSpeechRecognition creates the speech recognition of pushed audio, the audio is captured from microphone
+// by HAL.
+func newLocalSpeechRecognition(p Params) (SpeechRecognition, error) {
+	capture, err := NewArecordCapture(DefaultPCMFormat, 30*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	capture.Device, capture.Echo = p.InputDevice, p.echoSuppression()
+	sr, err := newSpeechRecognitionStream(p)
+	if err != nil {
+		return nil, err
+	}
+
+	local := NewLocalSpeechRecognition(sr, capture)
+	if p.VADSensitivity > 0 {
+		local.VAD = NewVoiceActivityDetector(p.VADSensitivity)
+	}
+
+	return local, nil
+}
+
+// NewSpeechRecognitionStreamFromParams creates the speech recognition from pushed audio (DefaultPCMFormat)
+// by the engine in params, and uses the timeouts of its language.
+func NewSpeechRecognitionStreamFromParams(p Params) (SpeechRecognition, error) {
+	sr, err := newSpeechRecognitionStream(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = withTimeouts(sr, p.TimeoutsFor(p.Language)); err != nil {
+		return nil, err
+	}
+
+	if err = withPhrases(sr, CollectPhrases(p)); err != nil {
+		return nil, err
+	}
+
+	return sr, nil
+}
+
+func newSpeechRecognitionStream(p Params) (SpeechRecognition, error) {
+	switch p.RecognitionEngine {
+	case "", AzureEngine:
+		if p.Language != "" {
+			return NewSpeechRecognitionStream(p.SpeechKey, p.SpeechRegion, []string{p.Language})
+		}
+
+		return NewAutoDetectedSpeechRecognitionStream(p.SpeechKey, p.SpeechRegion)
+	case WhisperEngine:
+		if p.Language != "" {
+			return NewWhisperSpeechRecognition(p.WhisperBinary, DataPath(p.WhisperModel), []string{p.Language})
+		}
+
+		return NewAutoDetectedWhisperSpeechRecognition(p.WhisperBinary, DataPath(p.WhisperModel))
+	}
+
+	return nil, fmt.Errorf("unknown speech recognition engine: %s", p.RecognitionEngine)
+}
+
+// NewContinuousSpeechRecognitionFromParams creates the continuous speech recognition from pushed audio (DefaultPCMFormat)
+// by the engine in params.
+func NewContinuousSpeechRecognitionFromParams(p Params) (ContinuousSpeechRecognition, error) {
+	sr, err := NewSpeechRecognitionStreamFromParams(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if c, ok := sr.(ContinuousSpeechRecognition); ok {
+		return c, nil
+	}
+
+	sr.Close()
+	return nil, fmt.Errorf("speech recognition engine %s not support continuous recognition", p.RecognitionEngine)
+}
+
+// NewSpeechSynthesisFromParams creates the speech synthesis playing on speaker by the engine in params. The audio
+// is played by HAL if AudioIO is hal, or the speech cache is used (see playedFormat).
+func NewSpeechSynthesisFromParams(p Params) (SpeechSynthesis, error) {
+	format, err := p.AudioFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	player, playerErr := p.aplayPlayer()
+	cached := p.SpeechCacheSize > 0 && playerErr == nil
+	if cached || p.halAudioIO() {
+		if format, err = p.playedFormat(); err != nil {
+			return nil, err
+		}
+
+		p.SynthesisFormat = format.Name
+		ss, err := newSpeechSynthesisStream(p, format)
+		if err != nil {
+			return nil, err
+		}
+
+		if cached {
+			return p.withSpeechCache(ss, format, player)
+		}
+
+		local, err := NewLocalSpeechSynthesis(ss, format)
+		if err != nil {
+			ss.Close()
+			return nil, err
+		}
+
+		local.Device, local.Echo = p.OutputDevice, p.echoSuppression()
+		return local, nil
+	}
+
+	switch p.SynthesisEngine {
+	case "", AzureEngine:
+		if p.Voice != "" {
+			return newSpeechSynthesisStandalone(p.SpeechKey, p.SpeechRegion, p.Voice, format, p.OutputDevice)
+		}
+
+		return newAutoDetectedSpeechSynthesisStandalone(p.SpeechKey, p.SpeechRegion, format, p.OutputDevice)
+	case EspeakEngine:
+		ss, err := NewEspeakSpeechSynthesisStandalone(p.EspeakBinary, p.espeakVoice(), format)
+		if err != nil {
+			return nil, err
+		}
+
+		ss.device = p.OutputDevice
+		return ss, nil
+	}
+
+	return nil, fmt.Errorf("unknown speech synthesis engine: %s", p.SynthesisEngine)
+}
+
+// NewSpeechSynthesisStreamFromParams creates the speech synthesis output audio by Result by the engine in params,
+// the speeches are cached if SpeechCacheSize is set.
+func NewSpeechSynthesisStreamFromParams(p Params) (SpeechSynthesis, error) {
+	format, err := p.AudioFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	ss, err := newSpeechSynthesisStream(p, format)
+	if err != nil || p.SpeechCacheSize <= 0 {
+		return ss, err
+	}
+
+	return p.withSpeechCache(ss, format, nil)
+}
+
+func newSpeechSynthesisStream(p Params, format AudioFormat) (SpeechSynthesis, error) {
+	switch p.SynthesisEngine {
+	case "", AzureEngine:
+		if p.Voice != "" {
+			return NewSpeechSynthesisStream(p.SpeechKey, p.SpeechRegion, p.Voice, format)
+		}
+
+		return NewAutoDetectedSpeechSynthesisStream(p.SpeechKey, p.SpeechRegion, format)
+	case EspeakEngine:
+		if voice := p.espeakVoice(); voice != "" {
+			return NewEspeakSpeechSynthesisStream(p.EspeakBinary, voice, format)
+		}
+
+		return NewAutoDetectedEspeakSpeechSynthesisStream(p.EspeakBinary, format)
+	}
+
+	return nil, fmt.Errorf("unknown speech synthesis engine: %s", p.SynthesisEngine)
+}
+
+// NewSpeechPipelineFromParams creates the pipeline speaking by the engine in params. SynthesisLookahead segments
+// are synthesized ahead of the one playing (by aplay or mpg123), or the segments are spoken one by one by the speech
+// synthesis playing on speaker if SynthesisLookahead is 0 or aplay is not found.
+func NewSpeechPipelineFromParams(p Params) (*SpeechPipeline, error) {
+	player, err := p.aplayPlayer()
+	if p.SynthesisLookahead <= 0 || err != nil {
+		ss, err := NewSpeechSynthesisFromParams(p)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewStandaloneSpeechPipeline(ss), nil
+	}
+
+	format, err := p.playedFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	p.SynthesisFormat = format.Name
+
+	var synthesizers []SpeechSynthesis
+	for i := 0; i < p.SynthesisLookahead; i++ {
+		ss, err := NewSpeechSynthesisStreamFromParams(p)
+		if err != nil {
+			for _, ss := range synthesizers {
+				ss.Close()
+			}
+
+			return nil, err
+		}
+
+		synthesizers = append(synthesizers, ss)
+	}
+
+	pipeline := NewSpeechPipeline(synthesizers, format, player)
+	pipeline.Lookahead = p.SynthesisLookahead
+	return pipeline, nil
+}
+
+// playedFormat returns the format of speech played by HAL, which plays PCM and MP3 (by mpg123) only, and cancels
+// the echo with PCM. The default format is changed to PCM if it can't be played, but the SynthesisFormat set is
+// never changed (the recordings and cache are in it), it fails instead.
+func (p Params) playedFormat() (AudioFormat, error) {
+	format, err := p.AudioFormat()
+	if err != nil || (CanPlay(format) && (!p.EchoCancellation || format.IsPCM())) {
+		return format, err
+	}
+
+	if p.SynthesisFormat != "" {
+		return format, fmt.Errorf("SynthesisFormat %s can't be played by HAL, set a PCM format (or MP3 with mpg123 and without EchoCancellation)", format.Name)
+	}
+
+	pcm, _ := AudioFormatForExt(".wav", format)
+	tlog.Debugf("speech synthesis: %s can't be played, use %s", format.Name, pcm.Name)
+	return pcm, nil
+}
+
+// echoSuppression returns the echo suppression shared by the audio captured and played by HAL with params, nil if
+// the echo is not suppressed.
+func (p Params) echoSuppression() *EchoSuppression {
+	return EchoSuppressionFor(p.HalfDuplex, p.EchoCancellation, time.Duration(p.EchoTailMs)*time.Millisecond)
+}
+
+// aplayPlayer creates the player on the output device, the echo of the audio played is suppressed.
+func (p Params) aplayPlayer() (*AplayPlayer, error) {
+	player, err := NewAplayPlayer()
+	if err != nil {
+		return nil, err
+	}
+
+	player.Device, player.Echo = p.OutputDevice, p.echoSuppression()
+	return player, nil
+}
+
+// withSpeechCache wraps ss by the speech cache in params, ss is closed if failed.
+func (p Params) withSpeechCache(ss SpeechSynthesis, format AudioFormat, player AudioPlayer) (SpeechSynthesis, error) {
+	cache, err := NewSpeechCache(DataPath(p.SpeechCacheDir), int64(p.SpeechCacheSize)<<20)
+	if err != nil {
+		ss.Close()
+		return nil, err
+	}
+
+	voice := p.Voice
+	if p.SynthesisEngine == EspeakEngine {
+		voice = p.espeakVoice()
+	}
+
+	engine := p.SynthesisEngine
+	if engine == "" {
+		engine = AzureEngine
+	}
+
+	return NewCachedSpeechSynthesis(ss, cache, engine+"/"+voice, format, player), nil
+}
+
+// withTimeouts sets the timeouts of sr, it is closed if failed.
+func withTimeouts(sr SpeechRecognition, t Timeouts) error {
+	err := SetTimeouts(sr, t)
+	if err != nil {
+		sr.Close()
+	}
+
+	return err
+}
+
+// withPhrases sets the phrases of sr, it is closed if failed.
+func withPhrases(sr SpeechRecognition, phrases []string) error {
+	err := SetPhrases(sr, phrases)
+	if err != nil {
+		sr.Close()
+	}
+
+	return err
+}
+
+func (p Params) espeakVoice() string {
+	if p.EspeakVoice != "" || p.Language == "" {
+		return p.EspeakVoice
+	}
+
+	return EspeakVoiceForLanguage(p.Language)
+}
+
+// NewWakeWordDetectorFromParams creates the detector of Keyword by the engine in params.
+func NewWakeWordDetectorFromParams(p Params) (WakeWordDetector, error) {
+	switch p.WakeWordEngine {
+	case "", AzureEngine:
+		return newKeywordRecognitionStandalone(p.SpeechKey, p.SpeechRegion, []string{p.KeywordLanguage}, DataPath(p.KeywordModel), p.Keyword, p.InputDevice)
+	case TranscriptionEngine:
+		p.Language = p.KeywordLanguage
+		sr, err := newSpeechRecognition(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = withTimeouts(sr, p.TimeoutsFor(p.KeywordLanguage)); err != nil {
+			return nil, err
+		}
+
+		if err = withPhrases(sr, []string{p.Keyword}); err != nil {
+			return nil, err
+		}
+
+		return NewTranscriptionWakeWordDetector(sr, p.Keyword), nil
+	}
+
+	return nil, fmt.Errorf("unknown wake word engine: %s", p.WakeWordEngine)
+}
@@ -0,0 +1,309 @@
+package hal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Microsoft/cognitive-services-speech-sdk-go/common"
+)
+
+var ErrEspeakNotFound = errors.New("espeak-ng binary not found")
+
+// EspeakSpeechSynthesisStream is an offline speech synthesis running espeak-ng (https://github.com/espeak-ng/espeak-ng)
+// as a subprocess. The audio from Result is a wav file (or raw PCM) split into chunks, resampled to the format,
+// and the word boundaries are estimated from the length of words, because espeak-ng doesn't report them.
+type EspeakSpeechSynthesisStream struct {
+	binary   string
+	voice    string
+	format   AudioFormat
+	play     bool
+	device   string // the output device played on, empty for the default one
+	result   *speechSynthesisResult
+	err      chan error
+	recorder *AudioRecorder
+}
+
+// NewEspeakSpeechSynthesisStream creates the speech synthesis outputs format, only PCM formats are supported.
+func NewEspeakSpeechSynthesisStream(binary, voice string, format AudioFormat) (*EspeakSpeechSynthesisStream, error) {
+	if !format.IsPCM() {
+		return nil, fmt.Errorf("%w: espeak-ng only outputs PCM, got %s", ErrUnsupportedAudioFormat, format.Name)
+	}
+
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrEspeakNotFound, err)
+	}
+
+	return &EspeakSpeechSynthesisStream{binary: path, voice: voice, format: format, result: newSpeechSynthesisResult()}, nil
+}
+
+// NewAutoDetectedEspeakSpeechSynthesisStream chooses the voice by the text, only chinese and english are detected.
+func NewAutoDetectedEspeakSpeechSynthesisStream(binary string, format AudioFormat) (*EspeakSpeechSynthesisStream, error) {
+	return NewEspeakSpeechSynthesisStream(binary, "", format)
+}
+
+func (s *EspeakSpeechSynthesisStream) TextToSpeech(text string) error {
+	s.err = make(chan error, 1)
+	go func() {
+		s.err <- s.synthesize(text)
+	}()
+
+	return nil
+}
+
+func (s *EspeakSpeechSynthesisStream) Result() (*WordBoundery, []byte, error) {
+	return s.result.Result()
+}
+
+func (s *EspeakSpeechSynthesisStream) Error() error {
+	select {
+	case err := <-s.err:
+		return err
+	case <-time.After(TIMEOUTS.synthesisDelay()):
+		return ErrSpeechSynthesisTimeout
+	}
+}
+
+// Format is the format of audio from Result.
+func (s *EspeakSpeechSynthesisStream) Format() AudioFormat {
+	return s.format
+}
+
+func (s *EspeakSpeechSynthesisStream) AudioDuration() time.Duration {
+	return s.result.duration
+}
+
+func (s *EspeakSpeechSynthesisStream) Record(r *AudioRecorder) {
+	s.recorder = r
+}
+
+func (s *EspeakSpeechSynthesisStream) Close() error {
+	return nil
+}
+
+func (s *EspeakSpeechSynthesisStream) synthesize(text string) error {
+	voice := s.voice
+	if voice == "" {
+		voice = detectEspeakVoice(text)
+	}
+
+	var stderr bytes.Buffer
+	// the text starting with "-" (e.g. a list item or a negative number) is not an option
+	cmd := exec.Command(s.binary, "--stdout", "-v", voice, "--", text)
+	cmd.Stderr = &stderr
+	wav, err := cmd.Output()
+	if err != nil {
+		err = fmt.Errorf("espeak-ng: %s: %s", err, strings.TrimSpace(stderr.String()))
+		tlog.Errorf(err.Error())
+		s.result.cancelled <- err
+		return err
+	}
+
+	format, data, err := ReadWav(bytes.NewReader(wav))
+	if err == nil {
+		data, err = NewPCMConverter(data, format, s.format.PCM)
+	}
+
+	if err != nil {
+		s.result.cancelled <- err
+		return err
+	}
+
+	pcm, _ := io.ReadAll(data)
+	wav, err = s.encode(pcm)
+	if err != nil {
+		s.result.cancelled <- err
+		return err
+	}
+
+	duration := float64(len(pcm)) * 1000 / float64(s.format.PCM.BytesPerSecond())
+	s.result.duration = time.Duration(duration * float64(time.Millisecond))
+	tlog.Debugf("Synthesized, audio length %d.", len(pcm))
+	if s.recorder != nil {
+		if err = s.recorder.WritePCM(s.format.PCM, pcm); err != nil {
+			tlog.Errorf("record speech: %s", err)
+		}
+	}
+
+	var player *exec.Cmd
+	if s.play {
+		player = alsaCommand("aplay", s.device, false, aplayArgs(s.format)...)
+		player.Stdin = bytes.NewReader(wav)
+		if err = player.Start(); err != nil {
+			s.result.cancelled <- err
+			return err
+		}
+	}
+
+	for _, w := range estimateWordBoundaries(text, duration) {
+		tlog.Debugf(w.String())
+		s.result.subtitles <- w
+	}
+
+	if player != nil {
+		if err = player.Wait(); err != nil {
+			s.result.cancelled <- err
+			return err
+		}
+	} else {
+		for chunk := 4096; len(wav) > 0; wav = wav[chunk:] {
+			if len(wav) < chunk {
+				chunk = len(wav)
+			}
+
+			s.result.audio <- wav[:chunk]
+		}
+	}
+
+	s.result.finished <- true
+	return nil
+}
+
+// encode adds the wav header to pcm if the format is riff.
+func (s *EspeakSpeechSynthesisStream) encode(pcm []byte) ([]byte, error) {
+	if s.format.Container == "raw" {
+		return pcm, nil
+	}
+
+	var buf bytes.Buffer
+	err := WriteWav(&buf, s.format.PCM, pcm)
+	return buf.Bytes(), err
+}
+
+// EspeakSpeechSynthesisStandalone plays the speech on the speaker (by aplay).
+type EspeakSpeechSynthesisStandalone struct {
+	EspeakSpeechSynthesisStream
+}
+
+func NewEspeakSpeechSynthesisStandalone(binary, voice string, format AudioFormat) (*EspeakSpeechSynthesisStandalone, error) {
+	if _, err := exec.LookPath("aplay"); err != nil {
+		return nil, err
+	}
+
+	s, err := NewEspeakSpeechSynthesisStream(binary, voice, format)
+	if err != nil {
+		return nil, err
+	}
+
+	s.play = true
+	return &EspeakSpeechSynthesisStandalone{EspeakSpeechSynthesisStream: *s}, nil
+}
+
+func NewAutoDetectedEspeakSpeechSynthesisStandalone(binary string, format AudioFormat) (*EspeakSpeechSynthesisStandalone, error) {
+	return NewEspeakSpeechSynthesisStandalone(binary, "", format)
+}
+
+// EspeakVoiceForLanguage converts the BCP-47 code to espeak-ng voice name.
+func EspeakVoiceForLanguage(language string) string {
+	l := strings.ToLower(language)
+	switch {
+	case l == "zh-hk" || strings.HasPrefix(l, "yue"):
+		return "yue"
+	case strings.HasPrefix(l, "zh"):
+		return "cmn"
+	case l == "en-gb" || l == "en-us":
+		return l
+	}
+
+	return strings.Split(l, "-")[0]
+}
+
+func detectEspeakVoice(text string) string {
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) {
+			return "cmn"
+		}
+	}
+
+	return "en"
+}
+
+// estimateWordBoundaries splits text to words (each han character is a word), and shares the duration (ms)
+// to them by their length, a pause between words takes the time as one character. The punctuations after a word
+// follow it at its end, as the punctuation boundaries of azure, so the subtitles break on the sentence ends.
+func estimateWordBoundaries(text string, duration float64) []*WordBoundery {
+	type word struct {
+		offset, length int
+		text           string
+		punctOffset    int
+		punct          []rune // the punctuations following the word
+	}
+
+	var words []word
+	var current []rune
+	var start, total int
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, word{offset: start, length: len(current), text: string(current)})
+			total += len(current)
+			current = current[:0]
+		}
+	}
+
+	offset := 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			start, current = offset, append(current, r)
+			flush()
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'':
+			if len(current) == 0 {
+				start = offset
+			}
+			current = append(current, r)
+		case unicode.IsPunct(r):
+			flush()
+			// the punctuations before any word (e.g. an opening quote) are not spoken
+			if n := len(words); n > 0 && words[n-1].offset+words[n-1].length+len(words[n-1].punct) == offset {
+				if len(words[n-1].punct) == 0 {
+					words[n-1].punctOffset = offset
+				}
+				words[n-1].punct = append(words[n-1].punct, r)
+			}
+		default:
+			flush()
+		}
+
+		offset++
+	}
+	flush()
+
+	if len(words) == 0 {
+		return nil
+	}
+
+	unit := duration / float64(total+len(words)-1)
+	res := make([]*WordBoundery, 0, len(words))
+	var pos float64
+	for _, w := range words {
+		res = append(res, &WordBoundery{
+			BounderyType: common.WordBoundary,
+			AudioOffset:  pos * unit,
+			Duration:     float64(w.length) * unit,
+			TextOffset:   uint(w.offset),
+			WordLength:   uint(w.length),
+			Text:         w.text,
+		})
+
+		if len(w.punct) > 0 {
+			res = append(res, &WordBoundery{
+				BounderyType: common.PunctuationBoundary,
+				AudioOffset:  (pos + float64(w.length)) * unit,
+				TextOffset:   uint(w.punctOffset),
+				WordLength:   uint(len(w.punct)),
+				Text:         string(w.punct),
+			})
+		}
+
+		pos += float64(w.length + 1)
+	}
+
+	return res
+}
@@ -0,0 +1,77 @@
+package hal
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Microsoft/cognitive-services-speech-sdk-go/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEspeakTextToSpeechStream(t *testing.T) {
+	ss, err := NewEspeakSpeechSynthesisStream(PARAMS.EspeakBinary, "en-us", EspeakAudioFormat)
+	if errors.Is(err, ErrEspeakNotFound) {
+		t.Skip(err)
+	}
+	assert.Nil(t, err)
+
+	var words []string
+	var size int
+	assert.Nil(t, ss.TextToSpeech("Does anyone hearing me?"))
+	word, audio, err := ss.Result()
+	for ; err == nil; word, audio, err = ss.Result() {
+		if word != nil {
+			words = append(words, word.Text)
+		}
+
+		size += len(audio)
+	}
+
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Nil(t, ss.Error())
+	assert.Equal(t, []string{"Does", "anyone", "hearing", "me"}, words)
+	assert.Greater(t, size, 44)
+
+	assert.Nil(t, ss.Close())
+}
+
+func TestEstimateWordBoundaries(t *testing.T) {
+	words := estimateWordBoundaries("Hi, you!", 600)
+	assert.Equal(t, 4, len(words))
+	assert.Equal(t, "Hi", words[0].Text)
+	assert.Equal(t, 0.0, words[0].AudioOffset)
+	assert.Equal(t, 200.0, words[0].Duration)
+	assert.Equal(t, common.PunctuationBoundary, words[1].BounderyType)
+	assert.Equal(t, ",", words[1].Text)
+	assert.Equal(t, 200.0, words[1].AudioOffset)
+	assert.Equal(t, "you", words[2].Text)
+	assert.Equal(t, uint(4), words[2].TextOffset)
+	assert.Equal(t, 300.0, words[2].AudioOffset)
+	assert.Equal(t, 300.0, words[2].Duration)
+	assert.Equal(t, "!", words[3].Text)
+	assert.Equal(t, uint(7), words[3].TextOffset)
+
+	// the subtitles break on the sentence ends
+	subtitles := NewSubtitles()
+	for _, w := range estimateWordBoundaries("Hello there. How are you?", 2000) {
+		subtitles.Add(w)
+	}
+	subtitles.EndSpeech(0)
+	assert.Equal(t, 2, len(subtitles.Cues()))
+	assert.Equal(t, "Hello there.", subtitles.Cues()[0].Text)
+
+	words = estimateWordBoundaries("你好 HAL", 1000)
+	assert.Equal(t, 3, len(words))
+	assert.Equal(t, "好", words[1].Text)
+	assert.Equal(t, uint(3), words[2].TextOffset)
+
+	assert.Nil(t, estimateWordBoundaries("...", 100))
+}
+
+func TestEspeakVoiceForLanguage(t *testing.T) {
+	assert.Equal(t, "en-us", EspeakVoiceForLanguage("en-US"))
+	assert.Equal(t, "cmn", EspeakVoiceForLanguage("zh-CN"))
+	assert.Equal(t, "yue", EspeakVoiceForLanguage("zh-HK"))
+	assert.Equal(t, "fr", EspeakVoiceForLanguage("fr-FR"))
+}
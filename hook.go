@@ -154,19 +154,10 @@ func (h *Hooks) SaveHooks(file string) error {
 		return err
 	}
 
-	f, err := os.Create(file)
-	if err != nil {
-		return err
-	}
-
-	defer f.Close()
-	writer := bufio.NewWriter(f)
-	_, err = writer.Write(json)
-	if err != nil {
+	if err = writeFileAtomic(file, json); err != nil {
 		return err
 	}
 
 	tlog.Debugf("save hooks succeeded.")
-
-	return writer.Flush()
+	return nil
 }
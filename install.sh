@@ -40,18 +40,36 @@ installSpeechSDK () {
 }
 
 HAL_ROOT="$HOME/HAL/go"
+HAL_CONFIG="${XDG_CONFIG_HOME:-$HOME/.config}/hal"
+HAL_DATA="${XDG_DATA_HOME:-$HOME/.local/share}/hal"
 installHAL () {
     echo "Install HAL into ${HAL_ROOT}"
     go build cli/hal.go
+    mkdir -p "$HAL_CONFIG" "$HAL_DATA"
+    chmod 700 "$HAL_CONFIG" "$HAL_DATA"
     if [ -d $HAL_ROOT ]; then
         echo "old HAL found, and remove it."
-        rm -rf $HAL_ROOT
+        # the config and data of old HAL are kept
+        for f in params.json sessions.json hooks.json secrets.json; do
+            if [ -f "$HAL_ROOT/$f" ] && [ ! -f "$HAL_CONFIG/$f" ]; then
+                mv "$HAL_ROOT/$f" "$HAL_CONFIG"
+            fi
+        done
+        for d in transcripts cache model; do
+            if [ -e "$HAL_ROOT/$d" ] && [ ! -e "$HAL_DATA/$d" ]; then
+                mv "$HAL_ROOT/$d" "$HAL_DATA"
+            elif [ -e "$HAL_ROOT/$d" ]; then
+                echo "$HAL_ROOT/$d is kept, as $HAL_DATA/$d exists."
+            fi
+        done
+        find "$HAL_ROOT" -mindepth 1 -maxdepth 1 ! -name transcripts ! -name cache ! -name model -exec rm -rf {} +
     fi
 
     mkdir -p ${HAL_ROOT}
     cp hal ${HAL_ROOT}
-    cp params.json hooks.json ${HAL_ROOT}
-    cp -R ./model ${HAL_ROOT}
+    [ -f "$HAL_CONFIG/params.json" ] || cp params.json "$HAL_CONFIG"
+    [ -f "$HAL_CONFIG/hooks.json" ] || cp hooks.json "$HAL_CONFIG"
+    cp -R ./model "$HAL_DATA"
 
 
     existExport=$(grep HAL_ROOT $HOME/.profile)
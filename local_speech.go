@@ -0,0 +1,370 @@
+package hal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// errNoSpeech is sent by the frame pump if no speech is detected in InitialSilenceTimeoutMs.
+var errNoSpeech = errors.New("no speech heard")
+
+// LocalSpeechRecognition recognizes the speech from microphone captured by HAL, the frames captured are pushed to
+// the speech recognition of pushed audio (e.g. SpeechRecognitionStream), so the audio heard can be recorded.
+//
+// If VAD is set, only the speech detected is pushed, and an utterance is not started to recognize until the
+// speech is heard, so the silence doesn't use the speech service.
+type LocalSpeechRecognition struct {
+	VAD *VoiceActivityDetector // nil to push all the audio
+
+	sr      SpeechRecognition
+	capture AudioCapture
+	pushing chan struct{} // closed when the frames captured are all pushed
+	heard   chan error    // nil when the speech is heard and started to recognize, or errNoSpeech
+	speechTimeouts
+}
+
+// NewLocalSpeechRecognition creates the speech recognition pushing the frames of capture (in DefaultPCMFormat)
+// to sr.
+func NewLocalSpeechRecognition(sr SpeechRecognition, capture AudioCapture) *LocalSpeechRecognition {
+	return &LocalSpeechRecognition{sr: sr, capture: capture}
+}
+
+// Start starts to recognize an utterance from microphone, after the speech is detected if VAD is set.
+func (s *LocalSpeechRecognition) Start() error {
+	if s.VAD != nil {
+		s.resetVAD()
+		s.heard = make(chan error, 1)
+		return s.startCapture(true)
+	}
+
+	if err := s.sr.Start(); err != nil {
+		return err
+	}
+
+	return s.startCapture(false)
+}
+
+// SpeechToText pushes the audio besides the microphone.
+func (s *LocalSpeechRecognition) SpeechToText(data []byte) error {
+	return s.sr.SpeechToText(data)
+}
+
+// Result returns the utterance recognized, the microphone is stopped capturing until the next Start. The result is
+// empty if VAD is set and nothing is heard in InitialSilenceTimeoutMs.
+func (s *LocalSpeechRecognition) Result() (RecognitionResult, error) {
+	if s.heard != nil {
+		var err error
+		select {
+		case err = <-s.heard:
+		case <-time.After(s.timeouts().recognitionDelay()):
+			err = ErrSpeechRecognitionTimeout
+		}
+
+		s.heard = nil
+		if err != nil {
+			stopErr := s.stopCapture()
+			if errors.Is(err, errNoSpeech) {
+				return RecognitionResult{}, stopErr
+			}
+
+			return RecognitionResult{}, err
+		}
+	}
+
+	res, err := s.sr.Result()
+	if stopErr := s.stopCapture(); err == nil {
+		err = stopErr
+	}
+
+	return res, err
+}
+
+// StartContinuous recognizes the speech from microphone continuously until StopContinuous.
+func (s *LocalSpeechRecognition) StartContinuous() error {
+	c, err := s.continuous()
+	if err != nil {
+		return err
+	}
+
+	if err = c.StartContinuous(); err != nil {
+		return err
+	}
+
+	if s.VAD != nil {
+		s.resetVAD()
+	}
+
+	return s.startCapture(false)
+}
+
+// CloseStream does nothing, the continuous recognition from microphone ends by StopContinuous.
+func (s *LocalSpeechRecognition) CloseStream() error {
+	return nil
+}
+
+func (s *LocalSpeechRecognition) Recognized() <-chan RecognitionResult {
+	c, err := s.continuous()
+	if err != nil {
+		return nil
+	}
+
+	return c.Recognized()
+}
+
+func (s *LocalSpeechRecognition) StopContinuous() error {
+	c, err := s.continuous()
+	if err != nil {
+		return err
+	}
+
+	err = s.stopCapture()
+	if stopErr := c.StopContinuous(); err == nil {
+		err = stopErr
+	}
+
+	return err
+}
+
+// Record saves the audio heard if the speech recognition of pushed audio can record it.
+func (s *LocalSpeechRecognition) Record(r *AudioRecorder) {
+	Record(s.sr, r)
+}
+
+func (s *LocalSpeechRecognition) SetPhrases(phrases []string) error {
+	return SetPhrases(s.sr, phrases)
+}
+
+// SetTimeouts sets the timeouts of the speech recognition of pushed audio as well.
+func (s *LocalSpeechRecognition) SetTimeouts(t Timeouts) error {
+	s.speechTimeouts.SetTimeouts(t)
+	return SetTimeouts(s.sr, t)
+}
+
+func (s *LocalSpeechRecognition) Close() error {
+	err := s.stopCapture()
+	if closeErr := s.sr.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// resetVAD forgets the speech detected, the utterances are ended by the segmentation silence of the timeouts.
+func (s *LocalSpeechRecognition) resetVAD() {
+	s.VAD.Reset()
+	s.VAD.Silence = time.Duration(s.timeouts().SegmentationSilenceTimeoutMs) * time.Millisecond
+}
+
+func (s *LocalSpeechRecognition) continuous() (ContinuousSpeechRecognition, error) {
+	c, ok := s.sr.(ContinuousSpeechRecognition)
+	if !ok {
+		return nil, errors.New("speech recognition not support continuous recognition")
+	}
+
+	return c, nil
+}
+
+// startCapture pushes the frames captured until stopCapture. For an utterance (once), the speech recognition is
+// started when the speech is detected, and the frames after the utterance are dropped.
+func (s *LocalSpeechRecognition) startCapture(once bool) error {
+	if s.pushing != nil {
+		return nil
+	}
+
+	frames, err := s.capture.Start()
+	if err != nil {
+		return err
+	}
+
+	pushing := make(chan struct{})
+	s.pushing = pushing
+	initial := time.Duration(s.timeouts().InitialSilenceTimeoutMs) * time.Millisecond
+	go func(heard chan error) {
+		defer close(pushing)
+		var started, ended bool
+		var elapsed time.Duration
+		for frame := range frames {
+			if ended {
+				continue
+			}
+
+			audio, speech := frame, false
+			if s.VAD != nil {
+				audio, speech = s.VAD.Gate(frame)
+			}
+
+			if once && !started {
+				elapsed += pcmDuration(frame)
+				switch {
+				case speech:
+					err := s.sr.Start()
+					heard <- err
+					started, ended = true, err != nil
+				case elapsed >= initial:
+					heard <- errNoSpeech
+					ended = true
+				}
+
+				if !started {
+					continue
+				}
+			}
+
+			if len(audio) > 0 {
+				if err := s.sr.SpeechToText(audio); err != nil {
+					tlog.Errorf("push audio: %s", err)
+				}
+			}
+
+			ended = ended || (once && !s.VAD.Utterance())
+		}
+
+		// the capture failed before the speech
+		if once && !started && !ended {
+			heard <- errNoSpeech
+		}
+	}(s.heard)
+
+	return nil
+}
+
+func (s *LocalSpeechRecognition) stopCapture() error {
+	if s.pushing == nil {
+		return nil
+	}
+
+	err := s.capture.Stop()
+	<-s.pushing
+	s.pushing = nil
+	return err
+}
+
+// LocalSpeechSynthesis plays the audio from the speech synthesis outputs audio by Result (e.g.
+// SpeechSynthesisStream) on the speaker by AudioOutput, the audio is played while it is synthesizing.
+type LocalSpeechSynthesis struct {
+	Device string           // the output device, empty for the default one
+	Echo   *EchoSuppression // the capture hearing the audio played, nil for no suppression
+
+	ss        SpeechSynthesis
+	format    AudioFormat
+	newOutput func(AudioFormat) (io.WriteCloser, error)
+	output    io.WriteCloser
+	err       error
+}
+
+// NewLocalSpeechSynthesis creates the speech synthesis playing the audio of ss in format, only PCM and MP3 can
+// be played (see CanPlay).
+func NewLocalSpeechSynthesis(ss SpeechSynthesis, format AudioFormat) (*LocalSpeechSynthesis, error) {
+	if !CanPlay(format) {
+		return nil, fmt.Errorf("%w: %s can't be played", ErrUnsupportedAudioFormat, format.Name)
+	}
+
+	s := &LocalSpeechSynthesis{ss: ss, format: format}
+	s.newOutput = func(format AudioFormat) (io.WriteCloser, error) {
+		return NewAudioOutput(format, s.Device, s.Echo)
+	}
+
+	return s, nil
+}
+
+func (s *LocalSpeechSynthesis) TextToSpeech(text string) error {
+	return s.speak(func() error {
+		return s.ss.TextToSpeech(text)
+	})
+}
+
+// SSMLToSpeech speaks ssml if the wrapped speech synthesis can.
+func (s *LocalSpeechSynthesis) SSMLToSpeech(ssml string) error {
+	ss, ok := s.ss.(SSMLSpeechSynthesis)
+	if !ok {
+		return errors.New("speech synthesis can't speak SSML")
+	}
+
+	return s.speak(func() error {
+		return ss.SSMLToSpeech(ssml)
+	})
+}
+
+// VoiceName is the voice of the wrapped speech synthesis, empty if it can't speak SSML.
+func (s *LocalSpeechSynthesis) VoiceName() string {
+	if ss, ok := s.ss.(SSMLSpeechSynthesis); ok {
+		return ss.VoiceName()
+	}
+
+	return ""
+}
+
+func (s *LocalSpeechSynthesis) speak(synthesize func() error) error {
+	output, err := s.newOutput(s.format)
+	if err != nil {
+		return err
+	}
+
+	if err = synthesize(); err != nil {
+		output.Close()
+		return err
+	}
+
+	s.output, s.err = output, nil
+	return nil
+}
+
+// Result returns the word boundaries, the audio is played but not returned. It returns io.EOF after the audio
+// is played.
+func (s *LocalSpeechSynthesis) Result() (*WordBoundery, []byte, error) {
+	for {
+		w, audio, err := s.ss.Result()
+		if len(audio) > 0 && s.output != nil && s.err == nil {
+			if _, s.err = s.output.Write(audio); s.err != nil {
+				tlog.Errorf("play speech: %s", s.err)
+			}
+		}
+
+		// the audio is played to the end, or dropped if failed
+		if err != nil && s.output != nil {
+			if closeErr := s.output.Close(); errors.Is(err, io.EOF) && s.err == nil {
+				s.err = closeErr
+			}
+
+			s.output = nil
+		}
+
+		if w != nil || err != nil {
+			return w, nil, err
+		}
+	}
+}
+
+// Error returns the error of synthesis or playing.
+func (s *LocalSpeechSynthesis) Error() error {
+	if err := s.ss.Error(); err != nil {
+		return err
+	}
+
+	return s.err
+}
+
+// Format is the format of audio played.
+func (s *LocalSpeechSynthesis) Format() AudioFormat {
+	return s.format
+}
+
+func (s *LocalSpeechSynthesis) AudioDuration() time.Duration {
+	return SpeechDuration(s.ss)
+}
+
+// Record saves the audio played if the wrapped speech synthesis can record it.
+func (s *LocalSpeechSynthesis) Record(r *AudioRecorder) {
+	Record(s.ss, r)
+}
+
+func (s *LocalSpeechSynthesis) Close() error {
+	if s.output != nil {
+		s.output.Close()
+		s.output = nil
+	}
+
+	return s.ss.Close()
+}
@@ -0,0 +1,172 @@
+package hal
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAudioCapture sends the frames once started.
+type fakeAudioCapture struct {
+	frames  []string
+	started int
+	stopped int
+}
+
+func (f *fakeAudioCapture) Start() (<-chan []byte, error) {
+	f.started++
+	frames := make(chan []byte, len(f.frames))
+	for _, frame := range f.frames {
+		frames <- []byte(frame)
+	}
+
+	close(frames)
+	return frames, nil
+}
+
+func (f *fakeAudioCapture) Stop() error {
+	f.stopped++
+	return nil
+}
+
+// fakePushSpeechRecognition recognizes the audio pushed as text, Result waits for the audio of want.
+type fakePushSpeechRecognition struct {
+	mu     sync.Mutex
+	pushed bytes.Buffer
+	want   string
+	starts int
+}
+
+func (f *fakePushSpeechRecognition) Start() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pushed.Reset()
+	f.starts++
+	return nil
+}
+
+func (f *fakePushSpeechRecognition) SpeechToText(data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pushed.Write(data)
+	return nil
+}
+
+func (f *fakePushSpeechRecognition) Result() (RecognitionResult, error) {
+	for i := 0; i < 100; i++ {
+		f.mu.Lock()
+		text := f.pushed.String()
+		f.mu.Unlock()
+		if strings.Contains(text, f.want) {
+			return RecognitionResult{Text: f.want}, nil
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	return RecognitionResult{}, ErrSpeechRecognitionTimeout
+}
+
+func (f *fakePushSpeechRecognition) Close() error {
+	return nil
+}
+
+func TestLocalSpeechRecognition(t *testing.T) {
+	capture := &fakeAudioCapture{frames: []string{"hel", "lo"}}
+	sr := NewLocalSpeechRecognition(&fakePushSpeechRecognition{want: "hello"}, capture)
+
+	for i := 1; i <= 2; i++ {
+		assert.Nil(t, sr.Start())
+		res, err := sr.Result()
+		assert.Nil(t, err)
+		assert.Equal(t, "hello", res.Text)
+		assert.Equal(t, i, capture.started)
+		assert.Equal(t, i, capture.stopped)
+	}
+
+	assert.Nil(t, sr.Close())
+	assert.Equal(t, 2, capture.stopped)
+}
+
+func TestLocalSpeechRecognitionVAD(t *testing.T) {
+	speech := string(toneFrame(3000))
+	capture := &fakeAudioCapture{}
+	for i := 0; i < 10; i++ {
+		capture.frames = append(capture.frames, string(make([]byte, len(speech))))
+	}
+
+	fake := &fakePushSpeechRecognition{want: speech}
+	sr := NewLocalSpeechRecognition(fake, capture)
+	sr.VAD = NewVoiceActivityDetector(DefaultVADSensitivity)
+
+	// nothing heard
+	timeouts := DefaultTimeouts
+	timeouts.InitialSilenceTimeoutMs, timeouts.SegmentationSilenceTimeoutMs = 150, 300
+	assert.Nil(t, sr.SetTimeouts(timeouts))
+	assert.Nil(t, sr.Start())
+	assert.Equal(t, 300*time.Millisecond, sr.VAD.Silence)
+	res, err := sr.Result()
+	assert.Nil(t, err)
+	assert.Empty(t, res.Text)
+	assert.Equal(t, 0, fake.starts)
+	assert.Equal(t, 0, fake.pushed.Len())
+
+	// the speech after silence
+	capture.frames = append(capture.frames[:3], speech, speech)
+	assert.Nil(t, sr.Start())
+	res, err = sr.Result()
+	assert.Nil(t, err)
+	assert.Equal(t, speech, res.Text)
+	assert.Equal(t, 1, fake.starts)
+	assert.Nil(t, sr.Close())
+}
+
+// fakeAudioOutput keeps the audio written.
+type fakeAudioOutput struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (f *fakeAudioOutput) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestLocalSpeechSynthesis(t *testing.T) {
+	var outputs []*fakeAudioOutput
+	ss := &LocalSpeechSynthesis{ss: newFakeStreamSpeechSynthesis(), format: DefaultAudioFormat,
+		newOutput: func(AudioFormat) (io.WriteCloser, error) {
+			o := &fakeAudioOutput{}
+			outputs = append(outputs, o)
+			return o, nil
+		}}
+
+	for _, text := range []string{"hello", "world"} {
+		assert.Nil(t, ss.TextToSpeech(text))
+		w, audio, err := ss.Result()
+		assert.Nil(t, err)
+		assert.Equal(t, text, w.Text)
+		assert.Empty(t, audio)
+
+		_, _, err = ss.Result()
+		assert.Equal(t, io.EOF, err)
+		assert.Nil(t, ss.Error())
+	}
+
+	if assert.Len(t, outputs, 2) {
+		assert.Equal(t, "hello", outputs[0].String())
+		assert.Equal(t, "world", outputs[1].String())
+		assert.True(t, outputs[0].closed)
+		assert.True(t, outputs[1].closed)
+	}
+
+	assert.NotNil(t, ss.TextToSpeech("fail"))
+	assert.Len(t, outputs, 3)
+	assert.True(t, outputs[2].closed)
+	assert.Nil(t, ss.Close())
+}
@@ -0,0 +1,310 @@
+package hal
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SpeechNormalizer converts the text to what is spoken in the language: the URLs are read as their domains,
+// the emoji are dropped, and the numbers, dates and list items are read as words in english and chinese.
+// The other languages are left to the speech synthesis.
+type SpeechNormalizer struct {
+	Language string // BCP-47 code, e.g. en-US
+}
+
+func NewSpeechNormalizer(language string) *SpeechNormalizer {
+	return &SpeechNormalizer{Language: language}
+}
+
+var (
+	urlPattern     = regexp.MustCompile(`(?:https?://(?:www\.)?|www\.)([\w-]+(?:\.[\w-]+)+)(?:[/?#:][^\s<>"'()\[\]]*[^\s<>"'()\[\].,;:!?])?`)
+	datePattern    = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+	percentPattern = regexp.MustCompile(`(\d+(?:\.\d+)?)\s?%`)
+	dollarPattern  = regexp.MustCompile(`\$(\d+(?:,\d{3})*)(\.\d+)?`)
+	ordinalPattern = regexp.MustCompile(`\b(\d+(?:,\d{3})*)(?:st|nd|rd|th)\b`)
+	spacePattern   = regexp.MustCompile(`\s+([,.;:!?，。；：！？])`)
+	numberPattern  = regexp.MustCompile(`\b\d+(?:,\d{3})*(?:\.\d+)*`)
+	yearPattern    = regexp.MustCompile(`\b(\d{4})年`)
+)
+
+// Normalize returns the text to speak, it may be empty if nothing is speakable.
+func (n *SpeechNormalizer) Normalize(text string) string {
+	text = urlPattern.ReplaceAllString(text, "$1")
+	text = strings.Map(func(r rune) rune {
+		if isEmoji(r) {
+			return -1
+		}
+
+		return r
+	}, text)
+
+	switch n.lang() {
+	case "en":
+		text = n.english(text)
+	case "zh":
+		text = n.chinese(text)
+	}
+
+	// the spaces before the punctuation dropped with emoji
+	text = spacePattern.ReplaceAllString(text, "$1")
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// ListItem returns the words introduce the nth item of an ordered list.
+func (n *SpeechNormalizer) ListItem(number int) string {
+	switch n.lang() {
+	case "en":
+		return "Item " + englishNumber(int64(number)) + ": "
+	case "zh":
+		return "第" + chineseNumber(int64(number)) + "项："
+	}
+
+	return strconv.Itoa(number) + ": "
+}
+
+func (n *SpeechNormalizer) lang() string {
+	return strings.ToLower(strings.Split(n.Language, "-")[0])
+}
+
+func (n *SpeechNormalizer) english(text string) string {
+	text = datePattern.ReplaceAllStringFunc(text, func(date string) string {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return date
+		}
+
+		return t.Month().String() + " " + englishOrdinal(int64(t.Day())) + ", " + englishYear(t.Year())
+	})
+	text = percentPattern.ReplaceAllString(text, "$1 percent")
+	text = dollarPattern.ReplaceAllStringFunc(text, englishDollars)
+	text = ordinalPattern.ReplaceAllStringFunc(text, func(ordinal string) string {
+		n, err := strconv.ParseInt(strings.ReplaceAll(ordinalPattern.FindStringSubmatch(ordinal)[1], ",", ""), 10, 64)
+		if err != nil || n >= 1e12 {
+			return ordinal
+		}
+
+		return englishOrdinal(n)
+	})
+	text = strings.ReplaceAll(text, " & ", " and ")
+	return replaceNumbers(text, englishNumber, " point ", readEnglishDigits)
+}
+
+func (n *SpeechNormalizer) chinese(text string) string {
+	text = datePattern.ReplaceAllStringFunc(text, func(date string) string {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return date
+		}
+
+		return readChineseDigits(strconv.Itoa(t.Year())) + "年" + chineseNumber(int64(t.Month())) + "月" + chineseNumber(int64(t.Day())) + "日"
+	})
+	text = percentPattern.ReplaceAllString(text, "百分之$1")
+	// the years are read digit by digit
+	text = yearPattern.ReplaceAllStringFunc(text, func(year string) string {
+		return readChineseDigits(strings.TrimSuffix(year, "年")) + "年"
+	})
+	return replaceNumbers(text, chineseNumber, "点", readChineseDigits)
+}
+
+// replaceNumbers reads the numbers as words, the fraction is read digit by digit. The numbers have more than
+// one point (e.g. version 1.2.3) are left.
+func replaceNumbers(text string, integer func(int64) string, point string, digits func(string) string) string {
+	return numberPattern.ReplaceAllStringFunc(text, func(number string) string {
+		parts := strings.Split(strings.ReplaceAll(number, ",", ""), ".")
+		if len(parts) > 2 {
+			return number
+		}
+
+		i, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || i >= 1e12 {
+			return number
+		}
+
+		res := integer(i)
+		if len(parts) == 2 {
+			res += point + digits(parts[1])
+		}
+
+		return res
+	})
+}
+
+var englishOnes = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten",
+	"eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen"}
+
+var englishTens = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+
+func englishNumber(n int64) string {
+	switch {
+	case n < 20:
+		return englishOnes[n]
+	case n < 100:
+		if n%10 == 0 {
+			return englishTens[n/10]
+		}
+
+		return englishTens[n/10] + "-" + englishOnes[n%10]
+	case n < 1000:
+		return joinNumber(englishOnes[n/100]+" hundred", n%100, " ", englishNumber)
+	}
+
+	for _, scale := range []struct {
+		value int64
+		name  string
+	}{{1e9, " billion"}, {1e6, " million"}, {1e3, " thousand"}} {
+		if n >= scale.value {
+			return joinNumber(englishNumber(n/scale.value)+scale.name, n%scale.value, " ", englishNumber)
+		}
+	}
+
+	return strconv.FormatInt(n, 10)
+}
+
+func joinNumber(high string, low int64, sep string, number func(int64) string) string {
+	if low == 0 {
+		return high
+	}
+
+	return high + sep + number(low)
+}
+
+func englishOrdinal(n int64) string {
+	words := englishNumber(n)
+	irregular := map[string]string{"one": "first", "two": "second", "three": "third", "five": "fifth",
+		"eight": "eighth", "nine": "ninth", "twelve": "twelfth"}
+	i := strings.LastIndexAny(words, " -") + 1
+	last := words[i:]
+	switch {
+	case irregular[last] != "":
+		last = irregular[last]
+	case strings.HasSuffix(last, "y"):
+		last = strings.TrimSuffix(last, "y") + "ieth"
+	default:
+		last += "th"
+	}
+
+	return words[:i] + last
+}
+
+// englishDollars reads the amount of dollars with its cents, e.g. twelve dollars and fifty cents. The other
+// fractions are read as numbers, e.g. one point two five five dollars.
+func englishDollars(amount string) string {
+	match := dollarPattern.FindStringSubmatch(amount)
+	dollars, err := strconv.ParseInt(strings.ReplaceAll(match[1], ",", ""), 10, 64)
+	if err != nil || dollars >= 1e12 || (match[2] != "" && len(match[2]) != 3) {
+		return match[1] + match[2] + " dollars"
+	}
+
+	var cents int64
+	if match[2] != "" {
+		cents, _ = strconv.ParseInt(match[2][1:], 10, 64)
+	}
+
+	unit := func(n int64, name string) string {
+		if n == 1 {
+			return "one " + name
+		}
+
+		return englishNumber(n) + " " + name + "s"
+	}
+
+	switch {
+	case cents == 0:
+		return unit(dollars, "dollar")
+	case dollars == 0:
+		return unit(cents, "cent")
+	}
+
+	return unit(dollars, "dollar") + " and " + unit(cents, "cent")
+}
+
+// englishYear reads the year in pairs, e.g. nineteen eighty-four, twenty twenty-six.
+func englishYear(year int) string {
+	if year < 1100 || year >= 10000 || year%1000 < 10 {
+		return englishNumber(int64(year))
+	}
+
+	if year%100 == 0 {
+		return englishNumber(int64(year/100)) + " hundred"
+	}
+
+	low := englishNumber(int64(year % 100))
+	if year%100 < 10 {
+		low = "oh " + low
+	}
+
+	return englishNumber(int64(year/100)) + " " + low
+}
+
+func readEnglishDigits(digits string) string {
+	var words []string
+	for _, d := range digits {
+		words = append(words, englishOnes[d-'0'])
+	}
+
+	return strings.Join(words, " ")
+}
+
+var chineseDigitNames = []rune("零一二三四五六七八九")
+
+func readChineseDigits(digits string) string {
+	var b strings.Builder
+	for _, d := range digits {
+		b.WriteRune(chineseDigitNames[d-'0'])
+	}
+
+	return b.String()
+}
+
+func chineseNumber(n int64) string {
+	if n < 10 {
+		return string(chineseDigitNames[n])
+	}
+
+	if n < 20 {
+		return "十" + strings.TrimPrefix(string(chineseDigitNames[n%10]), "零")
+	}
+
+	for _, unit := range []struct {
+		value int64
+		name  string
+	}{{1e8, "亿"}, {1e4, "万"}, {1e3, "千"}, {100, "百"}, {10, "十"}} {
+		if n < unit.value {
+			continue
+		}
+
+		high := chineseNumber(n / unit.value)
+		if unit.value == 10 {
+			high = string(chineseDigitNames[n/10])
+		}
+
+		low := n % unit.value
+		if low == 0 {
+			return high + unit.name
+		}
+
+		words := chineseNumber(low)
+		if low >= 10 && low < 20 {
+			// e.g. 一百一十五
+			words = "一" + words
+		}
+
+		if low < unit.value/10 {
+			// e.g. 一百零五
+			words = "零" + words
+		}
+
+		return high + unit.name + words
+	}
+
+	return strconv.FormatInt(n, 10)
+}
+
+// isEmoji reports whether r is an emoji or the joiner and variation selector of them.
+func isEmoji(r rune) bool {
+	return (r >= 0x1F300 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF) || (r >= 0x1F000 && r <= 0x1F2FF) ||
+		r == 0x200D || r == 0xFE0F || (unicode.Is(unicode.So, r) && r > 0x2000)
+}
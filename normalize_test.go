@@ -0,0 +1,45 @@
+package hal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpeechNormalizerEnglish(t *testing.T) {
+	n := NewSpeechNormalizer("en-US")
+	for text, expected := range map[string]string{
+		"See https://github.com/foo/bar, or www.golang.org.": "See github.com, or golang.org.",
+		"It costs $12.50 👍, about 15% off.":                  "It costs twelve dollars and fifty cents, about fifteen percent off.",
+		"Pay $1 or $0.05, not $1,200.00 or $2.125.":          "Pay one dollar or five cents, not one thousand two hundred dollars or two point one two five dollars.",
+		"The 3rd and 21st of 100th tries.":                   "The third and twenty-first of one hundredth tries.",
+		"Released on 2023-03-01 & 2008-11-10.":               "Released on March first, twenty twenty-three and November tenth, two thousand eight.",
+		"There are 1,234,567 users on go 1.20.3.":            "There are one million two hundred thirty-four thousand five hundred sixty-seven users on go 1.20.3.",
+		"HAL 9000 uses mp3 at 44 kHz.":                       "HAL nine thousand uses mp3 at forty-four kHz.",
+		"🎉🚀":                                                 "",
+	} {
+		assert.Equal(t, expected, n.Normalize(text), text)
+	}
+
+	assert.Equal(t, "Item twenty-one: ", n.ListItem(21))
+}
+
+func TestSpeechNormalizerChinese(t *testing.T) {
+	n := NewSpeechNormalizer("zh-CN")
+	for text, expected := range map[string]string{
+		"会议在2023-03-01举行。":    "会议在二零二三年三月一日举行。",
+		"2008年有105人，增长了12%。":  "二零零八年有一百零五人，增长了百分之十二。",
+		"圆周率是3.14，共1015页。":    "圆周率是三点一四，共一千零一十五页。",
+		"访问 https://go.dev 😀": "访问 go.dev",
+	} {
+		assert.Equal(t, expected, n.Normalize(text), text)
+	}
+
+	assert.Equal(t, "第十二项：", n.ListItem(12))
+}
+
+func TestSpeechNormalizerOtherLanguage(t *testing.T) {
+	n := NewSpeechNormalizer("fr-FR")
+	assert.Equal(t, "Voir example.com, 2023-03-01 à 15 h", n.Normalize("Voir http://example.com/a, 2023-03-01 à 15 h ✨"))
+	assert.Equal(t, "3: ", n.ListItem(3))
+}
@@ -3,26 +3,83 @@ package hal
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
+	"strings"
+	"time"
 )
 
 type Params struct {
-	Initialized  bool
-	OpenaiKey    string
-	ChatgptModel string
-	MaxHistory   int
+	Initialized   bool
+	OpenaiKey     string // the credential openai if kept by SecretStore, or in params
+	OpenaiBaseURL string // the API of openai, e.g. a proxy of the company, empty for api.openai.com
+	ChatgptModel  string
+	MaxHistory    int
+	SecretStore   string // file (default, in KeyFile) or keyring (the secret service by secret-tool) keeps the credentials
+	KeyFile       string // the credentials (name to secret) are kept in, accessible by the owner only (0600)
 
-	SpeechKey       string
-	SpeechRegion    string
+	SpeechKey       string // the credential azure-speech-key if kept by SecretStore, or in params
+	SpeechRegion    string // the credential azure-speech-region if kept by SecretStore, or in params
 	Language        string // BCP-47 code
 	Voice           string
+	Voices          map[string]string // BCP-47 code to the voice replying in the language
 	StopWord        string
 	Keyword         string
 	KeywordModel    string
 	KeywordLanguage string
+	WakeWordEngine  string // azure (default, need KeywordModel) or transcription (by RecognitionEngine)
+
+	RecognitionEngine string // azure (default) or whisper
+	WhisperBinary     string
+	WhisperModel      string
+
+	AudioIO        string  // hal (default if arecord and aplay are found) captures and plays the audio by HAL, or azure by the speech SDK
+	VADSensitivity float64 // 0 to 1, the higher the quieter speech is detected, 0 to push all the audio heard by HAL to azure
+
+	HalfDuplex       bool // the microphone of HAL audio is muted while HAL is speaking, so it doesn't hear itself
+	EchoCancellation bool // the speech of HAL (in PCM) is cancelled from the microphone of HAL audio
+	EchoTailMs       int  // the echo lasting after the speech (by the latency of speaker and the room), muted, or cancelled up to 64ms
+
+	SynthesisEngine    string // azure (default) or espeak
+	EspeakBinary       string
+	EspeakVoice        string // empty for the voice of Language
+	SynthesisFormat    string // the output format, e.g. riff-24khz-16bit-mono-pcm, empty for the default of engine
+	SynthesisLookahead int    // the segments of answer synthesized ahead of the one playing, 0 to speak one by one
+	MinSegmentLength   int    // the characters of a segment of answer at least, the shorter sentence is merged with the next
+	MaxSegmentLength   int    // the characters of a segment of answer at most, 0 for no limit
+	CodeBlockSpeech    string // spoken instead of a code block of answer, empty to skip it
+	SpeechCacheDir     string // the speeches synthesized are cached in
+	SpeechCacheSize    int    // MB, the least recently used speeches are removed beyond it, 0 to disable the cache
+	VoiceCatalog       string // the voices of azure are saved in, empty to retrieve them every time
+
+	TranscriptDir string   // empty for no transcript
+	RecordAnswers bool     // save the spoken answers beside the transcript
+	RecordPrompts bool     // save the prompts heard from microphone beside the transcript
+	Subtitles     string   // srt or vtt, the subtitles saved beside the answers recorded, empty for none
+	Karaoke       bool     // show the answers word by word when they are spoken
+	PhraseFiles   []string // the phrases (one per line) hinted to the speech recognition
+
+	AudioDevices // the microphone and speaker, empty for the default ones
+	Timeouts
+	LanguageTimeouts map[string]Timeouts // BCP-47 code to the timeouts overridden for the language
+
+	Hooks    string              // the hooks file in the config dir, empty for hooks.json
+	Profiles map[string]*Profile // the name to the profile overriding params, chosen by --profile
+
+	resolved map[string]bool   // the credentials from SECRETS, not saved in params
+	plain    map[string]string // the credentials in params can't be kept by SecretStore, saved in params as they were
+	profile  string            // the profile used, empty for none
+	base     *Params           // params before the profile is used
 }
 
+// String returns params in JSON, the credentials are masked.
 func (p Params) String() string {
+	for _, field := range p.credentials() {
+		*field = maskKey(*field)
+	}
+
 	json, err := json.MarshalIndent(p, "", " ")
 	if err != nil {
 		return ""
@@ -31,29 +88,263 @@ func (p Params) String() string {
 	return string(json)
 }
 
-var PARAMS = Params{MaxHistory: 4, Language: "en-US", Voice: "en-US-ElizabethNeural"}
+var PARAMS = Params{MaxHistory: 4, KeyFile: "secrets.json", Language: "en-US", Voice: "en-US-ElizabethNeural", WhisperBinary: "whisper-cli", EspeakBinary: "espeak-ng", SynthesisLookahead: 2, MinSegmentLength: 10, MaxSegmentLength: 200, VADSensitivity: DefaultVADSensitivity, HalfDuplex: true, EchoTailMs: 200, SpeechCacheDir: "cache/speech", VoiceCatalog: "cache/voices.json", Timeouts: DefaultTimeouts}
 
-func (p Params) SaveParams(file string) error {
-	json, err := json.MarshalIndent(p, "", " ")
+const (
+	AzureEngine   = "azure"
+	WhisperEngine = "whisper"
+	EspeakEngine  = "espeak"
+
+	TranscriptionEngine = "transcription"
+	HalAudioIO          = "hal"
+
+	FileSecretStore    = "file"
+	KeyringSecretStore = "keyring"
+)
+
+// UseAzure reports whether any azure speech service is needed.
+func (p Params) UseAzure() bool {
+	isAzure := func(engine string) bool {
+		return engine == "" || engine == AzureEngine
+	}
+
+	return isAzure(p.RecognitionEngine) || isAzure(p.SynthesisEngine) || isAzure(p.WakeWordEngine)
+}
+
+// ForLanguage returns the params to reply in the (detected) language, the voice is from Voices, or the
+// one auto detected by the speech synthesis engine if not configured.
+func (p Params) ForLanguage(language string) Params {
+	if language == "" || strings.EqualFold(language, p.Language) {
+		return p
+	}
+
+	p.Language = language
+	if !strings.HasPrefix(strings.ToLower(p.Voice), strings.ToLower(language)) {
+		p.Voice = p.Voices[language]
+		p.EspeakVoice = ""
+	}
+
+	return p
+}
+
+// TimeoutsFor returns the timeouts for the language, the fields of LanguageTimeouts override the ones of params.
+func (p Params) TimeoutsFor(language string) Timeouts {
+	return p.LanguageTimeouts[language].merge(p.Timeouts.merge(DefaultTimeouts))
+}
+
+// AudioFormat returns the output format of speech synthesis, the default of engine if SynthesisFormat is empty.
+func (p Params) AudioFormat() (AudioFormat, error) {
+	if p.SynthesisFormat == "" && p.SynthesisEngine == EspeakEngine {
+		return EspeakAudioFormat, nil
+	}
+
+	return ParseAudioFormat(p.SynthesisFormat)
+}
+
+// Secrets returns the stores of credentials, the environment variables (see SecretEnv) then SecretStore.
+func (p Params) Secrets() (Secrets, error) {
+	secrets := Secrets{EnvSecrets{}}
+	switch p.SecretStore {
+	case "", FileSecretStore:
+		if p.KeyFile != "" {
+			secrets = append(secrets, KeyFile{File: ConfigPath(p.KeyFile)})
+		}
+	case KeyringSecretStore:
+		keyring, err := NewKeyringSecrets()
+		if err != nil {
+			return secrets, fmt.Errorf("keyring: %w", err)
+		}
+
+		secrets = append(secrets, keyring)
+	default:
+		return secrets, fmt.Errorf("unknown secret store: %s", p.SecretStore)
+	}
+
+	return secrets, nil
+}
+
+// credentials returns the fields of the credentials in params.
+func (p *Params) credentials() map[string]*string {
+	return map[string]*string{OpenaiCredential: &p.OpenaiKey, SpeechKeyCredential: &p.SpeechKey, SpeechRegionCredential: &p.SpeechRegion}
+}
+
+// ResolveSecrets sets SECRETS by the stores of params, and reads the keys of openai and azure from it, the ones
+// in params are used if not found. The keys in params not kept by SecretStore are remembered, so they are not lost
+// when the environment variables override them, until StoreSecrets moves them. Nothing is written, and the stores
+// are usable even if it fails.
+func (p *Params) ResolveSecrets() error {
+	secrets, err := p.Secrets()
+	SECRETS = secrets
+	p.resolved, p.plain = map[string]bool{}, map[string]string{}
+	stores := secrets[1:] // without the environment variables
+	for name, field := range p.credentials() {
+		if *field != "" {
+			if stored, _ := stores.Get(name); stored != *field {
+				p.plain[name] = *field
+			}
+		}
+
+		if secret := LookupSecret(name); secret != "" {
+			*field = secret
+			p.resolved[name] = true
+		}
+	}
+
+	return err
+}
+
+// StoreSecrets keeps the keys of openai and azure in SECRETS instead of params, the ones found in params by
+// ResolveSecrets first. The ones can't be kept are still saved in params.
+func (p *Params) StoreSecrets() error {
+	if p.resolved == nil {
+		p.resolved = map[string]bool{}
+	}
+
+	for name, plain := range p.plain {
+		err := SECRETS.Set(name, plain)
+		if errors.Is(err, ErrSecretReadOnly) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("keep credential %s: %w", name, err)
+		}
+
+		delete(p.plain, name)
+	}
+
+	for name, field := range p.credentials() {
+		// the ones in params can't be kept are saved as they were
+		if _, ok := p.plain[name]; *field == "" || ok {
+			continue
+		}
+
+		// the ones from SECRETS (e.g. the environment variables) are kept already, the ones in params are not lost
+		if LookupSecret(name) != *field {
+			if err := SECRETS.Set(name, *field); err != nil {
+				return fmt.Errorf("keep credential %s: %w", name, err)
+			}
+
+			delete(p.plain, name)
+		}
+
+		p.resolved[name] = true
+	}
+
+	return nil
+}
+
+// HooksPath returns the hooks file of params (or the profile used) in the config dir.
+func (p Params) HooksPath() string {
+	if p.Hooks != "" {
+		return ConfigPath(p.Hooks)
+	}
+
+	return ConfigPath(HooksFile)
+}
+
+// halAudioIO reports whether the audio of azure is captured and played by HAL, which needs arecord and aplay
+// (alsa-utils) if AudioIO is not set.
+func (p Params) halAudioIO() bool {
+	switch p.AudioIO {
+	case HalAudioIO:
+		return true
+	case "":
+		_, recordErr := exec.LookPath("arecord")
+		_, playErr := exec.LookPath("aplay")
+		return recordErr == nil && playErr == nil
+	}
+
+	return false
+}
+
+// Validate checks the synthesis format, subtitles and timeouts of params, and the timeouts of each language.
+func (p Params) Validate() error {
+	format, err := p.AudioFormat()
 	if err != nil {
 		return err
 	}
 
-	f, err := os.Create(file)
-	if err != nil {
+	if p.AudioIO != "" && p.AudioIO != HalAudioIO && p.AudioIO != AzureEngine {
+		return fmt.Errorf("AudioIO must be hal or azure, got %s", p.AudioIO)
+	}
+
+	if p.VADSensitivity < 0 || p.VADSensitivity > 1 {
+		return fmt.Errorf("VADSensitivity must be in [0, 1], got %g", p.VADSensitivity)
+	}
+
+	if p.EchoCancellation && p.SynthesisFormat != "" && !format.IsPCM() {
+		return fmt.Errorf("EchoCancellation needs a PCM SynthesisFormat, got %s", p.SynthesisFormat)
+	}
+
+	if p.EchoTailMs < 0 || (p.EchoCancellation && p.EchoTailMs == 0) {
+		return fmt.Errorf("EchoTailMs must not be negative, or zero for the echo cancellation, got %d", p.EchoTailMs)
+	}
+
+	if p.SecretStore != "" && p.SecretStore != FileSecretStore && p.SecretStore != KeyringSecretStore {
+		return fmt.Errorf("SecretStore must be file or keyring, got %s", p.SecretStore)
+	}
+
+	for name, profile := range p.Profiles {
+		if name == "" || profile == nil {
+			return fmt.Errorf("profile must have a name and overrides, got %q", name)
+		}
+	}
+
+	if p.Subtitles != "" && p.Subtitles != "srt" && p.Subtitles != "vtt" {
+		return fmt.Errorf("Subtitles must be srt or vtt, got %s", p.Subtitles)
+	}
+
+	if p.SynthesisLookahead < 0 {
+		return fmt.Errorf("SynthesisLookahead must not be negative, got %d", p.SynthesisLookahead)
+	}
+
+	if p.SpeechCacheSize < 0 {
+		return fmt.Errorf("SpeechCacheSize must not be negative, got %d", p.SpeechCacheSize)
+	}
+
+	if p.SpeechCacheSize > 0 && p.SpeechCacheDir == "" {
+		return fmt.Errorf("SpeechCacheDir must be set for the speech cache")
+	}
+
+	if p.MaxSegmentLength < 0 || (p.MaxSegmentLength > 0 && p.MinSegmentLength > p.MaxSegmentLength) {
+		return fmt.Errorf("MaxSegmentLength must not be negative or less than MinSegmentLength, got %d", p.MaxSegmentLength)
+	}
+
+	if err = p.TimeoutsFor("").Validate(); err != nil {
 		return err
 	}
 
-	defer f.Close()
-	writer := bufio.NewWriter(f)
-	_, err = writer.Write(json)
+	for l := range p.LanguageTimeouts {
+		if err = p.TimeoutsFor(l).Validate(); err != nil {
+			return fmt.Errorf("%s: %w", l, err)
+		}
+	}
+
+	return nil
+}
+
+// SaveParams saves params to file, without the credentials kept in SECRETS, and the overrides of the profile used
+// are saved in the profile.
+func (p Params) SaveParams(file string) error {
+	p = p.restoreProfile()
+	for name, field := range p.credentials() {
+		if plain, ok := p.plain[name]; ok {
+			*field = plain
+		} else if p.resolved[name] {
+			*field = ""
+		}
+	}
+
+	json, err := json.MarshalIndent(p, "", " ")
 	if err != nil {
 		return err
 	}
 
-	tlog.Debugf("save params.")
+	if err = writeFileAtomic(file, json); err != nil {
+		return err
+	}
 
-	return writer.Flush()
+	tlog.Debugf("save params.")
+	return nil
 }
 
 func (p *Params) LoadParams(file string) error {
@@ -74,6 +365,78 @@ func (p *Params) LoadParams(file string) error {
 	return json.Unmarshal(content, p)
 }
 
+// Timeouts tunes how long HAL waits for the speaker and the speech services, for slow speakers or noisy rooms.
+// A zero field is the default one.
+type Timeouts struct {
+	SegmentationSilenceTimeoutMs int // the silence ends an utterance
+	InitialSilenceTimeoutMs      int // the silence before speaking ends the recognition
+	DictationSilenceTimeoutMs    int // the silence ends a dictation
+	MaxSpeechRecognitionDelay    int // seconds
+	MaxSpeechSynthesisDelay      int // seconds
+	MaxBlankSpeeches             int // HAL is deactivated after nothing heard for the times
+}
+
+var DefaultTimeouts = Timeouts{
+	SegmentationSilenceTimeoutMs: 1500,
+	InitialSilenceTimeoutMs:      5000,
+	DictationSilenceTimeoutMs:    3000,
+	MaxSpeechRecognitionDelay:    30,
+	MaxSpeechSynthesisDelay:      10,
+	MaxBlankSpeeches:             3,
+}
+
+// TIMEOUTS is used by the speech services, it is set when the speech recognition is created from params.
+var TIMEOUTS = DefaultTimeouts
+
+// merge fills the zero fields by the defaults.
+func (t Timeouts) merge(defaults Timeouts) Timeouts {
+	pick := func(v, d int) int {
+		if v == 0 {
+			return d
+		}
+
+		return v
+	}
+
+	return Timeouts{
+		SegmentationSilenceTimeoutMs: pick(t.SegmentationSilenceTimeoutMs, defaults.SegmentationSilenceTimeoutMs),
+		InitialSilenceTimeoutMs:      pick(t.InitialSilenceTimeoutMs, defaults.InitialSilenceTimeoutMs),
+		DictationSilenceTimeoutMs:    pick(t.DictationSilenceTimeoutMs, defaults.DictationSilenceTimeoutMs),
+		MaxSpeechRecognitionDelay:    pick(t.MaxSpeechRecognitionDelay, defaults.MaxSpeechRecognitionDelay),
+		MaxSpeechSynthesisDelay:      pick(t.MaxSpeechSynthesisDelay, defaults.MaxSpeechSynthesisDelay),
+		MaxBlankSpeeches:             pick(t.MaxBlankSpeeches, defaults.MaxBlankSpeeches),
+	}
+}
+
+func (t Timeouts) Validate() error {
+	switch {
+	case t.SegmentationSilenceTimeoutMs < 100 || t.SegmentationSilenceTimeoutMs > 5000:
+		return fmt.Errorf("SegmentationSilenceTimeoutMs must be in [100, 5000], got %d", t.SegmentationSilenceTimeoutMs)
+	case t.InitialSilenceTimeoutMs <= 0:
+		return fmt.Errorf("InitialSilenceTimeoutMs must be positive, got %d", t.InitialSilenceTimeoutMs)
+	case t.DictationSilenceTimeoutMs <= 0:
+		return fmt.Errorf("DictationSilenceTimeoutMs must be positive, got %d", t.DictationSilenceTimeoutMs)
+	case t.MaxSpeechRecognitionDelay <= 0:
+		return fmt.Errorf("MaxSpeechRecognitionDelay must be positive, got %d", t.MaxSpeechRecognitionDelay)
+	case t.MaxSpeechSynthesisDelay <= 0:
+		return fmt.Errorf("MaxSpeechSynthesisDelay must be positive, got %d", t.MaxSpeechSynthesisDelay)
+	case t.MaxBlankSpeeches <= 0:
+		return fmt.Errorf("MaxBlankSpeeches must be positive, got %d", t.MaxBlankSpeeches)
+	case t.InitialSilenceTimeoutMs > t.MaxSpeechRecognitionDelay*1000:
+		return fmt.Errorf("InitialSilenceTimeoutMs %d is longer than MaxSpeechRecognitionDelay %ds", t.InitialSilenceTimeoutMs, t.MaxSpeechRecognitionDelay)
+	}
+
+	return nil
+}
+
+func (t Timeouts) recognitionDelay() time.Duration {
+	return time.Duration(t.MaxSpeechRecognitionDelay) * time.Second
+}
+
+func (t Timeouts) synthesisDelay() time.Duration {
+	return time.Duration(t.MaxSpeechSynthesisDelay) * time.Second
+}
+
 // because azure stt go speech sdk only support 4 languages in auto detected by languages (not support full languages auto detected)
 var AUTO_DETECTED_LANGUAGE = map[string]string{
 	// "German":     {"de-AT", "de-CH", "de-DE"},
@@ -38,3 +38,58 @@ func TestLoadParams(t *testing.T) {
 
 	assert.Equal(t, cParams, params)
 }
+
+func TestForLanguage(t *testing.T) {
+	p := Params{Language: "en-US", Voice: "en-US-ElizabethNeural", Voices: map[string]string{"fr-FR": "fr-FR-DeniseNeural"}, EspeakVoice: "en-us"}
+	assert.Equal(t, p, p.ForLanguage(""))
+	assert.Equal(t, p, p.ForLanguage("en-us"))
+
+	fr := p.ForLanguage("fr-FR")
+	assert.Equal(t, "fr-FR", fr.Language)
+	assert.Equal(t, "fr-FR-DeniseNeural", fr.Voice)
+	assert.Equal(t, "", fr.EspeakVoice)
+
+	// auto detected by the engine
+	assert.Equal(t, "", p.ForLanguage("zh-CN").Voice)
+
+	// the voice speaks the language already
+	p.Language = ""
+	assert.Equal(t, "en-US-ElizabethNeural", p.ForLanguage("en-US").Voice)
+}
+
+func TestTimeoutsFor(t *testing.T) {
+	p := Params{Timeouts: Timeouts{SegmentationSilenceTimeoutMs: 800}, LanguageTimeouts: map[string]Timeouts{"zh-CN": {SegmentationSilenceTimeoutMs: 2000, MaxBlankSpeeches: 5}}}
+
+	en := p.TimeoutsFor("en-US")
+	assert.Equal(t, 800, en.SegmentationSilenceTimeoutMs)
+	assert.Equal(t, DefaultTimeouts.InitialSilenceTimeoutMs, en.InitialSilenceTimeoutMs)
+	assert.Equal(t, DefaultTimeouts.MaxBlankSpeeches, en.MaxBlankSpeeches)
+
+	zh := p.TimeoutsFor("zh-CN")
+	assert.Equal(t, 2000, zh.SegmentationSilenceTimeoutMs)
+	assert.Equal(t, 5, zh.MaxBlankSpeeches)
+	assert.Equal(t, DefaultTimeouts.MaxSpeechRecognitionDelay, zh.MaxSpeechRecognitionDelay)
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, Params{}.Validate())
+	assert.Nil(t, PARAMS.Validate())
+
+	assert.NotNil(t, Params{Timeouts: Timeouts{SegmentationSilenceTimeoutMs: 50}}.Validate())
+	assert.NotNil(t, Params{Timeouts: Timeouts{MaxBlankSpeeches: -1}}.Validate())
+	assert.NotNil(t, Params{Timeouts: Timeouts{InitialSilenceTimeoutMs: 60000}}.Validate())
+
+	// the echo is cancelled with the speech in PCM, the default format is changed to it
+	mp3 := Params{EchoCancellation: true, EchoTailMs: 50, SynthesisFormat: "audio-16khz-32kbitrate-mono-mp3"}
+	assert.NotNil(t, mp3.Validate())
+	_, err := mp3.playedFormat()
+	assert.NotNil(t, err)
+	assert.Nil(t, Params{EchoCancellation: true, EchoTailMs: 50, SynthesisFormat: "riff-24khz-16bit-mono-pcm"}.Validate())
+	format, err := Params{EchoCancellation: true, EchoTailMs: 50}.playedFormat()
+	assert.Nil(t, err)
+	assert.True(t, format.IsPCM())
+
+	err = Params{LanguageTimeouts: map[string]Timeouts{"fr-FR": {MaxSpeechSynthesisDelay: -2}}}.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "fr-FR")
+}
@@ -0,0 +1,115 @@
+package hal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrUnsupportedPCM = errors.New("only 16 bits PCM is supported")
+
+type pcmConverter struct {
+	r       io.Reader
+	from    PCMFormat
+	to      PCMFormat
+	ratio   float64   // input samples per output sample
+	samples []float64 // mono input samples not consumed yet
+	pos     float64   // position of next output sample in samples
+	eof     bool
+	out     []byte
+}
+
+// NewPCMConverter converts 16 bits PCM from a format to another one, by mixing the channels
+// and linear resampling.
+func NewPCMConverter(r io.Reader, from, to PCMFormat) (io.Reader, error) {
+	if from.BitsPerSample != 16 || to.BitsPerSample != 16 {
+		return nil, ErrUnsupportedPCM
+	}
+
+	for _, f := range []PCMFormat{from, to} {
+		if f.SampleRate <= 0 || f.Channels <= 0 {
+			return nil, fmt.Errorf("sample rate and channels of PCM must be positive, got %d and %d", f.SampleRate, f.Channels)
+		}
+	}
+
+	if from == to {
+		return r, nil
+	}
+
+	return &pcmConverter{r: r, from: from, to: to, ratio: float64(from.SampleRate) / float64(to.SampleRate)}, nil
+}
+
+func (c *pcmConverter) Read(p []byte) (int, error) {
+	for len(c.out) == 0 {
+		if c.eof && c.pos >= float64(len(c.samples)-1) {
+			return 0, io.EOF
+		}
+
+		if err := c.fill(); err != nil {
+			return 0, err
+		}
+
+		c.convert()
+	}
+
+	n := copy(p, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+// fill reads a block of frames, and mixes them to mono samples.
+func (c *pcmConverter) fill() error {
+	frameSize := 2 * c.from.Channels
+	buffer := make([]byte, 1024*frameSize)
+	n, err := io.ReadAtLeast(c.r, buffer, frameSize)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.eof = true
+	} else if err != nil {
+		return err
+	}
+
+	for i := 0; i+frameSize <= n; i += frameSize {
+		var sum float64
+		for ch := 0; ch < c.from.Channels; ch++ {
+			sum += float64(int16(binary.LittleEndian.Uint16(buffer[i+2*ch:])))
+		}
+
+		c.samples = append(c.samples, sum/float64(c.from.Channels))
+	}
+
+	return nil
+}
+
+// convert outputs the samples can be interpolated.
+func (c *pcmConverter) convert() {
+	if c.eof && len(c.samples) == 0 {
+		return
+	}
+
+	last := float64(len(c.samples) - 1)
+	if c.eof {
+		// the last sample has no next one, use itself
+		c.samples = append(c.samples, c.samples[len(c.samples)-1:]...)
+	}
+
+	for ; c.pos < last || (c.eof && c.pos <= last); c.pos += c.ratio {
+		i := int(c.pos)
+		frac := c.pos - float64(i)
+		v := int16(c.samples[i]*(1-frac) + c.samples[i+1]*frac)
+		for ch := 0; ch < c.to.Channels; ch++ {
+			c.out = append(c.out, byte(v), byte(uint16(v)>>8))
+		}
+	}
+
+	if c.eof {
+		c.samples = c.samples[:0]
+		c.pos = 0
+		return
+	}
+
+	// drop the samples already used, keep the one for interpolation
+	drop := int(c.pos)
+	c.samples = c.samples[drop:]
+	c.pos -= float64(drop)
+}
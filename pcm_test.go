@@ -0,0 +1,53 @@
+package hal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pcm16(samples ...int16) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, samples)
+	return b.Bytes()
+}
+
+func TestPCMConverterDownmixAndDownsample(t *testing.T) {
+	// stereo 32kHz -> mono 16kHz
+	from := PCMFormat{SampleRate: 32000, Channels: 2, BitsPerSample: 16}
+	in := pcm16(100, 300, 1000, 1000, 400, 0, -100, -100)
+	r, err := NewPCMConverter(bytes.NewReader(in), from, DefaultPCMFormat)
+	assert.Nil(t, err)
+
+	out, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, pcm16(200, 200), out)
+}
+
+func TestPCMConverterUpsample(t *testing.T) {
+	from := PCMFormat{SampleRate: 8000, Channels: 1, BitsPerSample: 16}
+	r, err := NewPCMConverter(bytes.NewReader(pcm16(0, 100, 200)), from, DefaultPCMFormat)
+	assert.Nil(t, err)
+
+	out, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, pcm16(0, 50, 100, 150, 200), out)
+}
+
+func TestPCMConverterSameFormat(t *testing.T) {
+	in := bytes.NewReader(pcm16(1, 2, 3))
+	r, err := NewPCMConverter(in, DefaultPCMFormat, DefaultPCMFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, in, r)
+
+	_, err = NewPCMConverter(in, PCMFormat{SampleRate: 8000, Channels: 1, BitsPerSample: 8}, DefaultPCMFormat)
+	assert.ErrorIs(t, err, ErrUnsupportedPCM)
+
+	_, err = NewPCMConverter(in, PCMFormat{SampleRate: 8000, Channels: 0, BitsPerSample: 16}, DefaultPCMFormat)
+	assert.NotNil(t, err)
+	_, err = NewPCMConverter(in, PCMFormat{SampleRate: 0, Channels: 1, BitsPerSample: 16}, DefaultPCMFormat)
+	assert.NotNil(t, err)
+}
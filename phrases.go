@@ -0,0 +1,88 @@
+package hal
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+)
+
+// PhraseListRecognition is a speech recognition can be hinted by a list of phrases (e.g. jargons, product names),
+// so they are recognized more reliable.
+type PhraseListRecognition interface {
+	SetPhrases(phrases []string) error
+}
+
+// SetPhrases sets the phrases of sr if it supports phrase list, otherwise does nothing.
+func SetPhrases(sr SpeechRecognition, phrases []string) error {
+	if p, ok := sr.(PhraseListRecognition); ok {
+		return p.SetPhrases(phrases)
+	}
+
+	return nil
+}
+
+// CollectPhrases collects the phrases from the session names, the keywords of enabled hooks, the stop word,
+// and the phrase files in params.
+func CollectPhrases(p Params) []string {
+	phrases := CHATGPTS.SessionsWithout("hooks")
+	for _, config := range HOOKS.Configs {
+		if config.Enable {
+			phrases = append(phrases, config.Keyword)
+		}
+	}
+
+	phrases = append(phrases, p.StopWord)
+	for _, file := range p.PhraseFiles {
+		res, err := LoadPhrases(ConfigPath(file))
+		if err != nil {
+			tlog.Warningf("phrase file %s: %s", file, err)
+			continue
+		}
+
+		phrases = append(phrases, res...)
+	}
+
+	return uniquePhrases(phrases)
+}
+
+// LoadPhrases reads the phrases from file, one phrase per line, and the line starts with # is comment.
+func LoadPhrases(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	var res []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		res = append(res, line)
+	}
+
+	return res, scanner.Err()
+}
+
+// uniquePhrases drops the empty and repeated (case insensitive) phrases, and sorts them.
+func uniquePhrases(phrases []string) []string {
+	seen := map[string]bool{}
+	var res []string
+	for _, phrase := range phrases {
+		phrase = strings.TrimSpace(phrase)
+		key := strings.ToLower(phrase)
+		if phrase == "" || seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		res = append(res, phrase)
+	}
+
+	sort.Strings(res)
+	return res
+}
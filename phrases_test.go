@@ -0,0 +1,47 @@
+package hal
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadPhrases(t *testing.T) {
+	f, err := os.CreateTemp("./test_data", "phrases*.txt")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+
+	f.WriteString("# product names\nKubernetes\n\n  HAL 9000  \n")
+	f.Close()
+
+	phrases, err := LoadPhrases(f.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Kubernetes", "HAL 9000"}, phrases)
+
+	_, err = LoadPhrases("./test_data/not_exists.txt")
+	assert.NotNil(t, err)
+}
+
+func TestCollectPhrases(t *testing.T) {
+	f, err := os.CreateTemp("./test_data", "phrases*.txt")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+
+	f.WriteString("Kubernetes\nwork\n")
+	f.Close()
+
+	chatgpts, hooks := CHATGPTS, HOOKS
+	defer func() { CHATGPTS, HOOKS = chatgpts, hooks }()
+
+	CHATGPTS = newChatGPTs()
+	CHATGPTS.NewDefaultSession("", "")
+	CHATGPTS.NewSessionWithName("hooks", "", "")
+	CHATGPTS.NewSessionWithName("Work", "", "")
+	HOOKS = newHooks()
+	HOOKS.Configs["1"] = &HookConfig{Keyword: "list session", HookName: "listSession", Enable: true}
+	HOOKS.Configs["2"] = &HookConfig{Keyword: "delete session", HookName: "deleteSession"}
+
+	phrases := CollectPhrases(Params{StopWord: "goodbye", PhraseFiles: []string{f.Name(), "./test_data/not_exists.txt"}})
+	assert.Equal(t, []string{"Kubernetes", "default", "goodbye", "list session", "work"}, phrases)
+}
@@ -0,0 +1,302 @@
+package hal
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var ErrPipelineStopped = errors.New("speech pipeline stopped")
+
+// SynthesizedSpeech is a segment of text synthesized by the pipeline, waiting to play.
+type SynthesizedSpeech struct {
+	Text     string
+	Audio    []byte
+	Words    []*WordBoundery
+	Duration time.Duration
+}
+
+// SpeechPipeline speaks the segments of a stream (e.g. the answer of chatgpt) without gaps between them. The
+// segments are produced from the stream, synthesized concurrently by the synthesizers, and played in order by
+// the player, while at most Lookahead segments are synthesized ahead of the one playing.
+//
+// Without a player, the synthesizer (e.g. SpeechSynthesisStandalone) plays the speech by itself, so the segments
+// are synthesized one by one.
+type SpeechPipeline struct {
+	Lookahead int      // the max segments synthesized (or synthesizing) ahead of the one playing
+	Prosody   *Prosody // how the segments are spoken
+
+	// optional, they are written in the order of playback
+	Recorder  *AudioRecorder
+	Subtitles *Subtitles
+	Karaoke   *Karaoke
+
+	synthesizers []SpeechSynthesis
+	format       AudioFormat
+	player       AudioPlayer
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// NewSpeechPipeline creates the pipeline synthesizing by the synthesizers (their Result outputs audio in format)
+// and playing by player. The synthesizers are closed with the pipeline.
+func NewSpeechPipeline(synthesizers []SpeechSynthesis, format AudioFormat, player AudioPlayer) *SpeechPipeline {
+	return &SpeechPipeline{Lookahead: 2, synthesizers: synthesizers, format: format, player: player}
+}
+
+// NewStandaloneSpeechPipeline creates the pipeline speaking by ss, which plays the speech by itself.
+func NewStandaloneSpeechPipeline(ss SpeechSynthesis) *SpeechPipeline {
+	return &SpeechPipeline{synthesizers: []SpeechSynthesis{ss}}
+}
+
+type speechJob struct {
+	text   string
+	result chan speechJobResult
+}
+
+type speechJobResult struct {
+	speech *SynthesizedSpeech
+	err    error
+}
+
+// Run speaks the segments from next until it returns empty, and returns after the last one is played. It stops
+// at the first error, or Stop is called, the segments synthesized but not played are dropped.
+func (p *SpeechPipeline) Run(next func() string) error {
+	stop := make(chan struct{})
+	p.mu.Lock()
+	p.stop = stop
+	p.mu.Unlock()
+	defer p.Stop()
+
+	if p.player == nil {
+		return p.runStandalone(next, stop)
+	}
+
+	// a slot is taken by a segment from it is produced until it is played
+	size := 1
+	if p.Lookahead > 0 {
+		size += p.Lookahead
+	}
+
+	slots := make(chan struct{}, size)
+	jobs := make(chan speechJob)
+	queue := make(chan speechJob, size)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		defer close(queue)
+		for text := next(); text != ""; text = next() {
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return
+			}
+
+			job := speechJob{text: text, result: make(chan speechJobResult, 1)}
+			// queued before synthesized, so they are played in order
+			queue <- job
+			select {
+			case jobs <- job:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	for _, ss := range p.synthesizers {
+		wg.Add(1)
+		go func(ss SpeechSynthesis) {
+			defer wg.Done()
+			for job := range jobs {
+				speech, err := p.synthesize(ss, job.text)
+				job.result <- speechJobResult{speech: speech, err: err}
+			}
+		}(ss)
+	}
+
+	err := p.play(queue, slots, stop)
+	p.Stop()
+	wg.Wait()
+	return err
+}
+
+// Speak speaks the text (e.g. a question of dialog) and returns after it is played, without the prosody,
+// recorder, subtitles and karaoke of the answers.
+func (p *SpeechPipeline) Speak(text string) error {
+	prosody, recorder, subtitles, karaoke := p.Prosody, p.Recorder, p.Subtitles, p.Karaoke
+	p.Prosody, p.Recorder, p.Subtitles, p.Karaoke = nil, nil, nil, nil
+	defer func() {
+		p.Prosody, p.Recorder, p.Subtitles, p.Karaoke = prosody, recorder, subtitles, karaoke
+	}()
+
+	spoken := false
+	return p.Run(func() string {
+		if spoken {
+			return ""
+		}
+
+		spoken = true
+		return text
+	})
+}
+
+// Stop stops the running pipeline, the segment playing is finished.
+func (p *SpeechPipeline) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
+
+// Close stops the pipeline and closes the synthesizers.
+func (p *SpeechPipeline) Close() error {
+	p.Stop()
+	var err error
+	for _, ss := range p.synthesizers {
+		if closeErr := ss.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+func (p *SpeechPipeline) play(queue chan speechJob, slots chan struct{}, stop chan struct{}) error {
+	for job := range queue {
+		var res speechJobResult
+		select {
+		case res = <-job.result:
+		case <-stop:
+			return ErrPipelineStopped
+		}
+
+		if res.err != nil {
+			return res.err
+		}
+
+		speech := res.speech
+		if p.Recorder != nil {
+			if err := p.Recorder.WriteAudio(p.format, speech.Audio); err != nil {
+				tlog.Errorf("record speech: %s", err)
+			}
+		}
+
+		if p.Subtitles != nil {
+			for _, w := range speech.Words {
+				p.Subtitles.Add(w)
+			}
+
+			p.Subtitles.EndSpeech(speech.Duration)
+		}
+
+		shown := make(chan struct{})
+		go func() {
+			defer close(shown)
+			if p.Karaoke != nil {
+				for _, w := range speech.Words {
+					p.Karaoke.Show(w)
+				}
+
+				p.Karaoke.End()
+			}
+		}()
+
+		err := p.player.Play(p.format, speech.Audio)
+		<-shown
+		if err != nil {
+			return err
+		}
+
+		<-slots
+	}
+
+	return nil
+}
+
+// synthesize speaks the text by ss, and collects the audio and words.
+func (p *SpeechPipeline) synthesize(ss SpeechSynthesis, text string) (*SynthesizedSpeech, error) {
+	err := SpeakWithProsody(ss, text, p.Prosody)
+	if err != nil {
+		return nil, err
+	}
+
+	speech := &SynthesizedSpeech{Text: text}
+	w, audio, err := ss.Result()
+	for ; err == nil; w, audio, err = ss.Result() {
+		if w != nil {
+			speech.Words = append(speech.Words, w)
+		}
+
+		speech.Audio = append(speech.Audio, audio...)
+	}
+
+	if !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if err = ss.Error(); err != nil {
+		return nil, err
+	}
+
+	speech.Duration = SpeechDuration(ss)
+	return speech, nil
+}
+
+// runStandalone speaks the segments one by one, the words are shown and added to the subtitles when they come.
+func (p *SpeechPipeline) runStandalone(next func() string, stop chan struct{}) error {
+	ss := p.synthesizers[0]
+	if p.Recorder != nil {
+		Record(ss, p.Recorder)
+		defer Record(ss, nil)
+	}
+
+	for text := next(); text != ""; text = next() {
+		select {
+		case <-stop:
+			return ErrPipelineStopped
+		default:
+		}
+
+		err := SpeakWithProsody(ss, text, p.Prosody)
+		if err != nil {
+			return err
+		}
+
+		w, _, err := ss.Result()
+		for ; err == nil; w, _, err = ss.Result() {
+			if p.Subtitles != nil {
+				p.Subtitles.Add(w)
+			}
+
+			if p.Karaoke != nil {
+				p.Karaoke.Show(w)
+			}
+		}
+
+		if p.Karaoke != nil {
+			p.Karaoke.End()
+		}
+
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		if err = ss.Error(); err != nil {
+			return err
+		}
+
+		if p.Subtitles != nil {
+			p.Subtitles.EndSpeech(SpeechDuration(ss))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package hal
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStreamSpeechSynthesis outputs the text as audio, the longer text takes more time.
+type fakeStreamSpeechSynthesis struct {
+	results chan []byte
+}
+
+func newFakeStreamSpeechSynthesis() *fakeStreamSpeechSynthesis {
+	return &fakeStreamSpeechSynthesis{results: make(chan []byte, 1)}
+}
+
+func (f *fakeStreamSpeechSynthesis) TextToSpeech(text string) error {
+	if text == "fail" {
+		return errors.New("fail")
+	}
+
+	time.Sleep(time.Duration(len(text)) * time.Millisecond)
+	f.results <- []byte(text)
+	return nil
+}
+
+func (f *fakeStreamSpeechSynthesis) Result() (*WordBoundery, []byte, error) {
+	select {
+	case audio := <-f.results:
+		return &WordBoundery{Text: string(audio)}, audio, nil
+	default:
+		return nil, nil, io.EOF
+	}
+}
+
+func (f *fakeStreamSpeechSynthesis) Error() error {
+	return nil
+}
+
+func (f *fakeStreamSpeechSynthesis) Close() error {
+	return nil
+}
+
+// fakeAudioPlayer keeps the audio played, and the max segments produced ahead of playback.
+type fakeAudioPlayer struct {
+	mu       sync.Mutex
+	played   []string
+	produced int
+	ahead    int
+}
+
+func (f *fakeAudioPlayer) Play(format AudioFormat, audio []byte) error {
+	f.mu.Lock()
+	f.played = append(f.played, string(audio))
+	f.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	return nil
+}
+
+func (f *fakeAudioPlayer) next(segments []string) func() string {
+	return func() string {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.produced-len(f.played) > f.ahead {
+			f.ahead = f.produced - len(f.played)
+		}
+
+		if f.produced == len(segments) {
+			return ""
+		}
+
+		f.produced++
+		return segments[f.produced-1]
+	}
+}
+
+func TestSpeechPipeline(t *testing.T) {
+	segments := []string{strings.Repeat("long ", 10), "short", strings.Repeat("longer ", 10), "end"}
+	player := &fakeAudioPlayer{}
+	p := NewSpeechPipeline([]SpeechSynthesis{newFakeStreamSpeechSynthesis(), newFakeStreamSpeechSynthesis()}, DefaultAudioFormat, player)
+	p.Lookahead = 1
+	p.Subtitles = NewSubtitles()
+
+	assert.Nil(t, p.Run(player.next(segments)))
+	assert.Equal(t, segments, player.played)
+	// one is playing, one is synthesized ahead, and one is produced waiting for a slot
+	assert.LessOrEqual(t, player.ahead, 3)
+	assert.Equal(t, 4, len(p.Subtitles.Cues()))
+	assert.Nil(t, p.Close())
+}
+
+func TestSpeechPipelineSpeak(t *testing.T) {
+	player := &fakeAudioPlayer{}
+	p := NewSpeechPipeline([]SpeechSynthesis{newFakeStreamSpeechSynthesis()}, DefaultAudioFormat, player)
+	subtitles := NewSubtitles()
+	p.Subtitles = subtitles
+
+	// the question of dialog is not in the subtitles of answers
+	assert.Nil(t, p.Speak("which one?"))
+	assert.Equal(t, []string{"which one?"}, player.played)
+	assert.Empty(t, subtitles.Cues())
+	assert.Same(t, subtitles, p.Subtitles)
+}
+
+func TestSpeechPipelineError(t *testing.T) {
+	player := &fakeAudioPlayer{}
+	p := NewSpeechPipeline([]SpeechSynthesis{newFakeStreamSpeechSynthesis()}, DefaultAudioFormat, player)
+	assert.EqualError(t, p.Run(player.next([]string{"ok", "fail", "never"})), "fail")
+	assert.Equal(t, []string{"ok"}, player.played)
+}
+
+func TestStandaloneSpeechPipeline(t *testing.T) {
+	ss := newFakeStreamSpeechSynthesis()
+	p := NewStandaloneSpeechPipeline(ss)
+	p.Subtitles = NewSubtitles()
+	segments := []string{"one", "two"}
+	var i int
+	assert.Nil(t, p.Run(func() string {
+		if i == len(segments) {
+			return ""
+		}
+
+		i++
+		return segments[i-1]
+	}))
+
+	// a cue for each speech
+	cues := p.Subtitles.Cues()
+	assert.Equal(t, 2, len(cues))
+	assert.Equal(t, "two", cues[1].Text)
+}
@@ -0,0 +1,51 @@
+package hal
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// AudioPlayer plays the audio synthesized.
+type AudioPlayer interface {
+	Play(format AudioFormat, audio []byte) error
+}
+
+// AplayPlayer plays the audio on the speaker (Device) by AudioOutput, PCM by aplay (alsa-utils) and MP3 by mpg123.
+type AplayPlayer struct {
+	Device string           // the output device, empty for the default one
+	Echo   *EchoSuppression // the capture hearing the audio played, nil for no suppression
+}
+
+func NewAplayPlayer() (*AplayPlayer, error) {
+	if _, err := exec.LookPath("aplay"); err != nil {
+		return nil, err
+	}
+
+	return &AplayPlayer{}, nil
+}
+
+// Play plays the audio until it ends, only PCM and MP3 (if mpg123 is found) are supported.
+func (p *AplayPlayer) Play(format AudioFormat, audio []byte) error {
+	output, err := NewAudioOutput(format, p.Device, p.Echo)
+	if err != nil {
+		return err
+	}
+
+	_, err = output.Write(audio)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// aplayArgs returns the arguments of aplay reading the audio from stdin, the raw PCM has no header telling
+// its format.
+func aplayArgs(format AudioFormat) []string {
+	args := []string{"-q"}
+	if format.Container == "raw" {
+		args = append(args, "-t", "raw", "-f", "S16_LE", "-c", strconv.Itoa(format.PCM.Channels), "-r", strconv.Itoa(format.PCM.SampleRate))
+	}
+
+	return append(args, "-")
+}
@@ -0,0 +1,192 @@
+package hal
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var ErrProfileNotFound = errors.New("profile not found")
+
+// Profile overrides params for an environment, e.g. work (the openai proxy of the company, English and gpt-4) or
+// home (a personal key, Chinese and gpt-3.5). An empty field keeps the one of params.
+type Profile struct {
+	OpenaiCredential       string // the credential used as openai, e.g. openai-work (in SecretStore, or HAL_OPENAI_WORK)
+	SpeechKeyCredential    string // the credential used as azure-speech-key
+	SpeechRegionCredential string // the credential used as azure-speech-region
+	OpenaiBaseURL          string
+	ChatgptModel           string
+	Language               string // BCP-47 code
+	Voice                  string
+	Keyword                string
+	KeywordModel           string
+	KeywordLanguage        string
+	Hooks                  string // the hooks file in the config dir, e.g. hooks-work.json
+}
+
+// Merge overrides the profile by the non-empty fields of other.
+func (profile *Profile) Merge(other Profile) {
+	v, o := reflect.ValueOf(profile).Elem(), reflect.ValueOf(other)
+	for i := 0; i < v.NumField(); i++ {
+		if field := o.Field(i).String(); field != "" {
+			v.Field(i).SetString(field)
+		}
+	}
+}
+
+// String returns the overrides of the profile, e.g. ChatgptModel=gpt-4, Language=en-US.
+func (profile Profile) String() string {
+	var overrides []string
+	v := reflect.ValueOf(profile)
+	for i := 0; i < v.NumField(); i++ {
+		if field := v.Field(i).String(); field != "" {
+			overrides = append(overrides, v.Type().Field(i).Name+"="+field)
+		}
+	}
+
+	return strings.Join(overrides, ", ")
+}
+
+// overrides pairs the fields of params with the ones of the profile overriding them.
+func (p *Params) overrides(profile *Profile) [][2]*string {
+	return [][2]*string{
+		{&p.OpenaiBaseURL, &profile.OpenaiBaseURL},
+		{&p.ChatgptModel, &profile.ChatgptModel},
+		{&p.Language, &profile.Language},
+		{&p.Voice, &profile.Voice},
+		{&p.Keyword, &profile.Keyword},
+		{&p.KeywordModel, &profile.KeywordModel},
+		{&p.KeywordLanguage, &profile.KeywordLanguage},
+		{&p.Hooks, &profile.Hooks},
+	}
+}
+
+// aliases returns the credentials used by HAL to the ones of the profile.
+func (profile *Profile) aliases() map[string]string {
+	aliases := map[string]string{}
+	for name, alias := range map[string]string{
+		OpenaiCredential:       profile.OpenaiCredential,
+		SpeechKeyCredential:    profile.SpeechKeyCredential,
+		SpeechRegionCredential: profile.SpeechRegionCredential,
+	} {
+		if alias != "" && alias != name {
+			aliases[name] = alias
+		}
+	}
+
+	return aliases
+}
+
+// ProfileNames returns the names of profiles in order.
+func (p Params) ProfileNames() []string {
+	names := make([]string, 0, len(p.Profiles))
+	for name := range p.Profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// ActiveProfile returns the name of the profile used, empty for none.
+func (p Params) ActiveProfile() string {
+	return p.profile
+}
+
+// UseProfile overrides params by the profile, and the credentials by the ones of the profile in SECRETS (set by
+// ResolveSecrets before it). The overrides are not saved in params but in the profile (see SaveParams).
+func (p *Params) UseProfile(name string) error {
+	profile, ok := p.Profiles[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+
+	if p.base != nil {
+		return fmt.Errorf("profile %s is used already", p.profile)
+	}
+
+	base := *p
+	p.base, p.profile = &base, name
+	for _, field := range p.overrides(profile) {
+		if *field[1] != "" {
+			*field[0] = *field[1]
+		}
+	}
+
+	aliases := profile.aliases()
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	SECRETS = AliasSecrets{SecretStore: SECRETS, Aliases: aliases}
+	p.resolved, p.plain = map[string]bool{}, nil
+	for name, field := range p.credentials() {
+		if _, ok := aliases[name]; ok {
+			// the credential in params is of the base, not the profile
+			*field = ""
+		}
+
+		if secret := LookupSecret(name); secret != "" {
+			*field = secret
+			p.resolved[name] = true
+		}
+	}
+
+	return nil
+}
+
+// restoreProfile returns params to be saved, the overrides of profile changed are kept in the profile, the others
+// are saved in params.
+func (p Params) restoreProfile() Params {
+	profile := p.Profiles[p.profile]
+	if p.base == nil || profile == nil {
+		return p
+	}
+
+	base := *p.base
+	for i, field := range p.overrides(profile) {
+		if *field[1] != "" {
+			*field[1] = *field[0]
+			*field[0] = *base.overrides(profile)[i][0]
+		}
+	}
+
+	if len(profile.aliases()) > 0 {
+		p.OpenaiKey, p.SpeechKey, p.SpeechRegion = base.OpenaiKey, base.SpeechKey, base.SpeechRegion
+		p.resolved, p.plain = base.resolved, base.plain
+	}
+
+	p.base, p.profile = nil, ""
+	return p
+}
+
+// CreateProfile adds the profile of name with the overrides, on a copy of the profile from if it is set.
+func (p *Params) CreateProfile(name, from string, overrides Profile) error {
+	if name == "" {
+		return errors.New("profile must have a name")
+	}
+
+	if _, ok := p.Profiles[name]; ok {
+		return fmt.Errorf("profile %s exists already", name)
+	}
+
+	var profile Profile
+	if from != "" {
+		source, ok := p.Profiles[from]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrProfileNotFound, from)
+		}
+
+		profile = *source
+	}
+
+	profile.Merge(overrides)
+	if p.Profiles == nil {
+		p.Profiles = map[string]*Profile{}
+	}
+
+	p.Profiles[name] = &profile
+	return nil
+}
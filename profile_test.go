@@ -0,0 +1,72 @@
+package hal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateProfile(t *testing.T) {
+	p := Params{}
+	assert.Nil(t, p.CreateProfile("home", "", Profile{Language: "zh-CN", ChatgptModel: "gpt-3.5-turbo"}))
+	assert.Nil(t, p.CreateProfile("home2", "home", Profile{Voice: "zh-CN-XiaoxiaoNeural"}))
+	assert.Equal(t, Profile{Language: "zh-CN", ChatgptModel: "gpt-3.5-turbo", Voice: "zh-CN-XiaoxiaoNeural"}, *p.Profiles["home2"])
+	assert.Equal(t, "ChatgptModel=gpt-3.5-turbo, Language=zh-CN", p.Profiles["home"].String())
+	assert.Equal(t, []string{"home", "home2"}, p.ProfileNames())
+
+	assert.NotNil(t, p.CreateProfile("home", "", Profile{}))
+	assert.ErrorIs(t, p.CreateProfile("work", "office", Profile{}), ErrProfileNotFound)
+}
+
+func TestUseProfile(t *testing.T) {
+	dir, err := os.MkdirTemp("./test_data", "profile")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func() { SECRETS = Secrets{EnvSecrets{}} }()
+
+	t.Setenv("OPENAI_API_KEY", "sk-home")
+	t.Setenv("HAL_OPENAI_WORK", "sk-work")
+	p := Params{ChatgptModel: "gpt-3.5-turbo", Language: "zh-CN", Voice: "zh-CN-XiaoxiaoNeural", Profiles: map[string]*Profile{
+		"work": {OpenaiCredential: "openai-work", OpenaiBaseURL: "https://openai.example.com/v1", ChatgptModel: "gpt-4", Language: "en-US", Hooks: "hooks-work.json"},
+	}}
+	assert.Nil(t, p.ResolveSecrets())
+	assert.Equal(t, "sk-home", p.OpenaiKey)
+	assert.ErrorIs(t, p.UseProfile("home"), ErrProfileNotFound)
+
+	assert.Nil(t, p.UseProfile("work"))
+	assert.Equal(t, "work", p.ActiveProfile())
+	assert.Equal(t, "sk-work", p.OpenaiKey)
+	assert.Equal(t, "sk-work", LookupSecret(OpenaiCredential))
+	assert.Equal(t, "gpt-4", p.ChatgptModel)
+	assert.Equal(t, "en-US", p.Language)
+	assert.Equal(t, "zh-CN-XiaoxiaoNeural", p.Voice)
+	assert.Equal(t, "https://openai.example.com/v1", p.OpenaiBaseURL)
+	assert.Equal(t, filepath.Join(DIRS.Config, "hooks-work.json"), p.HooksPath())
+
+	// the changes of the overrides are saved in the profile, the others in params
+	p.Language, p.Voice = "en-GB", "en-GB-SoniaNeural"
+	file := filepath.Join(dir, "params.json")
+	assert.Nil(t, p.SaveParams(file))
+	loaded := Params{}
+	assert.Nil(t, loaded.LoadParams(file))
+	assert.Equal(t, "gpt-3.5-turbo", loaded.ChatgptModel)
+	assert.Equal(t, "zh-CN", loaded.Language)
+	assert.Equal(t, "en-GB-SoniaNeural", loaded.Voice)
+	assert.Equal(t, "", loaded.OpenaiBaseURL)
+	assert.Equal(t, "", loaded.Hooks)
+	assert.Equal(t, "en-GB", loaded.Profiles["work"].Language)
+	assert.Equal(t, "gpt-4", loaded.Profiles["work"].ChatgptModel)
+}
+
+func TestChatGPTsUseModel(t *testing.T) {
+	chatgpts := newChatGPTs()
+	chatgpts.Clients["default"] = &ChatGPT{Model: "gpt-3.5-turbo"}
+	chatgpts.Clients["code"] = &ChatGPT{Model: "gpt-4-32k"}
+
+	// the session set to another model keeps it
+	chatgpts.UseModel("gpt-4", "gpt-3.5-turbo")
+	assert.Equal(t, "gpt-4", chatgpts.Clients["default"].CurrentModel())
+	assert.Equal(t, "gpt-4-32k", chatgpts.Clients["code"].CurrentModel())
+}
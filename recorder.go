@@ -0,0 +1,141 @@
+package hal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+var ErrMixedAudio = errors.New("can't record audio of different formats in one file")
+
+// Recordable is a speech synthesis or recognition can record the audio it speaks or hears.
+type Recordable interface {
+	// Record saves the audio of the following speeches to r, nil to stop recording.
+	Record(r *AudioRecorder)
+}
+
+// Record sets the recorder of v if it is Recordable, and reports whether it is.
+func Record(v interface{}, r *AudioRecorder) bool {
+	if rec, ok := v.(Recordable); ok {
+		rec.Record(r)
+		return true
+	}
+
+	return false
+}
+
+// AudioRecorder keeps the audio of the speeches in a turn, and saves them to a file. The encoded audio (e.g. mp3
+// or ogg) is appended as it is, and the PCM is saved as wav.
+type AudioRecorder struct {
+	mu      sync.Mutex
+	encoded bytes.Buffer
+	ext     string
+	format  PCMFormat
+	pcm     bytes.Buffer
+}
+
+// WriteAudio appends the audio synthesized in format, the wav header is stripped and the PCM is kept.
+func (r *AudioRecorder) WriteAudio(format AudioFormat, data []byte) error {
+	switch format.Container {
+	case "riff":
+		pcmFormat, pcm, err := ReadWav(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+
+		data, err = io.ReadAll(pcm)
+		if err != nil {
+			return err
+		}
+
+		return r.WritePCM(pcmFormat, data)
+	case "raw":
+		return r.WritePCM(format.PCM, data)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pcm.Len() > 0 || (r.encoded.Len() > 0 && r.ext != format.Ext()) {
+		return ErrMixedAudio
+	}
+
+	r.ext = format.Ext()
+	_, err := r.encoded.Write(data)
+	return err
+}
+
+// WritePCM appends the PCM, the format must be the same as the PCM written before.
+func (r *AudioRecorder) WritePCM(format PCMFormat, pcm []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.encoded.Len() > 0 {
+		return ErrMixedAudio
+	}
+
+	if r.pcm.Len() > 0 && r.format != format {
+		return ErrUnsupportedPCM
+	}
+
+	r.format = format
+	_, err := r.pcm.Write(pcm)
+	return err
+}
+
+// Len returns the size of audio recorded.
+func (r *AudioRecorder) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.encoded.Len() + r.pcm.Len()
+}
+
+// Ext returns the extension of file for the audio recorded, .wav for PCM, .mp3 if nothing is recorded.
+func (r *AudioRecorder) Ext() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case r.pcm.Len() > 0:
+		return ".wav"
+	case r.encoded.Len() > 0:
+		return r.ext
+	}
+
+	return DefaultAudioFormat.Ext()
+}
+
+// Save writes the audio recorded to file.
+func (r *AudioRecorder) Save(file string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if r.pcm.Len() > 0 {
+		err = WriteWav(f, r.format, r.pcm.Bytes())
+	} else {
+		_, err = f.Write(r.encoded.Bytes())
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Reset drops the audio recorded.
+func (r *AudioRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.encoded.Reset()
+	r.pcm.Reset()
+}
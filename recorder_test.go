@@ -0,0 +1,75 @@
+package hal
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudioRecorderPCM(t *testing.T) {
+	r := &AudioRecorder{}
+	assert.Nil(t, r.WritePCM(DefaultPCMFormat, pcm16(1, 2)))
+	assert.Nil(t, r.WritePCM(DefaultPCMFormat, pcm16(3)))
+	assert.Equal(t, ErrUnsupportedPCM, r.WritePCM(PCMFormat{SampleRate: 22050, Channels: 1, BitsPerSample: 16}, pcm16(4)))
+	assert.Equal(t, ErrMixedAudio, r.WriteAudio(DefaultAudioFormat, []byte{0xff}))
+
+	// the wav header of riff is stripped
+	var wav bytes.Buffer
+	WriteWav(&wav, DefaultPCMFormat, pcm16(3))
+	riff, _ := ParseAudioFormat("riff-16khz-16bit-mono-pcm")
+	assert.Nil(t, r.WriteAudio(riff, wav.Bytes()))
+	assert.Equal(t, ".wav", r.Ext())
+	assert.Equal(t, 8, r.Len())
+
+	f, err := os.CreateTemp("./test_data", "record*.wav")
+	assert.Nil(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	assert.Nil(t, r.Save(f.Name()))
+	data, err := os.ReadFile(f.Name())
+	assert.Nil(t, err)
+
+	format, audio, err := ReadWav(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultPCMFormat, format)
+	pcm, _ := io.ReadAll(audio)
+	assert.Equal(t, pcm16(1, 2, 3, 3), pcm)
+
+	r.Reset()
+	assert.Equal(t, 0, r.Len())
+}
+
+func TestAudioRecorderEncoded(t *testing.T) {
+	r := &AudioRecorder{}
+	assert.Nil(t, r.WriteAudio(DefaultAudioFormat, []byte("ID3")))
+	assert.Nil(t, r.WriteAudio(DefaultAudioFormat, []byte{0xff, 0xfb}))
+	assert.Equal(t, ErrMixedAudio, r.WritePCM(DefaultPCMFormat, pcm16(1)))
+	ogg, _ := ParseAudioFormat("ogg-24khz-16bit-mono-opus")
+	assert.Equal(t, ErrMixedAudio, r.WriteAudio(ogg, []byte("OggS")))
+	assert.Equal(t, ".mp3", r.Ext())
+
+	f, err := os.CreateTemp("./test_data", "record*.mp3")
+	assert.Nil(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	assert.Nil(t, r.Save(f.Name()))
+	data, err := os.ReadFile(f.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{'I', 'D', '3', 0xff, 0xfb}, data)
+}
+
+func TestRecord(t *testing.T) {
+	r := &AudioRecorder{}
+	sr := &WhisperSpeechRecognition{}
+	assert.True(t, Record(sr, r))
+	sr.SpeechToText(pcm16(1, 2))
+	sr.Result()
+	assert.Equal(t, 4, r.Len())
+
+	assert.False(t, Record(&fakeSpeechRecognition{}, r))
+}
@@ -0,0 +1,247 @@
+package hal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrSecretNotFound = errors.New("secret not found")
+	ErrSecretReadOnly = errors.New("secret store is read only")
+)
+
+// The credentials used by HAL, the sessions of chatgpt reference their keys by name too.
+const (
+	OpenaiCredential       = "openai"
+	SpeechKeyCredential    = "azure-speech-key"
+	SpeechRegionCredential = "azure-speech-region"
+)
+
+// SecretStore keeps the credentials by name.
+type SecretStore interface {
+	// Get returns the secret of name, ErrSecretNotFound if it is not kept.
+	Get(name string) (string, error)
+	// Set keeps the secret of name, empty to remove it.
+	Set(name, secret string) error
+}
+
+// credentialEnv is the environment variables of the credentials used by HAL.
+var credentialEnv = map[string]string{
+	OpenaiCredential:       "OPENAI_API_KEY",
+	SpeechKeyCredential:    "AZURE_SPEECH_KEY",
+	SpeechRegionCredential: "AZURE_SPEECH_REGION",
+}
+
+// SecretEnv returns the environment variable of the credential, e.g. OPENAI_API_KEY for openai, or HAL_WORK_KEY
+// for work-key.
+func SecretEnv(name string) string {
+	if env, ok := credentialEnv[name]; ok {
+		return env
+	}
+
+	return "HAL_" + strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return '_'
+		}
+
+		return unicode.ToUpper(r)
+	}, name)
+}
+
+// EnvSecrets reads the credentials from the environment variables (see SecretEnv).
+type EnvSecrets struct{}
+
+func (EnvSecrets) Get(name string) (string, error) {
+	if secret := os.Getenv(SecretEnv(name)); secret != "" {
+		return secret, nil
+	}
+
+	return "", ErrSecretNotFound
+}
+
+func (EnvSecrets) Set(name, secret string) error {
+	return ErrSecretReadOnly
+}
+
+// KeyFile keeps the credentials in a JSON file (name to secret), which must be accessible by the owner only
+// (0600).
+type KeyFile struct {
+	File string
+}
+
+func (f KeyFile) Get(name string) (string, error) {
+	secrets, err := f.load()
+	if err != nil {
+		return "", err
+	}
+
+	if secret, ok := secrets[name]; ok && secret != "" {
+		return secret, nil
+	}
+
+	return "", ErrSecretNotFound
+}
+
+func (f KeyFile) Set(name, secret string) error {
+	secrets, err := f.load()
+	if err != nil && !errors.Is(err, ErrSecretNotFound) {
+		return err
+	}
+
+	if secrets == nil {
+		secrets = map[string]string{}
+	}
+
+	if secret == "" {
+		delete(secrets, name)
+	} else {
+		secrets[name] = secret
+	}
+
+	data, err := json.MarshalIndent(secrets, "", " ")
+	if err != nil {
+		return err
+	}
+
+	// the temporary file of writeFileAtomic is created in 0600
+	return writeFileAtomic(f.File, data)
+}
+
+// load reads the secrets, ErrSecretNotFound if the file doesn't exist.
+func (f KeyFile) load() (map[string]string, error) {
+	info, err := os.Stat(f.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSecretNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return nil, fmt.Errorf("key file %s is accessible by others (%o), chmod 600 it", f.File, perm)
+	}
+
+	data, err := os.ReadFile(f.File)
+	if err != nil {
+		return nil, err
+	}
+
+	var secrets map[string]string
+	if err = json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("key file %s: %w", f.File, err)
+	}
+
+	return secrets, nil
+}
+
+// KeyringSecrets keeps the credentials in the keyring of the desktop by the secret service (secret-tool of
+// libsecret), with the attributes service=hal and account=<name>.
+type KeyringSecrets struct {
+	Binary string
+}
+
+// NewKeyringSecrets returns the keyring, it fails if secret-tool is not found.
+func NewKeyringSecrets() (*KeyringSecrets, error) {
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyringSecrets{Binary: path}, nil
+}
+
+func (k *KeyringSecrets) Get(name string) (string, error) {
+	out, err := exec.Command(k.Binary, "lookup", "service", "hal", "account", name).Output()
+	secret := strings.TrimRight(string(out), "\n")
+	// secret-tool exits with 1 if nothing found
+	if secret == "" {
+		var exitErr *exec.ExitError
+		if err == nil || errors.As(err, &exitErr) {
+			return "", ErrSecretNotFound
+		}
+
+		return "", err
+	}
+
+	return secret, nil
+}
+
+func (k *KeyringSecrets) Set(name, secret string) error {
+	var cmd *exec.Cmd
+	if secret == "" {
+		cmd = exec.Command(k.Binary, "clear", "service", "hal", "account", name)
+	} else {
+		cmd = exec.Command(k.Binary, "store", "--label", "hal "+name, "service", "hal", "account", name)
+		cmd.Stdin = strings.NewReader(secret)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// Secrets looks up the credentials in the stores one by one, and keeps them in the first writable one.
+type Secrets []SecretStore
+
+func (s Secrets) Get(name string) (string, error) {
+	for _, store := range s {
+		secret, err := store.Get(name)
+		if !errors.Is(err, ErrSecretNotFound) {
+			return secret, err
+		}
+	}
+
+	return "", ErrSecretNotFound
+}
+
+func (s Secrets) Set(name, secret string) error {
+	for _, store := range s {
+		if err := store.Set(name, secret); !errors.Is(err, ErrSecretReadOnly) {
+			return err
+		}
+	}
+
+	return ErrSecretReadOnly
+}
+
+// SECRETS keeps the credentials, it is set from params (see Params.Secrets).
+var SECRETS SecretStore = Secrets{EnvSecrets{}}
+
+// LookupSecret returns the credential of name, empty if it is not found.
+func LookupSecret(name string) string {
+	secret, err := SECRETS.Get(name)
+	if err != nil && !errors.Is(err, ErrSecretNotFound) {
+		tlog.Errorf("credential %s: %s", name, err)
+	}
+
+	return secret
+}
+
+// AliasSecrets looks up and keeps the credentials by their aliases, e.g. openai-work for openai in the profile
+// work, the others by their names.
+type AliasSecrets struct {
+	SecretStore
+	Aliases map[string]string
+}
+
+func (s AliasSecrets) Get(name string) (string, error) {
+	return s.SecretStore.Get(s.alias(name))
+}
+
+func (s AliasSecrets) Set(name, secret string) error {
+	return s.SecretStore.Set(s.alias(name), secret)
+}
+
+func (s AliasSecrets) alias(name string) string {
+	if alias, ok := s.Aliases[name]; ok {
+		return alias
+	}
+
+	return name
+}
@@ -0,0 +1,142 @@
+package hal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretEnv(t *testing.T) {
+	assert.Equal(t, "OPENAI_API_KEY", SecretEnv(OpenaiCredential))
+	assert.Equal(t, "AZURE_SPEECH_REGION", SecretEnv(SpeechRegionCredential))
+	assert.Equal(t, "HAL_OPENAI_WORK", SecretEnv("openai-work"))
+}
+
+func TestKeyFile(t *testing.T) {
+	dir, err := os.MkdirTemp("./test_data", "secrets")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	f := KeyFile{File: filepath.Join(dir, "secrets.json")}
+	_, err = f.Get(OpenaiCredential)
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	assert.Nil(t, f.Set(OpenaiCredential, "sk-1"))
+	assert.Nil(t, f.Set("openai-work", "sk-2"))
+	secret, err := f.Get(OpenaiCredential)
+	assert.Nil(t, err)
+	assert.Equal(t, "sk-1", secret)
+
+	info, err := os.Stat(f.File)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	assert.Nil(t, f.Set("openai-work", ""))
+	_, err = f.Get("openai-work")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	// the file readable by others is refused
+	assert.Nil(t, os.Chmod(f.File, 0o644))
+	_, err = f.Get(OpenaiCredential)
+	assert.NotNil(t, err)
+	assert.False(t, strings.Contains(err.Error(), "sk-1"))
+}
+
+func TestSecrets(t *testing.T) {
+	dir, err := os.MkdirTemp("./test_data", "secrets")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Setenv("OPENAI_API_KEY", "sk-env")
+	f := KeyFile{File: filepath.Join(dir, "secrets.json")}
+	secrets := Secrets{EnvSecrets{}, f}
+
+	// kept in the first writable store, the environment variable is used first
+	assert.Nil(t, secrets.Set(OpenaiCredential, "sk-file"))
+	assert.Nil(t, secrets.Set(SpeechKeyCredential, "azure"))
+	secret, err := secrets.Get(OpenaiCredential)
+	assert.Nil(t, err)
+	assert.Equal(t, "sk-env", secret)
+	secret, err = secrets.Get(SpeechKeyCredential)
+	assert.Nil(t, err)
+	assert.Equal(t, "azure", secret)
+	_, err = secrets.Get(SpeechRegionCredential)
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+	assert.ErrorIs(t, Secrets{EnvSecrets{}}.Set(OpenaiCredential, "sk"), ErrSecretReadOnly)
+}
+
+func TestParamsSecrets(t *testing.T) {
+	dir, err := os.MkdirTemp("./test_data", "secrets")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func() { SECRETS = Secrets{EnvSecrets{}} }()
+
+	t.Setenv("AZURE_SPEECH_REGION", "westus")
+	p := Params{OpenaiKey: "sk-1", SpeechKey: "azure", KeyFile: filepath.Join(dir, "secrets.json")}
+	assert.Nil(t, p.ResolveSecrets())
+	assert.Equal(t, "westus", p.SpeechRegion)
+	// resolving writes nothing
+	assert.NoFileExists(t, p.KeyFile)
+
+	// the keys in params are moved to the key file
+	assert.Nil(t, p.StoreSecrets())
+	assert.FileExists(t, p.KeyFile)
+	file := filepath.Join(dir, "params.json")
+	assert.Nil(t, p.SaveParams(file))
+	data, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "sk-1")
+	assert.NotContains(t, string(data), "westus")
+	assert.NotContains(t, p.String(), "sk-1")
+
+	loaded := Params{}
+	assert.Nil(t, loaded.LoadParams(file))
+	assert.Nil(t, loaded.ResolveSecrets())
+	assert.Equal(t, "sk-1", loaded.OpenaiKey)
+	assert.Equal(t, "azure", loaded.SpeechKey)
+
+	// the sessions reference the keys by name
+	chatgpts := newChatGPTs()
+	chatgpts.Clients["default"] = &ChatGPT{Key: "sk-1"}
+	chatgpts.Clients["work"] = &ChatGPT{Key: "sk-2"}
+	sessions := filepath.Join(dir, "sessions.json")
+	assert.Nil(t, chatgpts.SaveChatGPTs(sessions))
+	chatgpts = newChatGPTs()
+	assert.Nil(t, chatgpts.LoadChatGPTs(sessions))
+	assert.Equal(t, OpenaiCredential, chatgpts.Clients["default"].Credential)
+	assert.Equal(t, "openai-work", chatgpts.Clients["work"].Credential)
+	assert.Equal(t, "sk-2", chatgpts.Clients["work"].APIKey())
+	assert.Nil(t, chatgpts.SaveChatGPTs(sessions))
+	data, err = os.ReadFile(sessions)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "sk-")
+
+	// the key in params overridden by the environment variable is moved to the key file first
+	t.Setenv("OPENAI_API_KEY", "sk-env")
+	p = Params{OpenaiKey: "sk-A", KeyFile: filepath.Join(dir, "secrets-env.json")}
+	assert.Nil(t, p.ResolveSecrets())
+	assert.Equal(t, "sk-env", p.OpenaiKey)
+	assert.Nil(t, p.StoreSecrets())
+	assert.Nil(t, p.SaveParams(file))
+	data, err = os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "sk-A")
+	assert.NotContains(t, string(data), "sk-env")
+	secret, err := KeyFile{File: p.KeyFile}.Get(OpenaiCredential)
+	assert.Nil(t, err)
+	assert.Equal(t, "sk-A", secret)
+
+	// without a key file, it is still saved in params, not the one from the environment variable
+	p = Params{OpenaiKey: "sk-A"}
+	assert.Nil(t, p.ResolveSecrets())
+	assert.Equal(t, "sk-env", p.OpenaiKey)
+	assert.Nil(t, p.StoreSecrets())
+	assert.Nil(t, p.SaveParams(file))
+	data, err = os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "sk-A")
+	assert.NotContains(t, string(data), "sk-env")
+}
@@ -20,18 +20,21 @@ func Initialize(chatGPTModel, language, voice, stopWord string) {
 
 	createSession()
 
-	PARAMS.SpeechKey = getSpeechKey()
-	PARAMS.SpeechRegion = getSpeechRegion()
-	for !checkSpeechKeyAndRegion(PARAMS.SpeechKey, PARAMS.SpeechRegion) {
+	// all speech engines are offline, azure is unnecessary
+	if PARAMS.UseAzure() {
 		PARAMS.SpeechKey = getSpeechKey()
 		PARAMS.SpeechRegion = getSpeechRegion()
+		for !checkSpeechKeyAndRegion(PARAMS.SpeechKey, PARAMS.SpeechRegion) {
+			PARAMS.SpeechKey = getSpeechKey()
+			PARAMS.SpeechRegion = getSpeechRegion()
+		}
 	}
 
 	if language == "" {
 		PARAMS.Language = chooseLanguage()
 	}
 
-	if voice == "" {
+	if voice == "" && (PARAMS.SynthesisEngine == "" || PARAMS.SynthesisEngine == AzureEngine) {
 		PARAMS.Voice = chooseVoice()
 	}
 
@@ -39,8 +42,12 @@ func Initialize(chatGPTModel, language, voice, stopWord string) {
 		PARAMS.StopWord = setStopWord()
 	}
 
+	if err := PARAMS.StoreSecrets(); err != nil {
+		fmt.Printf("keys kept in params.json: %s\n", err)
+	}
+
 	PARAMS.Initialized = true
-	PARAMS.SaveParams("params.json")
+	PARAMS.SaveParams(ConfigPath(ParamsFile))
 }
 
 func getOpenaiKey() string {
@@ -66,7 +73,7 @@ func getOpenaiKey() string {
 }
 
 func CheckOpenaiKey(key string) error {
-	client := openai.NewClient(key)
+	client := newOpenaiClient(key)
 	_, err := client.CreateChatCompletion(
 		context.Background(),
 		openai.ChatCompletionRequest{
@@ -89,14 +96,9 @@ func chooseModel() string {
 		curr = "gpt-3.5-turbo"
 	}
 
-	var choose int
-	for choose < 1 || choose > 6 {
-		fmt.Printf("Please choose a chatGPT model (default %s):\n", curr)
-		fmt.Println("1. gpt-3.5-turbo\n2. gpt-3.5-turbo-0301\n3. gpt-4\n4. gpt-4-0314\n5. gpt-4-32k\n6. gpt-4-32k-0314")
-		choose := readIntFromStdin()
-		if choose == -1 {
-			return curr
-		}
+	choose := DIALOG.Choose(fmt.Sprintf("Please choose a chatGPT model (default %s):", curr), models[1:])
+	if choose < 1 {
+		return curr
 	}
 
 	return models[choose]
@@ -133,7 +135,7 @@ func getSpeechRegion() string {
 }
 
 func checkSpeechKeyAndRegion(key, region string) bool {
-	tempSpeechSynthesis, err := NewAutoDetectedSpeechSynthesisStream(key, region)
+	tempSpeechSynthesis, err := NewAutoDetectedSpeechSynthesisStream(key, region, DefaultAudioFormat)
 	if err != nil {
 		fmt.Printf("When attempt connect to azure use the provided key and region, an error occurred. Please check your key/region or network.\n ERROR: %s\n", err)
 		return false
@@ -182,9 +184,15 @@ func selectLanguage() string {
 		fmt.Println("Language name (BCP-47 format, more details see https://learn.microsoft.com/en-us/azure/cognitive-services/speech-service/language-support?tabs=stt):")
 
 		l = readStringFromStdin()
+		// the language is checked by azure only
+		if PARAMS.RecognitionEngine != "" && PARAMS.RecognitionEngine != AzureEngine {
+			break
+		}
+
 		tempSpeechRecognition, err = NewSpeechRecognitionStream(PARAMS.SpeechKey, PARAMS.SpeechRegion, []string{l})
 		if err != nil {
 			fmt.Println(err)
+			continue
 		}
 
 		tempSpeechRecognition.Close()
@@ -220,7 +228,7 @@ func chooseVoice() string {
 }
 
 func selectVoiceLanguage() string {
-	tempSpeechSynthesis, _ := NewAutoDetectedSpeechSynthesisStream(PARAMS.SpeechKey, PARAMS.SpeechRegion)
+	tempSpeechSynthesis, _ := NewAutoDetectedSpeechSynthesisStream(PARAMS.SpeechKey, PARAMS.SpeechRegion, DefaultAudioFormat)
 	languages := tempSpeechSynthesis.GetAllSupportLanguage()
 	l := "unknown"
 	for !languages[l] {
@@ -233,7 +241,7 @@ func selectVoiceLanguage() string {
 }
 
 func selectVoice(l string) string {
-	tempSpeechSynthesis, _ := NewAutoDetectedSpeechSynthesisStream(PARAMS.SpeechKey, PARAMS.SpeechRegion)
+	tempSpeechSynthesis, _ := NewAutoDetectedSpeechSynthesisStream(PARAMS.SpeechKey, PARAMS.SpeechRegion, DefaultAudioFormat)
 	voices := tempSpeechSynthesis.GetAllSupportVoicesForLanguage(l)
 	fmt.Printf("The supported voices of (%s) are list below. Please choose one:\n", l)
 	fmt.Println(FormatVoices(voices))
@@ -265,60 +273,62 @@ func setStopWord() string {
 func CreateASession() {
 	var name string
 	for name == "" || CHATGPTS.Clients[name] != nil {
-		fmt.Println("Please give a session name (case insensitive):")
-		name = strings.ToLower(readStringFromStdin())
+		answer, ok := DIALOG.Ask("Please give a session name (case insensitive):")
+		if !ok {
+			return
+		}
+
+		name = strings.ToLower(answer)
 		if name == "" {
-			fmt.Println("Can not be empty. Please input again.")
+			DIALOG.Say("Can not be empty. Please input again.")
 		} else if CHATGPTS.Clients[name] != nil {
-			fmt.Println("Session exist. Please choose other name.")
+			DIALOG.Say("Session exist. Please choose other name.")
 		}
-
 	}
 
-	fmt.Println("What do you want chatgpt to do?")
-	desc := readStringFromStdin()
+	desc, _ := DIALOG.Ask("What do you want chatgpt to do?")
 
-	gpt := CHATGPTS.NewSessionWithName(name, PARAMS.OpenaiKey, PARAMS.ChatgptModel)
+	gpt := CHATGPTS.NewSessionWithName(name, OpenaiCredential, PARAMS.ChatgptModel)
 	if desc != "" {
 		gpt.SetRole(desc)
 	}
 
 	CHATGPTS.SetDefaultGPT(name)
-	CHATGPTS.SaveChatGPTs("sessions.json")
+	CHATGPTS.SaveChatGPTs(ConfigPath(SessionsFile))
 }
 
 func createSession() {
-	choice := "unknown"
-	for choice != "n" && choice != "no" && choice != "y" && choice != "yes" {
-		fmt.Println("Do you want to create a session to tell what you want chatgpt to do? (yes/no)")
-		choice = strings.ToLower(readStringFromStdin())
-	}
-
-	if choice == "n" || choice == "no" {
+	if !DIALOG.Confirm("Do you want to create a session to tell what you want chatgpt to do?") {
 		return
 	}
 
 	CreateASession()
 }
 
-func SelectSession() {
-	sessions := CHATGPTS.SessionsWithout("hooks")
-	sessionList := listSessionWithIndex(sessions)
-
+// chooseSession asks user to choose one of sessions, return 0 if user cancelled.
+func chooseSession(question string, sessions []string) int {
 	var idx int
-	for idx < 1 || idx > len(sessions) {
-		fmt.Println("Please select a session to start (0 for quit):")
-		fmt.Println(sessionList)
-		idx = readIntFromStdin()
+	for idx < 1 {
+		idx = DIALOG.Choose(question, sessionOptions(sessions))
 		if idx == 0 {
-			return
+			return 0
 		}
 	}
 
-	fmt.Println("Ok, it selected. List current sessions:")
+	return idx
+}
+
+func SelectSession() {
+	sessions := CHATGPTS.SessionsWithout("hooks")
+	idx := chooseSession("Please select a session to start (0 for quit):", sessions)
+	if idx == 0 {
+		return
+	}
+
+	DIALOG.Say("Ok, it selected. List current sessions:")
 	ListSessions()
 	CHATGPTS.SetDefaultGPT(sessions[idx-1])
-	CHATGPTS.SaveChatGPTs("sessions.json")
+	CHATGPTS.SaveChatGPTs(ConfigPath(SessionsFile))
 }
 
 func ListSessions() {
@@ -341,44 +351,28 @@ func ListSessions() {
 	}
 }
 
-func listSessionWithIndex(sessions []string) string {
-	var b strings.Builder
-	for i, session := range sessions {
+func sessionOptions(sessions []string) []string {
+	res := make([]string, 0, len(sessions))
+	for _, session := range sessions {
 		var d string
 		if CHATGPTS.Clients[session].IsDefault {
 			d = "[default] "
 		}
 
-		b.WriteString(fmt.Sprintf("%d. %s%s", i+1, d, session))
-		if i != len(sessions)-1 {
-			b.WriteByte('\n')
-		}
+		res = append(res, d+session)
 	}
 
-	return b.String()
+	return res
 }
 
 func DeleteSession() {
 	sessions := CHATGPTS.SessionsWithout("hooks")
-	sessionList := listSessionWithIndex(sessions)
-
-	var idx int
-	for idx < 1 || idx > len(sessions) {
-		fmt.Println("Please select a session to delete (0 for quit):")
-		fmt.Println(sessionList)
-		idx = readIntFromStdin()
-		if idx == 0 {
-			return
-		}
-	}
-
-	choice := "unknown"
-	for choice != "n" && choice != "no" && choice != "y" && choice != "yes" {
-		fmt.Println("Are you sure delete this session (yes/no)")
-		choice = strings.ToLower(readStringFromStdin())
+	idx := chooseSession("Please select a session to delete (0 for quit):", sessions)
+	if idx == 0 {
+		return
 	}
 
-	if choice == "n" || choice == "no" {
+	if !DIALOG.Confirm("Are you sure delete this session?") {
 		return
 	}
 
@@ -388,84 +382,162 @@ func DeleteSession() {
 	if session.IsDefault && len(sessions) > 1 {
 		// remove the session will be deleted.
 		sessions = append(sessions[:idx-1], sessions[idx:]...)
-		sessionList = listSessionWithIndex(sessions)
 
 		var idx int
-		for idx < 1 || idx > len(sessions) {
-			fmt.Println("The session to be deleted is default, if you want to delete it, please select another session as default:")
-			fmt.Println(sessionList)
-			idx = readIntFromStdin()
+		for idx < 1 {
+			idx = DIALOG.Choose("The session to be deleted is default, if you want to delete it, please select another session as default:", sessionOptions(sessions))
+			if idx == 0 {
+				return
+			}
 		}
 
 		CHATGPTS.SetDefaultGPT(sessions[idx-1])
 	}
 	delete(CHATGPTS.Clients, name)
-	fmt.Println("Ok, it deleted. List current sessions:")
+	DIALOG.Say("Ok, it deleted. List current sessions:")
 	ListSessions()
 
-	CHATGPTS.SaveChatGPTs("sessions.json")
+	CHATGPTS.SaveChatGPTs(ConfigPath(SessionsFile))
 }
 
+var configItems = []string{"name", "model", "key", "description", "prosody"}
+
+var speakingRates = []string{"x-slow", "slow", "medium", "fast", "x-fast"}
+
 func ConfigSession() {
 	sessions := CHATGPTS.SessionsWithout("hooks")
-	sessionList := listSessionWithIndex(sessions)
-
-	var idx int
-	for idx < 1 || idx > len(sessions) {
-		fmt.Println("Please select a session to config (0 for quit):")
-		fmt.Println(sessionList)
-		idx = readIntFromStdin()
-		if idx == 0 {
-			return
-		}
+	idx := chooseSession("Please select a session to config (0 for quit):", sessions)
+	if idx == 0 {
+		return
 	}
 
 	name := sessions[idx-1]
 	session := CHATGPTS.Clients[name]
-	var key string
-	for key != "q" {
-		fmt.Println("Press enter the key to config. q for quit")
+	for {
 		var content string
 		if session.System != nil {
 			content = session.System.Content
 		}
-		fmt.Printf("(N)ame: %s, (M)odel: %s, (K)ey: %s, (D)escription: %s", name, session.Model, session.Key, content)
-		key = readStringFromStdin()
 
-		if key == "" {
-			continue
+		DIALOG.Say(fmt.Sprintf("Name: %s, Model: %s, Key: %s, Description: %s", name, session.Model, maskKey(session.APIKey()), content))
+		item := DIALOG.Choose("Which one do you want to config? (0 for quit)", configItems)
+		if item == 0 {
+			break
 		}
 
-		key = strings.ToLower(key)
-		if key == "n" {
+		switch item {
+		case 1:
 			var newName string
 			var exist bool
 			for newName == "" || exist {
-				fmt.Println("Enter the new name:")
-				newName = readStringFromStdin()
+				answer, ok := DIALOG.Ask("Enter the new name:")
+				if !ok {
+					break
+				}
+
+				newName = strings.ToLower(answer)
 				_, exist = CHATGPTS.Clients[newName]
 				if exist {
-					fmt.Printf("%s exist. Please choose new name.\n", newName)
+					DIALOG.Say(fmt.Sprintf("%s exist. Please choose new name.", newName))
 				}
 			}
 
-			CHATGPTS.RenameSession(name, newName)
-		} else if key == "m" {
+			if newName != "" && !exist {
+				CHATGPTS.RenameSession(name, newName)
+				name = newName
+			}
+		case 2:
 			session.Model = chooseModel()
-		} else if key == "k" {
-			session.Key = getOpenaiKey()
-		} else if key == "d" {
-			fmt.Println("What do you want chatgpt to do?")
-			session.System.Content = readStringFromStdin()
+		case 3:
+			setSessionKey(name, session, getOpenaiKey())
+		case 4:
+			if desc, ok := DIALOG.Ask("What do you want chatgpt to do?"); ok {
+				session.SetRole(desc)
+			}
+		case 5:
+			configProsody(session)
+		}
+	}
+
+	DIALOG.Say("Ok, it configured.")
+	CHATGPTS.SaveChatGPTs(ConfigPath(SessionsFile))
+}
+
+// configProsody sets how the answers of session are spoken, the styles are the ones of the voice.
+func configProsody(session *ChatGPT) {
+	var prosody Prosody
+	if session.Prosody != nil {
+		prosody = *session.Prosody
+	}
+
+	styles := voiceStyles(PARAMS.Voice)
+	if len(styles) > 0 {
+		idx := DIALOG.Choose("Which style do you want the answers spoken in? (0 for default)", styles)
+		if idx == 0 {
+			prosody.Style = ""
+		} else if idx > 0 {
+			prosody.Style = styles[idx-1]
 		}
 	}
 
-	fmt.Println("Ok, it configured.")
-	CHATGPTS.SaveChatGPTs("sessions.json")
+	idx := DIALOG.Choose("How fast do you want the answers spoken? (0 for default)", speakingRates)
+	if idx == 0 {
+		prosody.Rate = ""
+	} else if idx > 0 {
+		prosody.Rate = speakingRates[idx-1]
+	}
+
+	session.Prosody = &prosody
+	if prosody.IsZero() {
+		session.Prosody = nil
+	}
+}
+
+// voiceStyles returns the speaking styles of the azure voice.
+func voiceStyles(voice string) []string {
+	if voice == "" || (PARAMS.SynthesisEngine != "" && PARAMS.SynthesisEngine != AzureEngine) {
+		return nil
+	}
+
+	tempSpeechSynthesis, err := NewAutoDetectedSpeechSynthesisStream(PARAMS.SpeechKey, PARAMS.SpeechRegion, DefaultAudioFormat)
+	if err != nil {
+		return nil
+	}
+
+	defer tempSpeechSynthesis.Close()
+	for _, v := range tempSpeechSynthesis.GetAllSupportVoicesForLanguage(voiceLanguage(voice)) {
+		if v.Name == voice {
+			return v.StyleList
+		}
+	}
+
+	return nil
+}
+
+// setSessionKey references the key by the credential openai if it is the same key, or keeps it in SECRETS as
+// openai-<session>. The key is saved in the session if it can't be kept.
+func setSessionKey(name string, session *ChatGPT, key string) {
+	session.Credential, session.Key = "", key
+	migrateSessionKey(name, session)
+	session.client = newOpenaiClient(session.APIKey())
+}
+
+// maskKey hides the most part of key, which avoid it be spoken or shown fully.
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+
+	return key[:3] + "..." + key[len(key)-4:]
 }
 
 func Showkeyword() {
-	fmt.Printf("Keyword: %s, Language: %s, Path: %s\n", PARAMS.Keyword, PARAMS.KeywordLanguage, PARAMS.KeywordModel)
+	engine := PARAMS.WakeWordEngine
+	if engine == "" {
+		engine = AzureEngine
+	}
+
+	fmt.Printf("Keyword: %s, Language: %s, Path: %s, Engine: %s\n", PARAMS.Keyword, PARAMS.KeywordLanguage, PARAMS.KeywordModel, engine)
 }
 
 var input = io.Reader(os.Stdin)
@@ -0,0 +1,380 @@
+package hal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpeechCache saves the speeches synthesized on disk, so the repeated ones (e.g. the confirmations of hooks and
+// greetings) are played without synthesizing again. A speech is saved as the audio file and its metadata
+// (<key>.json, the word boundaries and duration), the least recently used ones are removed when the files exceed
+// MaxSize.
+type SpeechCache struct {
+	Dir     string
+	MaxSize int64 // bytes, 0 for no limit
+
+	mu sync.Mutex
+}
+
+type cachedSpeech struct {
+	Format   string
+	Text     string
+	Words    []*WordBoundery
+	Duration time.Duration
+}
+
+func NewSpeechCache(dir string, maxSize int64) (*SpeechCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &SpeechCache{Dir: dir, MaxSize: maxSize}, nil
+}
+
+// SpeechCacheKey returns the key of the text (or SSML) spoken by the voice in the format.
+func SpeechCacheKey(voice string, format AudioFormat, ssml bool, text string) string {
+	kind := "text"
+	if ssml {
+		kind = "ssml"
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{voice, format.Name, kind, text}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the speech of key, and marks it as used.
+func (c *SpeechCache) Get(key string) (*SynthesizedSpeech, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	meta := filepath.Join(c.Dir, key+".json")
+	data, err := os.ReadFile(meta)
+	if err != nil {
+		return nil, false
+	}
+
+	var cached cachedSpeech
+	if err = json.Unmarshal(data, &cached); err != nil {
+		tlog.Errorf("speech cache %s: %s", key, err)
+		return nil, false
+	}
+
+	format, err := ParseAudioFormat(cached.Format)
+	if err != nil {
+		return nil, false
+	}
+
+	audio, err := os.ReadFile(filepath.Join(c.Dir, key+format.Ext()))
+	if err != nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(meta, now, now)
+	return &SynthesizedSpeech{Text: cached.Text, Audio: audio, Words: cached.Words, Duration: cached.Duration}, true
+}
+
+// Put saves the speech of key in format, and removes the least recently used speeches if the cache is full.
+func (c *SpeechCache) Put(key string, format AudioFormat, speech *SynthesizedSpeech) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.Marshal(cachedSpeech{Format: format.Name, Text: speech.Text, Words: speech.Words, Duration: speech.Duration})
+	if err != nil {
+		return err
+	}
+
+	// the metadata is written at last, a speech without it is never read
+	if err = writeFileAtomic(filepath.Join(c.Dir, key+format.Ext()), speech.Audio); err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(filepath.Join(c.Dir, key+".json"), data); err != nil {
+		return err
+	}
+
+	return c.evict()
+}
+
+// Size returns the bytes of the files in cache.
+func (c *SpeechCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var size int64
+	for _, e := range c.entries() {
+		size += e.size
+	}
+
+	return size
+}
+
+type speechCacheEntry struct {
+	files []string
+	size  int64
+	used  time.Time
+}
+
+func (c *SpeechCache) entries() map[string]*speechCacheEntry {
+	files, _ := os.ReadDir(c.Dir)
+	entries := map[string]*speechCacheEntry{}
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil || f.IsDir() {
+			continue
+		}
+
+		// the temporary files being written (see writeFileAtomic) are not entries
+		name := f.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		key := strings.TrimSuffix(name, filepath.Ext(name))
+		e := entries[key]
+		if e == nil {
+			e = &speechCacheEntry{}
+			entries[key] = e
+		}
+
+		e.files = append(e.files, filepath.Join(c.Dir, name))
+		e.size += info.Size()
+		if filepath.Ext(name) == ".json" {
+			e.used = info.ModTime()
+		}
+	}
+
+	return entries
+}
+
+func (c *SpeechCache) evict() error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	var size int64
+	var lru []*speechCacheEntry
+	for _, e := range c.entries() {
+		size += e.size
+		lru = append(lru, e)
+	}
+
+	// the ones without metadata are never used
+	sort.Slice(lru, func(i, j int) bool {
+		return lru[i].used.Before(lru[j].used)
+	})
+
+	for _, e := range lru {
+		if size <= c.MaxSize {
+			break
+		}
+
+		for _, f := range e.files {
+			if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+
+		size -= e.size
+	}
+
+	return nil
+}
+
+// CachedSpeechSynthesis is the speech synthesis reads the speeches from cache, and saves the ones synthesized by
+// the wrapped speech synthesis (which outputs audio by Result) into the cache. With a player, the speeches are
+// played on speaker like a standalone speech synthesis, the words from Result are spoken while playing.
+type CachedSpeechSynthesis struct {
+	ss       SpeechSynthesis
+	cache    *SpeechCache
+	voice    string // the engine and voice of ss, e.g. azure/en-US-JennyNeural
+	format   AudioFormat
+	player   AudioPlayer
+	recorder *AudioRecorder
+
+	key     string
+	speech  *SynthesizedSpeech // read from cache, or synthesized before playing
+	pending *SynthesizedSpeech // synthesizing by ss
+	word    int                // the next word of speech from Result
+	sent    bool               // whether the audio of speech is from Result
+	played  chan error
+	err     error
+}
+
+// NewCachedSpeechSynthesis wraps ss outputs audio in format, player is nil to output the audio by Result.
+func NewCachedSpeechSynthesis(ss SpeechSynthesis, cache *SpeechCache, voice string, format AudioFormat, player AudioPlayer) *CachedSpeechSynthesis {
+	return &CachedSpeechSynthesis{ss: ss, cache: cache, voice: voice, format: format, player: player}
+}
+
+func (s *CachedSpeechSynthesis) TextToSpeech(text string) error {
+	return s.speak(false, text, func() error {
+		return s.ss.TextToSpeech(text)
+	})
+}
+
+// SSMLToSpeech speaks ssml if the wrapped speech synthesis can.
+func (s *CachedSpeechSynthesis) SSMLToSpeech(ssml string) error {
+	ss, ok := s.ss.(SSMLSpeechSynthesis)
+	if !ok {
+		return errors.New("speech synthesis can't speak SSML")
+	}
+
+	return s.speak(true, ssml, func() error {
+		return ss.SSMLToSpeech(ssml)
+	})
+}
+
+// VoiceName is the voice of the wrapped speech synthesis, empty if it can't speak SSML.
+func (s *CachedSpeechSynthesis) VoiceName() string {
+	if ss, ok := s.ss.(SSMLSpeechSynthesis); ok {
+		return ss.VoiceName()
+	}
+
+	return ""
+}
+
+func (s *CachedSpeechSynthesis) speak(ssml bool, text string, synthesize func() error) error {
+	s.key = SpeechCacheKey(s.voice, s.format, ssml, text)
+	s.speech, s.pending, s.word, s.sent, s.played, s.err = nil, nil, 0, false, nil, nil
+	if speech, ok := s.cache.Get(s.key); ok {
+		tlog.Debugf("speech cache hit: %s", text)
+		s.speech = speech
+	} else {
+		if err := synthesize(); err != nil {
+			return err
+		}
+
+		s.pending = &SynthesizedSpeech{Text: text}
+		if s.player == nil {
+			return nil
+		}
+
+		// synthesized before playing, so the words are spoken when they are from Result
+		if err := s.collect(); err != nil {
+			return err
+		}
+	}
+
+	s.record(s.speech)
+	if s.player != nil {
+		played := make(chan error, 1)
+		s.played = played
+		go func(audio []byte) {
+			played <- s.player.Play(s.format, audio)
+		}(s.speech.Audio)
+	}
+
+	return nil
+}
+
+// collect reads the speech synthesizing to the end, and saves it.
+func (s *CachedSpeechSynthesis) collect() error {
+	_, _, err := s.Result()
+	for ; err == nil; _, _, err = s.Result() {
+	}
+
+	if !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return s.Error()
+}
+
+func (s *CachedSpeechSynthesis) Result() (*WordBoundery, []byte, error) {
+	if s.pending != nil {
+		w, audio, err := s.ss.Result()
+		if w != nil {
+			s.pending.Words = append(s.pending.Words, w)
+		}
+
+		s.pending.Audio = append(s.pending.Audio, audio...)
+		return w, audio, err
+	}
+
+	if s.speech == nil {
+		return nil, nil, io.EOF
+	}
+
+	if s.word < len(s.speech.Words) {
+		s.word++
+		return s.speech.Words[s.word-1], nil, nil
+	}
+
+	if s.player == nil && !s.sent {
+		s.sent = true
+		return nil, s.speech.Audio, nil
+	}
+
+	if s.played != nil {
+		s.err = <-s.played
+		s.played = nil
+	}
+
+	return nil, nil, io.EOF
+}
+
+// Error returns the error of synthesis or playing, the speech synthesized is saved if no error.
+func (s *CachedSpeechSynthesis) Error() error {
+	if s.pending == nil {
+		return s.err
+	}
+
+	speech := s.pending
+	s.pending = nil
+	if err := s.ss.Error(); err != nil {
+		return err
+	}
+
+	speech.Duration = SpeechDuration(s.ss)
+	if err := s.cache.Put(s.key, s.format, speech); err != nil {
+		tlog.Errorf("speech cache: %s", err)
+	}
+
+	if s.player == nil {
+		s.record(speech)
+	} else {
+		s.speech = speech
+	}
+
+	return nil
+}
+
+// Format is the format of audio from Result.
+func (s *CachedSpeechSynthesis) Format() AudioFormat {
+	return s.format
+}
+
+func (s *CachedSpeechSynthesis) AudioDuration() time.Duration {
+	if s.speech != nil {
+		return s.speech.Duration
+	}
+
+	return SpeechDuration(s.ss)
+}
+
+func (s *CachedSpeechSynthesis) Record(r *AudioRecorder) {
+	s.recorder = r
+}
+
+func (s *CachedSpeechSynthesis) Close() error {
+	return s.ss.Close()
+}
+
+func (s *CachedSpeechSynthesis) record(speech *SynthesizedSpeech) {
+	if s.recorder == nil || speech == nil {
+		return
+	}
+
+	if err := s.recorder.WriteAudio(s.format, speech.Audio); err != nil {
+		tlog.Errorf("record speech: %s", err)
+	}
+}
@@ -0,0 +1,106 @@
+package hal
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpeechCache(t *testing.T) {
+	dir := filepath.Join("test_data", "speech_cache")
+	defer os.RemoveAll(dir)
+	cache, err := NewSpeechCache(dir, 0)
+	assert.Nil(t, err)
+
+	format := DefaultAudioFormat
+	key := SpeechCacheKey("azure/en-US-JennyNeural", format, false, "Harold here.")
+	assert.NotEqual(t, key, SpeechCacheKey("azure/en-US-JennyNeural", format, true, "Harold here."))
+	assert.NotEqual(t, key, SpeechCacheKey("azure/en-US-GuyNeural", format, false, "Harold here."))
+	_, ok := cache.Get(key)
+	assert.False(t, ok)
+
+	speech := &SynthesizedSpeech{Text: "Harold here.", Audio: []byte("audio"), Words: []*WordBoundery{{Text: "Harold"}}, Duration: time.Second}
+	assert.Nil(t, cache.Put(key, format, speech))
+	cached, ok := cache.Get(key)
+	assert.True(t, ok)
+	assert.Equal(t, speech, cached)
+	assert.FileExists(t, filepath.Join(dir, key+".mp3"))
+}
+
+func TestSpeechCacheEviction(t *testing.T) {
+	dir := filepath.Join("test_data", "speech_cache")
+	defer os.RemoveAll(dir)
+	cache, err := NewSpeechCache(dir, 0)
+	assert.Nil(t, err)
+
+	audio := make([]byte, 1000)
+	for i, text := range []string{"one", "two", "three"} {
+		assert.Nil(t, cache.Put(text, DefaultAudioFormat, &SynthesizedSpeech{Text: text, Audio: audio}))
+		used := time.Now().Add(time.Duration(i-10) * time.Second)
+		assert.Nil(t, os.Chtimes(filepath.Join(dir, text+".json"), used, used))
+	}
+
+	// the temporary file being written is not an entry
+	size := cache.Size()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, ".five.wav.123"), audio, 0o600))
+	assert.Equal(t, size, cache.Size())
+
+	// "one" is used recently, so "two" is the least recently used
+	_, ok := cache.Get("one")
+	assert.True(t, ok)
+	cache.MaxSize = cache.Size() - 1
+	assert.Nil(t, cache.Put("four", DefaultAudioFormat, &SynthesizedSpeech{Text: "four"}))
+	_, ok = cache.Get("two")
+	assert.False(t, ok)
+	for _, key := range []string{"one", "three", "four"} {
+		_, ok = cache.Get(key)
+		assert.True(t, ok, key)
+	}
+
+	assert.LessOrEqual(t, cache.Size(), cache.MaxSize)
+}
+
+func TestCachedSpeechSynthesis(t *testing.T) {
+	dir := filepath.Join("test_data", "speech_cache")
+	defer os.RemoveAll(dir)
+	cache, err := NewSpeechCache(dir, 0)
+	assert.Nil(t, err)
+
+	fake := newFakeStreamSpeechSynthesis()
+	ss := NewCachedSpeechSynthesis(fake, cache, "fake", DefaultAudioFormat, nil)
+	p := NewSpeechPipeline([]SpeechSynthesis{ss}, DefaultAudioFormat, &fakeAudioPlayer{})
+	speech, err := p.synthesize(ss, "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(speech.Audio))
+
+	// read from cache, fake is not called
+	ss = NewCachedSpeechSynthesis(nil, cache, "fake", DefaultAudioFormat, nil)
+	recorder := &AudioRecorder{}
+	ss.Record(recorder)
+	cached, err := p.synthesize(ss, "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, speech.Audio, cached.Audio)
+	assert.Equal(t, speech.Words, cached.Words)
+	assert.Equal(t, 5, recorder.Len())
+
+	player := &fakeAudioPlayer{}
+	ss = NewCachedSpeechSynthesis(fake, cache, "fake", DefaultAudioFormat, player)
+	for _, text := range []string{"hello", "bye"} {
+		assert.Nil(t, ss.TextToSpeech(text))
+		w, audio, err := ss.Result()
+		assert.Nil(t, err)
+		assert.Nil(t, audio)
+		assert.Equal(t, text, w.Text)
+		_, _, err = ss.Result()
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Nil(t, ss.Error())
+	}
+
+	assert.Equal(t, []string{"hello", "bye"}, player.played)
+	_, ok := cache.Get(SpeechCacheKey("fake", DefaultAudioFormat, false, "bye"))
+	assert.True(t, ok)
+}
@@ -1,8 +1,11 @@
 package hal
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Microsoft/cognitive-services-speech-sdk-go/audio"
@@ -10,43 +13,196 @@ import (
 	"github.com/Microsoft/cognitive-services-speech-sdk-go/speech"
 )
 
-var (
-	ErrSpeechRecognitionTimeout                    = errors.New("speech recognition get result timeout")
-	MaxSpeechRecognitionDelay                      = time.Duration(30)
-	SegmentationSilenceTimeoutMs                   = "1500" //1.5s
-	SpeechServiceConnectionInitialSilenceTimeoutMs = "5000" //5s
-)
+var ErrSpeechRecognitionTimeout = errors.New("speech recognition get result timeout")
 
 type SpeechRecognition interface {
 	Start() error
 	SpeechToText(data []byte) error
-	Result() (string, error)
+	Result() (RecognitionResult, error)
+	Close() error
+}
+
+// ContinuousSpeechRecognition recognizes the pushed audio continuously until the audio stream is closed.
+type ContinuousSpeechRecognition interface {
+	StartContinuous() error
+	SpeechToText(data []byte) error
+	// CloseStream tells that no more audio will be pushed.
+	CloseStream() error
+	// Recognized returns the results, it is closed after all audio recognized.
+	Recognized() <-chan RecognitionResult
+	// StopContinuous stops the recognition, and returns the error occurred in recognizing.
+	StopContinuous() error
 	Close() error
 }
 
+// SpeechDetection is a speech recognition knows whether somebody is speaking before the speech is recognized, e.g.
+// by its voice activity detector.
+type SpeechDetection interface {
+	// Speaking reports whether the speech is heard and not ended.
+	Speaking() bool
+}
+
+// TimeoutsSetting is a speech recognition keeps its own timeouts, so they can be changed (e.g. to the ones of the
+// language detected) without affecting the others.
+type TimeoutsSetting interface {
+	SetTimeouts(t Timeouts) error
+}
+
+// SetTimeouts sets the timeouts of sr if it keeps its own, otherwise does nothing.
+func SetTimeouts(sr SpeechRecognition, t Timeouts) error {
+	if s, ok := sr.(TimeoutsSetting); ok {
+		return s.SetTimeouts(t)
+	}
+
+	return nil
+}
+
+// speechTimeouts keeps the timeouts of a speech recognition, they are TIMEOUTS until set, and can be changed
+// while it is recognizing.
+type speechTimeouts struct {
+	mu sync.Mutex
+	t  *Timeouts
+}
+
+func (s *speechTimeouts) SetTimeouts(t Timeouts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.t = &t
+	return nil
+}
+
+func (s *speechTimeouts) timeouts() Timeouts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.t == nil {
+		return TIMEOUTS
+	}
+
+	return *s.t
+}
+
+// timeoutsOf returns the timeouts of sr, TIMEOUTS if it doesn't keep its own.
+func timeoutsOf(sr interface{}) Timeouts {
+	if s, ok := sr.(interface{ timeouts() Timeouts }); ok {
+		return s.timeouts()
+	}
+
+	return TIMEOUTS
+}
+
+// isSpeaking reports whether sr hears the speech, false if it doesn't know.
+func isSpeaking(sr interface{}) bool {
+	d, ok := sr.(SpeechDetection)
+	return ok && d.Speaking()
+}
+
+// RecognitionResult is a recognized piece of speech, the offset is from the beginning of audio.
+// An interim result (not final) is the hypothesis while speaking, it will be replaced by later results.
+type RecognitionResult struct {
+	Text       string
+	Offset     time.Duration
+	Duration   time.Duration
+	Language   string  // BCP-47 code, empty if unknown
+	Confidence float64 // 0 to 1, 0 if unknown
+	NBest      []RecognitionAlternative
+	Final      bool
+}
+
+// RecognitionAlternative is a possible text of the speech, the best one is the text of result.
+type RecognitionAlternative struct {
+	Text       string
+	Confidence float64
+}
+
+func newRecognitionResult(result *speech.SpeechRecognitionResult, final bool) RecognitionResult {
+	res := RecognitionResult{
+		Text:     result.Text,
+		Offset:   result.Offset,
+		Duration: result.Duration,
+		Final:    final,
+	}
+
+	if result.Properties != nil {
+		res.Language = result.Properties.GetProperty(common.SpeechServiceConnectionAutoDetectSourceLanguageResult, "")
+		parseDetailedResult(result.Properties.GetProperty(common.SpeechServiceResponseJSONResult, ""), &res)
+	}
+
+	return res
+}
+
+// detailedResult is the json of recognition result in detailed output format.
+type detailedResult struct {
+	PrimaryLanguage struct {
+		Language string
+	}
+	NBest []struct {
+		Confidence float64
+		Display    string
+	}
+}
+
+// parseDetailedResult fills the confidence, alternatives and language (if not detected yet) from the json result.
+func parseDetailedResult(data string, res *RecognitionResult) {
+	if data == "" {
+		return
+	}
+
+	var detailed detailedResult
+	if err := json.Unmarshal([]byte(data), &detailed); err != nil {
+		tlog.Warningf("detailed result: %s", err)
+		return
+	}
+
+	if res.Language == "" {
+		res.Language = detailed.PrimaryLanguage.Language
+	}
+
+	for _, alternative := range detailed.NBest {
+		res.NBest = append(res.NBest, RecognitionAlternative{Text: alternative.Display, Confidence: alternative.Confidence})
+	}
+
+	if len(res.NBest) > 0 {
+		res.Confidence = res.NBest[0].Confidence
+	}
+}
+
 type SpeechRecognitionStream struct {
 	audioConfig      *audio.AudioConfig
 	speechConfig     *speech.SpeechConfig
 	languageConfig   *speech.AutoDetectSourceLanguageConfig
 	speechRecognizer *speech.SpeechRecognizer
 	audioInputStream *audio.PushAudioInputStream
+	phraseList       *speech.PhraseListGrammar
 	result           speechRecognitionResult
+	recorder         *AudioRecorder
+	speechTimeouts
+
+	mu      sync.Mutex     // guards the results of continuous recognition from the handlers
+	stopped bool           // the session of continuous recognition is stopped, and the results are closed
+	done    chan struct{}  // closed when stopped, so the handlers don't wait for the results to be read
+	sending sync.WaitGroup // the handlers sending the results, the results are closed after them
 }
 
 type speechRecognitionResult struct {
-	text      chan string
-	finished  chan bool
-	cancelled chan error
-	outcome   chan speech.SpeechRecognitionOutcome
+	text       chan string
+	finished   chan bool
+	cancelled  chan error
+	outcome    chan speech.SpeechRecognitionOutcome
+	recognized chan RecognitionResult // only for continuous recognition
+	err        error
 }
 
-func (s speechRecognitionResult) GetResult() (string, error) {
+func (s speechRecognitionResult) GetResult(delay time.Duration) (RecognitionResult, error) {
 	select {
 	case res := <-s.outcome:
 		defer res.Close()
-		return res.Result.Text, res.Error
-	case <-time.After(MaxSpeechRecognitionDelay * time.Second):
-		return "", ErrSpeechRecognitionTimeout
+		if res.Error != nil {
+			return RecognitionResult{}, res.Error
+		}
+
+		return newRecognitionResult(res.Result, true), nil
+	case <-time.After(delay):
+		return RecognitionResult{}, ErrSpeechRecognitionTimeout
 	}
 }
 
@@ -65,8 +221,10 @@ func newSpeechConfig(key, region string) (*speech.SpeechConfig, error) {
 		return nil, err
 	}
 
-	speechConfig.SetProperty(common.SegmentationSilenceTimeoutMs, SegmentationSilenceTimeoutMs)
-	speechConfig.SetProperty(common.SpeechServiceConnectionInitialSilenceTimeoutMs, SpeechServiceConnectionInitialSilenceTimeoutMs)
+	speechConfig.SetProperty(common.SegmentationSilenceTimeoutMs, strconv.Itoa(TIMEOUTS.SegmentationSilenceTimeoutMs))
+	speechConfig.SetProperty(common.SpeechServiceConnectionInitialSilenceTimeoutMs, strconv.Itoa(TIMEOUTS.InitialSilenceTimeoutMs))
+	// for the confidence and alternatives
+	speechConfig.SetOutputFormat(common.Detailed)
 
 	return speechConfig, err
 }
@@ -131,10 +289,21 @@ func (s *SpeechRecognitionStream) Start() error {
 }
 
 func (s *SpeechRecognitionStream) SpeechToText(data []byte) error {
+	if s.recorder != nil {
+		if err := s.recorder.WritePCM(DefaultPCMFormat, data); err != nil {
+			tlog.Errorf("record speech: %s", err)
+		}
+	}
+
 	return s.audioInputStream.Write(data)
 }
 
-func (s *SpeechRecognitionStream) Result() (string, error) {
+// Record saves the pushed audio (in DefaultPCMFormat), the audio from microphone can't be recorded.
+func (s *SpeechRecognitionStream) Record(r *AudioRecorder) {
+	s.recorder = r
+}
+
+func (s *SpeechRecognitionStream) Result() (RecognitionResult, error) {
 	// select {
 	// case res := <-s.result.text:
 	// 	return res, nil
@@ -145,10 +314,93 @@ func (s *SpeechRecognitionStream) Result() (string, error) {
 	// case <-time.After(MaxSpeechRecognitionDelay * time.Second):
 	// 	return "", ErrSpeechRecognitionTimeout
 	// }
-	return s.result.GetResult()
+	return s.result.GetResult(s.timeouts().recognitionDelay())
+}
+
+// SetTimeouts changes the silence timeouts of azure for the next recognition as well.
+func (s *SpeechRecognitionStream) SetTimeouts(t Timeouts) error {
+	s.speechTimeouts.SetTimeouts(t)
+	if err := s.speechRecognizer.Properties.SetProperty(common.SegmentationSilenceTimeoutMs, strconv.Itoa(t.SegmentationSilenceTimeoutMs)); err != nil {
+		return err
+	}
+
+	return s.speechRecognizer.Properties.SetProperty(common.SpeechServiceConnectionInitialSilenceTimeoutMs, strconv.Itoa(t.InitialSilenceTimeoutMs))
+}
+
+func (s *SpeechRecognitionStream) StartContinuous() error {
+	s.mu.Lock()
+	s.result.recognized, s.stopped, s.done, s.result.err = make(chan RecognitionResult, 64), false, make(chan struct{}), nil
+	s.mu.Unlock()
+
+	return waitAsync(s.speechRecognizer.StartContinuousRecognitionAsync())
+}
+
+func (s *SpeechRecognitionStream) CloseStream() error {
+	s.audioInputStream.CloseStream()
+	return nil
+}
+
+func (s *SpeechRecognitionStream) Recognized() <-chan RecognitionResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.result.recognized
+}
+
+func (s *SpeechRecognitionStream) StopContinuous() error {
+	err := waitAsync(s.speechRecognizer.StopContinuousRecognitionAsync())
+	// the session stopped closes the results, unless the stop is timed out
+	s.stop()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.result.err != nil {
+		return s.result.err
+	}
+
+	return err
+}
+
+// waitAsync waits for the async call of the speech SDK. The channel is owned by the SDK, so it is not closed here,
+// and the result coming after the timeout is drained.
+func waitAsync(errChan chan error) error {
+	select {
+	case err := <-errChan:
+		return err
+	case <-time.After(5 * time.Second):
+		go func() { <-errChan }()
+		return ErrSpeechRecognitionTimeout
+	}
+}
+
+// SetPhrases replaces the phrase list of the recognizer.
+func (s *SpeechRecognitionStream) SetPhrases(phrases []string) error {
+	if s.phraseList == nil {
+		phraseList, err := speech.NewPhraseListGrammarFromRecognizer(s.speechRecognizer)
+		if err != nil {
+			return err
+		}
+
+		s.phraseList = phraseList
+	}
+
+	err := s.phraseList.Clear()
+	if err != nil {
+		return err
+	}
+
+	for _, phrase := range phrases {
+		if err = s.phraseList.AddPhrase(phrase); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (s *SpeechRecognitionStream) Close() error {
+	if s.phraseList != nil {
+		s.phraseList.Close()
+	}
+
 	s.audioConfig.Close()
 	s.speechConfig.Close()
 	s.languageConfig.Close()
@@ -167,25 +419,78 @@ func (s *SpeechRecognitionStream) sessionStoppedHandler(event speech.SessionEven
 	defer event.Close()
 	tlog.Debugf("Session Stopped (ID=%s)", event.SessionID)
 	// s.result.finished <- true
+	s.stop()
+}
+
+// stop closes the results of continuous recognition once, after the handlers sending them are returned.
+func (s *SpeechRecognitionStream) stop() {
+	s.mu.Lock()
+	if s.result.recognized == nil || s.stopped {
+		s.mu.Unlock()
+		return
+	}
+
+	s.stopped = true
+	close(s.done)
+	recognized := s.result.recognized
+	s.mu.Unlock()
+
+	s.sending.Wait()
+	close(recognized)
+}
+
+// sendRecognized passes the result of continuous recognition, unless its session is stopped. The lock is not
+// held while sending, so the handler waiting for the results to be read doesn't block stopping.
+func (s *SpeechRecognitionStream) sendRecognized(res RecognitionResult) {
+	s.mu.Lock()
+	if s.result.recognized == nil || s.stopped {
+		s.mu.Unlock()
+		return
+	}
+
+	recognized, done := s.result.recognized, s.done
+	s.sending.Add(1)
+	s.mu.Unlock()
+
+	defer s.sending.Done()
+	select {
+	case recognized <- res:
+	case <-done:
+	}
 }
 
 func (s *SpeechRecognitionStream) recognizingHandler(event speech.SpeechRecognitionEventArgs) {
 	defer event.Close()
 	tlog.Debugf("Recognizing: ", event.Result.Text)
 	// s.result.text <- event.Result.Text
+	if event.Result.Text != "" {
+		s.sendRecognized(newRecognitionResult(&event.Result, false))
+	}
 }
 
 func (s *SpeechRecognitionStream) recognizedHandler(event speech.SpeechRecognitionEventArgs) {
 	defer event.Close()
 	tlog.Debugf("Recognized: ", event.Result.Text)
 	// s.result.text <- event.Result.Text
+	if event.Result.Text != "" {
+		s.sendRecognized(newRecognitionResult(&event.Result, true))
+	}
 }
 
 func (s *SpeechRecognitionStream) cancelledHandler(event speech.SpeechRecognitionCanceledEventArgs) {
 	defer event.Close()
+	// the pushed audio stream is closed
+	if event.Reason == common.EndOfStream {
+		tlog.Debugf("End of stream.")
+		return
+	}
+
 	err := fmt.Errorf("CANCELED:\n Reason=%d.\nErrorCode=%d\nErrorDetails=[%s]", event.Reason, event.ErrorCode, event.ErrorDetails)
 	tlog.Errorf(err.Error())
 	// s.result.cancelled <- err
+	s.mu.Lock()
+	s.result.err = err
+	s.mu.Unlock()
 }
 
 func (s *SpeechRecognitionStream) speechStartHandler(event speech.RecognitionEventArgs) {
@@ -203,7 +508,13 @@ type SpeechRecognitionStandalone struct {
 }
 
 func NewSpeechRecognitionStandalone(key, region string, languages []string) (*SpeechRecognitionStandalone, error) {
-	audioConfig, err := audio.NewAudioConfigFromDefaultMicrophoneInput()
+	return newSpeechRecognitionStandalone(key, region, languages, "")
+}
+
+// newSpeechRecognitionStandalone creates the speech recognition from the input device, the default one if it is
+// empty.
+func newSpeechRecognitionStandalone(key, region string, languages []string, device string) (*SpeechRecognitionStandalone, error) {
+	audioConfig, err := microphoneAudioConfig(device)
 	if err != nil {
 		return nil, err
 	}
@@ -252,6 +563,11 @@ func (s *SpeechRecognitionStandalone) SpeechToText(data []byte) error {
 	panic("not supperted")
 }
 
+// CloseStream does nothing, the continuous recognition from microphone ends by StopContinuous.
+func (s *SpeechRecognitionStandalone) CloseStream() error {
+	return nil
+}
+
 type KeywordRecognitionStandalone struct {
 	SpeechRecognitionStream
 	model   *speech.KeywordRecognitionModel
@@ -259,7 +575,13 @@ type KeywordRecognitionStandalone struct {
 }
 
 func NewKeywordRecognitionStandalone(key, region string, languages []string, model, keyWord string) (*KeywordRecognitionStandalone, error) {
-	audioConfig, err := audio.NewAudioConfigFromDefaultMicrophoneInput()
+	return newKeywordRecognitionStandalone(key, region, languages, model, keyWord, "")
+}
+
+// newKeywordRecognitionStandalone creates the keyword recognition from the input device, the default one if it is
+// empty.
+func newKeywordRecognitionStandalone(key, region string, languages []string, model, keyWord, device string) (*KeywordRecognitionStandalone, error) {
+	audioConfig, err := microphoneAudioConfig(device)
 	if err != nil {
 		return nil, err
 	}
@@ -13,7 +13,7 @@ import (
 func init() {
 	PARAMS.LoadParams("params.json")
 	tlog.level = DEBUG
-	SegmentationSilenceTimeoutMs = "800"
+	TIMEOUTS.SegmentationSilenceTimeoutMs = 800
 }
 
 func TestSpeechRecognitionStream(t *testing.T) {
@@ -89,6 +89,20 @@ func TestKeywordRecognitionStanalone(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestParseDetailedResult(t *testing.T) {
+	res := RecognitionResult{Text: "Hello."}
+	parseDetailedResult(`{"RecognitionStatus":"Success","DisplayText":"Hello.","PrimaryLanguage":{"Language":"en-US","Confidence":"High"},`+
+		`"NBest":[{"Confidence":0.93,"Lexical":"hello","Display":"Hello."},{"Confidence":0.42,"Lexical":"hollow","Display":"Hollow."}]}`, &res)
+
+	assert.Equal(t, "en-US", res.Language)
+	assert.Equal(t, 0.93, res.Confidence)
+	assert.Equal(t, []RecognitionAlternative{{Text: "Hello.", Confidence: 0.93}, {Text: "Hollow.", Confidence: 0.42}}, res.NBest)
+
+	res = RecognitionResult{Text: "Hello.", Language: "en-GB"}
+	parseDetailedResult("", &res)
+	assert.Equal(t, RecognitionResult{Text: "Hello.", Language: "en-GB"}, res)
+}
+
 func sendAudio(audioFile string, sr *SpeechRecognitionStream, t *testing.T) {
 	stream, err := speech.NewAudioDataStreamFromWavFileInput(audioFile)
 	assert.Nil(t, err)
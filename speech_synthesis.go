@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Microsoft/cognitive-services-speech-sdk-go/audio"
@@ -12,12 +13,7 @@ import (
 	"github.com/Microsoft/cognitive-services-speech-sdk-go/speech"
 )
 
-const AUDIO_FORMT = common.Audio16Khz32KBitRateMonoMp3
-
-var (
-	ErrSpeechSynthesisTimeout = errors.New("speech synthesis get result timeout")
-	MaxSpeechSynthesisDelay   = time.Duration(10)
-)
+var ErrSpeechSynthesisTimeout = errors.New("speech synthesis get result timeout")
 
 type SpeechSynthesis interface {
 	TextToSpeech(text string) error
@@ -26,17 +22,52 @@ type SpeechSynthesis interface {
 	Close() error
 }
 
+// SSMLSpeechSynthesis is a speech synthesis can speak SSML (see SSMLBuilder).
+type SSMLSpeechSynthesis interface {
+	SpeechSynthesis
+	SSMLToSpeech(ssml string) error
+	// VoiceName is the voice speaking, empty if it is auto detected.
+	VoiceName() string
+}
+
+// autoVoiceProsody warns once that the prosody is not used by the voice auto detected.
+var autoVoiceProsody sync.Once
+
+// SpeakWithProsody speaks the text in the prosody by SSML, it is spoken as plain text if ss can't speak SSML
+// or the voice is unknown.
+func SpeakWithProsody(ss SpeechSynthesis, text string, prosody *Prosody) error {
+	s, ok := ss.(SSMLSpeechSynthesis)
+	if !ok || prosody == nil || prosody.IsZero() {
+		return ss.TextToSpeech(text)
+	}
+
+	// SSML needs the voice, which is decided by the speech service if auto detected
+	if s.VoiceName() == "" {
+		autoVoiceProsody.Do(func() {
+			tlog.Warningf("the prosody of session needs a voice, set Voice in params to speak in it.")
+		})
+
+		return ss.TextToSpeech(text)
+	}
+
+	return s.SSMLToSpeech(NewSSMLBuilder("").Voice(s.VoiceName()).Prosody(*prosody).Text(text).String())
+}
+
 type SpeechSynthesisStream struct {
+	voice             string
+	format            AudioFormat
 	audioConfig       *audio.AudioConfig
 	speechConfig      *speech.SpeechConfig
 	languageConfig    *speech.AutoDetectSourceLanguageConfig
 	speechSynthesizer *speech.SpeechSynthesizer
 	result            *speechSynthesisResult
+	recorder          *AudioRecorder
 }
 
 type speechSynthesisResult struct {
 	audio     chan []byte
 	subtitles chan *WordBoundery
+	duration  time.Duration // of the last speech
 	finished  chan bool
 	cancelled chan error
 	outcome   chan speech.SpeechSynthesisOutcome
@@ -68,7 +99,7 @@ func (r *speechSynthesisResult) Error() error {
 	case res := <-r.outcome:
 		defer res.Close()
 		return res.Error
-	case <-time.After(MaxSpeechSynthesisDelay * time.Second):
+	case <-time.After(TIMEOUTS.synthesisDelay()):
 		return ErrSpeechSynthesisTimeout
 	}
 }
@@ -83,7 +114,7 @@ func (r *speechSynthesisResult) Result() (sub *WordBoundery, audio []byte, err e
 		return nil, nil, io.EOF
 	case err = <-r.cancelled:
 		return nil, nil, err
-	case <-time.After(MaxSpeechSynthesisDelay * time.Second):
+	case <-time.After(TIMEOUTS.synthesisDelay()):
 		return nil, nil, ErrSpeechSynthesisTimeout
 	}
 }
@@ -123,7 +154,7 @@ func (r *speechSynthesisResult) Result() (sub *WordBoundery, audio []byte, err e
 
 // }
 
-func NewSpeechSynthesisStream(key, region string, voice string) (*SpeechSynthesisStream, error) {
+func NewSpeechSynthesisStream(key, region string, voice string, format AudioFormat) (*SpeechSynthesisStream, error) {
 	result := newSpeechSynthesisResult()
 	audioOutputStream, err := audio.CreatePushAudioOutputStream(result)
 	if err != nil {
@@ -142,7 +173,7 @@ func NewSpeechSynthesisStream(key, region string, voice string) (*SpeechSynthesi
 		return nil, err
 	}
 
-	speechConfig.SetSpeechSynthesisOutputFormat(AUDIO_FORMT)
+	speechConfig.SetSpeechSynthesisOutputFormat(format.azure)
 	speechConfig.SetSpeechSynthesisVoiceName(voice)
 
 	speechSynthesizer, err := speech.NewSpeechSynthesizerFromConfig(speechConfig, audioConfig)
@@ -152,6 +183,8 @@ func NewSpeechSynthesisStream(key, region string, voice string) (*SpeechSynthesi
 	}
 
 	res := &SpeechSynthesisStream{
+		voice:             voice,
+		format:            format,
 		audioConfig:       audioConfig,
 		speechConfig:      speechConfig,
 		speechSynthesizer: speechSynthesizer,
@@ -167,7 +200,7 @@ func NewSpeechSynthesisStream(key, region string, voice string) (*SpeechSynthesi
 	return res, nil
 }
 
-func NewAutoDetectedSpeechSynthesisStream(key, region string) (*SpeechSynthesisStream, error) {
+func NewAutoDetectedSpeechSynthesisStream(key, region string, format AudioFormat) (*SpeechSynthesisStream, error) {
 	result := newSpeechSynthesisResult()
 	audioOutputStream, err := audio.CreatePushAudioOutputStream(result)
 	if err != nil {
@@ -192,7 +225,7 @@ func NewAutoDetectedSpeechSynthesisStream(key, region string) (*SpeechSynthesisS
 		return nil, err
 	}
 
-	speechConfig.SetSpeechSynthesisOutputFormat(AUDIO_FORMT)
+	speechConfig.SetSpeechSynthesisOutputFormat(format.azure)
 
 	speechSynthesizer, err := speech.NewSpeechSynthesizerFomAutoDetectSourceLangConfig(speechConfig, languageConfig, audioConfig)
 	if err != nil {
@@ -201,6 +234,7 @@ func NewAutoDetectedSpeechSynthesisStream(key, region string) (*SpeechSynthesisS
 	}
 
 	res := &SpeechSynthesisStream{
+		format:            format,
 		audioConfig:       audioConfig,
 		speechConfig:      speechConfig,
 		languageConfig:    languageConfig,
@@ -222,6 +256,28 @@ func (s *SpeechSynthesisStream) TextToSpeech(text string) error {
 	return nil
 }
 
+func (s *SpeechSynthesisStream) SSMLToSpeech(ssml string) error {
+	s.result.outcome = s.speechSynthesizer.StartSpeakingSsmlAsync(ssml)
+	return nil
+}
+
+func (s *SpeechSynthesisStream) VoiceName() string {
+	return s.voice
+}
+
+// Format is the format of audio from Result.
+func (s *SpeechSynthesisStream) Format() AudioFormat {
+	return s.format
+}
+
+func (s *SpeechSynthesisStream) AudioDuration() time.Duration {
+	return s.result.duration
+}
+
+func (s *SpeechSynthesisStream) Record(r *AudioRecorder) {
+	s.recorder = r
+}
+
 func (s *SpeechSynthesisStream) Result() (*WordBoundery, []byte, error) {
 	return s.result.Result()
 }
@@ -230,13 +286,15 @@ func (s *SpeechSynthesisStream) Error() error {
 	return s.result.Error()
 }
 
-func (s *SpeechSynthesisStream) Close() {
+func (s *SpeechSynthesisStream) Close() error {
 	s.speechSynthesizer.Close()
 	s.audioConfig.Close()
 	s.speechConfig.Close()
 	if s.languageConfig != nil {
 		s.languageConfig.Close()
 	}
+
+	return nil
 }
 
 func (s *SpeechSynthesisStream) synthesizeStartedHandler(event speech.SpeechSynthesisEventArgs) {
@@ -254,6 +312,13 @@ func (s *SpeechSynthesisStream) synthesizedHandler(event speech.SpeechSynthesisE
 	defer event.Close()
 	tlog.Debugf("Synthesized, audio length %d.", len(event.Result.AudioData))
 	// s.result.audio <- event.Result.AudioData
+	s.result.duration = event.Result.AudioDuration
+	if s.recorder != nil {
+		if err := s.recorder.WriteAudio(s.format, event.Result.AudioData); err != nil {
+			tlog.Errorf("record speech: %s", err)
+		}
+	}
+
 	s.result.finished <- true
 }
 
@@ -285,8 +350,14 @@ type SpeechSynthesisStandalone struct {
 	SpeechSynthesisStream
 }
 
-func NewSpeechSynthesisStandalone(key, region string, voice string) (*SpeechSynthesisStandalone, error) {
-	audioConfig, err := audio.NewAudioConfigFromDefaultSpeakerOutput()
+func NewSpeechSynthesisStandalone(key, region string, voice string, format AudioFormat) (*SpeechSynthesisStandalone, error) {
+	return newSpeechSynthesisStandalone(key, region, voice, format, "")
+}
+
+// newSpeechSynthesisStandalone creates the speech synthesis playing on the output device, the default one if it is
+// empty.
+func newSpeechSynthesisStandalone(key, region string, voice string, format AudioFormat, device string) (*SpeechSynthesisStandalone, error) {
+	audioConfig, err := speakerAudioConfig(device)
 	if err != nil {
 		return nil, err
 	}
@@ -297,7 +368,7 @@ func NewSpeechSynthesisStandalone(key, region string, voice string) (*SpeechSynt
 		return nil, err
 	}
 
-	speechConfig.SetSpeechSynthesisOutputFormat(AUDIO_FORMT)
+	speechConfig.SetSpeechSynthesisOutputFormat(format.azure)
 	speechConfig.SetSpeechSynthesisVoiceName(voice)
 
 	speechSynthesizer, err := speech.NewSpeechSynthesizerFromConfig(speechConfig, audioConfig)
@@ -308,6 +379,8 @@ func NewSpeechSynthesisStandalone(key, region string, voice string) (*SpeechSynt
 
 	res := &SpeechSynthesisStandalone{}
 
+	res.voice = voice
+	res.format = format
 	res.audioConfig = audioConfig
 	res.speechConfig = speechConfig
 	res.speechSynthesizer = speechSynthesizer
@@ -322,8 +395,12 @@ func NewSpeechSynthesisStandalone(key, region string, voice string) (*SpeechSynt
 	return res, nil
 }
 
-func NewAutoDetectedSpeechSynthesisStandalone(key, region string) (*SpeechSynthesisStandalone, error) {
-	audioConfig, err := audio.NewAudioConfigFromDefaultSpeakerOutput()
+func NewAutoDetectedSpeechSynthesisStandalone(key, region string, format AudioFormat) (*SpeechSynthesisStandalone, error) {
+	return newAutoDetectedSpeechSynthesisStandalone(key, region, format, "")
+}
+
+func newAutoDetectedSpeechSynthesisStandalone(key, region string, format AudioFormat, device string) (*SpeechSynthesisStandalone, error) {
+	audioConfig, err := speakerAudioConfig(device)
 	if err != nil {
 		return nil, err
 	}
@@ -340,7 +417,7 @@ func NewAutoDetectedSpeechSynthesisStandalone(key, region string) (*SpeechSynthe
 		return nil, err
 	}
 
-	speechConfig.SetSpeechSynthesisOutputFormat(AUDIO_FORMT)
+	speechConfig.SetSpeechSynthesisOutputFormat(format.azure)
 
 	speechSynthesizer, err := speech.NewSpeechSynthesizerFomAutoDetectSourceLangConfig(speechConfig, languageConfig, audioConfig)
 	if err != nil {
@@ -350,6 +427,7 @@ func NewAutoDetectedSpeechSynthesisStandalone(key, region string) (*SpeechSynthe
 
 	res := &SpeechSynthesisStandalone{}
 
+	res.format = format
 	res.audioConfig = audioConfig
 	res.speechConfig = speechConfig
 	res.languageConfig = languageConfig
@@ -402,7 +480,9 @@ func (s *SpeechSynthesisStream) GetAllSupportLanguage() map[string]bool {
 type Voice struct {
 	Name      string
 	LocalName string
+	Locale    string
 	Gender    string
+	Neural    bool
 	StyleList []string
 }
 
@@ -419,7 +499,9 @@ func (s *SpeechSynthesisStream) GetAllSupportVoicesForLanguage(language string)
 			res = append(res, &Voice{
 				Name:      v.ShortName,
 				LocalName: v.LocalName,
+				Locale:    v.Locale,
 				Gender:    gender(v.Gender),
+				Neural:    v.VoiceType == common.OnlineNeural || v.VoiceType == common.OfflineNeural,
 				StyleList: v.StyleList,
 			})
 		}
@@ -446,9 +528,12 @@ func FormatVoices(voices []*Voice) string {
 }
 
 func gender(gender common.SynthesisVoiceGender) string {
-	if gender == 1 {
+	switch gender {
+	case common.Female:
 		return "female"
+	case common.Male:
+		return "male"
 	}
 
-	return "male"
+	return "unknown"
 }
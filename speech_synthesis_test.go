@@ -13,7 +13,7 @@ func init() {
 }
 
 func TestTextToSpeechStream(t *testing.T) {
-	ss, err := NewSpeechSynthesisStream(PARAMS.SpeechKey, PARAMS.SpeechRegion, "en-US-ElizabethNeural")
+	ss, err := NewSpeechSynthesisStream(PARAMS.SpeechKey, PARAMS.SpeechRegion, "en-US-ElizabethNeural", DefaultAudioFormat)
 	assert.Nil(t, err)
 
 	sendText("Does anyone hearing me?", ss, t)
@@ -25,7 +25,7 @@ func TestTextToSpeechStream(t *testing.T) {
 }
 
 func TestAutoDetectedTextToSpeechStream(t *testing.T) {
-	ss, err := NewAutoDetectedSpeechSynthesisStream(PARAMS.SpeechKey, PARAMS.SpeechRegion)
+	ss, err := NewAutoDetectedSpeechSynthesisStream(PARAMS.SpeechKey, PARAMS.SpeechRegion, DefaultAudioFormat)
 	assert.Nil(t, err)
 
 	sendText("Hello, text to speech.", ss, t)
@@ -37,7 +37,7 @@ func TestAutoDetectedTextToSpeechStream(t *testing.T) {
 }
 
 func TestTextToSpeechStandalone(t *testing.T) {
-	ss, err := NewSpeechSynthesisStandalone(PARAMS.SpeechKey, PARAMS.SpeechRegion, "en-US-ElizabethNeural")
+	ss, err := NewSpeechSynthesisStandalone(PARAMS.SpeechKey, PARAMS.SpeechRegion, "en-US-ElizabethNeural", DefaultAudioFormat)
 	assert.Nil(t, err)
 
 	defer ss.Close()
@@ -51,7 +51,7 @@ func TestTextToSpeechStandalone(t *testing.T) {
 }
 
 func TestAutoDetectedTextToSpeechStandalone(t *testing.T) {
-	ss, err := NewAutoDetectedSpeechSynthesisStandalone(PARAMS.SpeechKey, PARAMS.SpeechRegion)
+	ss, err := NewAutoDetectedSpeechSynthesisStandalone(PARAMS.SpeechKey, PARAMS.SpeechRegion, DefaultAudioFormat)
 	assert.Nil(t, err)
 
 	defer ss.Close()
@@ -73,7 +73,7 @@ func TestAutoDetectedTextToSpeechStandalone(t *testing.T) {
 }
 
 func TestGetSupportLanguageAndVoices(t *testing.T) {
-	ss, err := NewSpeechSynthesisStandalone(PARAMS.SpeechKey, PARAMS.SpeechRegion, "en-US-ElizabethNeural")
+	ss, err := NewSpeechSynthesisStandalone(PARAMS.SpeechKey, PARAMS.SpeechRegion, "en-US-ElizabethNeural", DefaultAudioFormat)
 	assert.Nil(t, err)
 
 	defer ss.Close()
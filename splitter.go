@@ -0,0 +1,300 @@
+package hal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// StreamSplitter splits a stream of markdown (e.g. the answer of chatgpt) into segments for speech synthesis.
+// A segment ends at the end of a sentence (CJK punctuation too) or a line, the one shorter than MinLength is
+// merged with the next sentence, and the one longer than MaxLength is cut at a space or comma. The fenced code
+// blocks are skipped (or spoken as CodeBlock) and the markdown syntax is stripped, then the segments are
+// normalized by Normalizer if it is set, but the text echoed is the original one.
+type StreamSplitter struct {
+	MinLength  int               // characters
+	MaxLength  int               // characters, 0 for no limit
+	CodeBlock  string            // spoken instead of a fenced code block, empty to skip it
+	Normalizer *SpeechNormalizer // optional, it also reads the numbers of ordered list items
+
+	next      func() (string, bool)
+	ended     bool
+	text      strings.Builder // the original text read
+	pending   string          // the text read but not cleaned, it is in a line
+	lineStart bool            // whether pending starts a line
+	inCode    bool
+	speech    string // the text cleaned but not segmented
+}
+
+// NewStreamSplitter creates the splitter reading the answer of chatgpt.
+func NewStreamSplitter(stream *StreamResult) *StreamSplitter {
+	return newStreamSplitter(func() (string, bool) {
+		content := stream.Next()
+		return content, stream.Err == nil
+	})
+}
+
+// newStreamSplitter creates the splitter reading by next, which returns false at the end of stream.
+func newStreamSplitter(next func() (string, bool)) *StreamSplitter {
+	return &StreamSplitter{MinLength: 10, MaxLength: 200, next: next, lineStart: true}
+}
+
+// Segment returns the next segment to speak, empty at the end of stream. The text read is printed if echo.
+func (ss *StreamSplitter) Segment(echo bool) string {
+	for {
+		if segment := ss.cut(); segment != "" {
+			return segment
+		}
+
+		if ss.ended {
+			return ""
+		}
+
+		content, ok := ss.next()
+		if echo {
+			fmt.Print(content)
+		}
+
+		ss.text.WriteString(content)
+		ss.pending += content
+		ss.ended = !ok
+		ss.clean()
+	}
+}
+
+// Text returns the original text read.
+func (ss *StreamSplitter) Text() string {
+	return ss.text.String()
+}
+
+// clean strips the markdown of the lines read, and the sentences of the last line if it is not a fence.
+func (ss *StreamSplitter) clean() {
+	for ss.pending != "" {
+		i := strings.IndexByte(ss.pending, '\n')
+		if i < 0 && !ss.ended {
+			ss.cleanPartial()
+			return
+		}
+
+		line := ss.pending
+		ss.pending = ""
+		if i >= 0 {
+			line, ss.pending = line[:i], line[i+1:]
+		}
+
+		ss.cleanLine(line)
+		ss.speech += "\n"
+		ss.lineStart = true
+	}
+}
+
+func (ss *StreamSplitter) cleanLine(line string) {
+	if ss.lineStart && isFence(line) {
+		ss.inCode = !ss.inCode
+		if ss.inCode {
+			ss.speech += ss.CodeBlock
+		}
+
+		return
+	}
+
+	if !ss.inCode {
+		ss.speech += ss.strip(line)
+	}
+}
+
+// strip removes the markdown syntax of text, the number of an ordered list item is read by the normalizer.
+func (ss *StreamSplitter) strip(text string) string {
+	var item string
+	if ss.lineStart && ss.Normalizer != nil {
+		if m := orderedItem.FindStringSubmatch(blockMarker.FindString(text)); m != nil {
+			if n, err := strconv.Atoi(m[1]); err == nil {
+				item = ss.Normalizer.ListItem(n)
+			}
+		}
+	}
+
+	return item + stripMarkdown(text, ss.lineStart)
+}
+
+// cleanPartial cleans the sentences ended in the last line, the rest is kept until more text is read.
+func (ss *StreamSplitter) cleanPartial() {
+	if ss.inCode {
+		return
+	}
+
+	from := 0
+	if ss.lineStart {
+		// it may be a fence
+		if t := strings.TrimLeft(ss.pending, " \t"); len(t) < 3 && (strings.HasPrefix("```", t) || strings.HasPrefix("~~~", t)) ||
+			isFence(t) {
+			return
+		}
+
+		from = len(blockMarker.FindString(ss.pending))
+	}
+
+	end := -1
+	for _, b := range sentenceBoundaries(ss.pending[from:]) {
+		// the sentence may go on if nothing follows its end, e.g. "3." of "3.14"
+		if from+b.end < len(ss.pending) || b.cjk {
+			end = from + b.end
+		}
+	}
+
+	if end <= 0 {
+		return
+	}
+
+	ss.speech += ss.strip(ss.pending[:end])
+	ss.pending = ss.pending[end:]
+	ss.lineStart = false
+}
+
+// cut returns the next segment normalized, the ones nothing to speak (e.g. only emoji) are skipped.
+func (ss *StreamSplitter) cut() string {
+	for {
+		segment := ss.cutSpeech()
+		if segment == "" || ss.Normalizer == nil {
+			return segment
+		}
+
+		if segment = ss.Normalizer.Normalize(segment); segment != "" {
+			return segment
+		}
+	}
+}
+
+// cutSpeech returns the segment at the first boundary it is long enough, or at the end of stream.
+func (ss *StreamSplitter) cutSpeech() string {
+	ss.speech = strings.TrimLeftFunc(ss.speech, unicode.IsSpace)
+	end := -1
+	for _, b := range sentenceBoundaries(ss.speech) {
+		if b.line || utf8.RuneCountInString(strings.TrimSpace(ss.speech[:b.end])) >= ss.MinLength {
+			end = b.end
+			break
+		}
+	}
+
+	if end < 0 && ss.ended {
+		end = len(ss.speech)
+	}
+
+	length := utf8.RuneCountInString(ss.speech)
+	if end >= 0 {
+		length = utf8.RuneCountInString(ss.speech[:end])
+	}
+
+	if ss.MaxLength > 0 && length > ss.MaxLength {
+		end = cutAt(ss.speech, ss.MaxLength)
+	}
+
+	if end <= 0 {
+		return ""
+	}
+
+	segment := strings.Join(strings.Fields(ss.speech[:end]), " ")
+	ss.speech = ss.speech[end:]
+	return segment
+}
+
+type sentenceBoundary struct {
+	end  int  // the byte index after the sentence
+	line bool // the end of a line
+	cjk  bool // ended by a CJK punctuation
+}
+
+const (
+	sentenceEnds    = ".!?…"
+	cjkSentenceEnds = "。！？；"
+	closings        = "\"')]}”’」』）》"
+)
+
+// sentenceBoundaries returns the ends of sentences and lines in text. A sentence ends by a punctuation
+// followed by a space (or the end of text), or a CJK one, with the closing quotes or brackets.
+func sentenceBoundaries(text string) []sentenceBoundary {
+	var res []sentenceBoundary
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		switch {
+		case r == '\n':
+			res = append(res, sentenceBoundary{end: i, line: true})
+		case strings.ContainsRune(sentenceEnds, r) || strings.ContainsRune(cjkSentenceEnds, r):
+			cjk := strings.ContainsRune(cjkSentenceEnds, r)
+			for i < len(text) {
+				next, size := utf8.DecodeRuneInString(text[i:])
+				if !strings.ContainsRune(sentenceEnds+cjkSentenceEnds+closings, next) {
+					break
+				}
+
+				i += size
+			}
+
+			next, _ := utf8.DecodeRuneInString(text[i:])
+			if cjk || i == len(text) || unicode.IsSpace(next) {
+				res = append(res, sentenceBoundary{end: i, cjk: cjk})
+			}
+		}
+	}
+
+	return res
+}
+
+// cutAt returns the byte index to cut text no longer than max characters, after the last space or comma if
+// there is.
+func cutAt(text string, max int) int {
+	var end, last int
+	for n := 0; n < max && end < len(text); n++ {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+		if unicode.IsSpace(r) || strings.ContainsRune(",;:，、；：", r) {
+			last = end
+		}
+	}
+
+	if last > 0 {
+		return last
+	}
+
+	return end
+}
+
+func isFence(line string) bool {
+	t := strings.TrimLeft(line, " \t")
+	return strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~")
+}
+
+var (
+	blockMarker    = regexp.MustCompile(`^[ \t]*(?:(?:#{1,6}|>|[-*+]|\d+[.)])[ \t]+)*`)
+	orderedItem    = regexp.MustCompile(`(\d+)[.)][ \t]+$`)
+	horizontalRule = regexp.MustCompile(`^[ \t]*(?:[-*_][ \t]*){3,}$`)
+	tableSeparator = regexp.MustCompile(`^[ \t]*\|?(?:[ \t]*:?-+:?[ \t]*\|)+[ \t]*(?::?-+:?)?[ \t]*$`)
+	image          = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	link           = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	htmlTag        = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	emphasisStart  = regexp.MustCompile(`(^|[^\p{L}\p{N}])[*_]+`)
+	emphasisEnd    = regexp.MustCompile(`[*_]+([^\p{L}\p{N}]|$)`)
+)
+
+// stripMarkdown removes the markdown syntax of text, the block markers (headings, lists and quotes) are
+// removed only if it starts a line.
+func stripMarkdown(text string, lineStart bool) string {
+	if lineStart {
+		if horizontalRule.MatchString(text) || tableSeparator.MatchString(text) {
+			return ""
+		}
+
+		text = text[len(blockMarker.FindString(text)):]
+	}
+
+	text = image.ReplaceAllString(text, "$1")
+	text = link.ReplaceAllString(text, "$1")
+	text = htmlTag.ReplaceAllString(text, "")
+	text = strings.NewReplacer("**", "", "__", "", "~~", "", "`", "", "|", " ").Replace(text)
+	text = emphasisStart.ReplaceAllString(text, "$1")
+	return emphasisEnd.ReplaceAllString(text, "$1")
+}
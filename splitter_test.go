@@ -0,0 +1,67 @@
+package hal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tokens returns the stream of tokens, split by "¦".
+func tokens(text string) func() (string, bool) {
+	parts := strings.Split(text, "¦")
+	return func() (string, bool) {
+		if len(parts) == 0 {
+			return "", false
+		}
+
+		token := parts[0]
+		parts = parts[1:]
+		return token, true
+	}
+}
+
+func segments(ss *StreamSplitter) []string {
+	var res []string
+	for s := ss.Segment(false); s != ""; s = ss.Segment(false) {
+		res = append(res, s)
+	}
+
+	return res
+}
+
+func TestStreamSplitterSentences(t *testing.T) {
+	ss := newStreamSplitter(tokens("Hello, Dave. I am¦ HAL 9000, and pi is 3¦.14. Wh¦at? 你好。今天¦天气很好！¦好。\nBye"))
+	// "What? 你好。" is too short
+	assert.Equal(t, []string{"Hello, Dave.", "I am HAL 9000, and pi is 3.14.", "What? 你好。今天天气很好！", "好。", "Bye"}, segments(ss))
+	assert.Equal(t, "Hello, Dave. I am HAL 9000, and pi is 3.14. What? 你好。今天天气很好！好。\nBye", ss.Text())
+}
+
+func TestStreamSplitterLength(t *testing.T) {
+	ss := newStreamSplitter(tokens("Hi. Yes. I can hear you very well, Dave, and I am listening."))
+	ss.MaxLength = 30
+	assert.Equal(t, []string{"Hi. Yes. I can hear you very", "well, Dave, and I am", "listening."}, segments(ss))
+
+	ss = newStreamSplitter(tokens(strings.Repeat("很", 25)))
+	ss.MaxLength = 10
+	assert.Equal(t, []string{strings.Repeat("很", 10), strings.Repeat("很", 10), strings.Repeat("很", 5)}, segments(ss))
+}
+
+func TestStreamSplitterMarkdown(t *testing.T) {
+	text := "## Steps\n\n1. Install **Go**.\n- Run `go build` in [the repo](https://github.com/neotse/hal).\n" +
+		"``¦`go\nfmt.Println(\"Hello. World.\")\n```\n---\n| a | b |\n|---|---|\n> That's *all*, snake_case."
+	ss := newStreamSplitter(tokens(text))
+	assert.Equal(t, []string{"Steps", "Install Go.", "Run go build in the repo.", "a b", "That's all, snake_case."}, segments(ss))
+	assert.Equal(t, strings.ReplaceAll(text, "¦", ""), ss.Text())
+
+	ss = newStreamSplitter(tokens("Like this:\n```\ncode\n```\nDone."))
+	ss.CodeBlock = "See the code."
+	assert.Equal(t, []string{"Like this:", "See the code.", "Done."}, segments(ss))
+}
+
+func TestStreamSplitterNormalizer(t *testing.T) {
+	ss := newStreamSplitter(tokens("Steps:\n1. Open¦ https://www.example.com/docs?x=1.\n2) Wait 5 minutes 🎉\n🚀\n- Done"))
+	ss.Normalizer = NewSpeechNormalizer("en-US")
+	assert.Equal(t, []string{"Steps:", "Item one: Open example.com.", "Item two: Wait five minutes", "Done"}, segments(ss))
+	assert.Contains(t, ss.Text(), "https://www.example.com/docs?x=1.")
+}
@@ -0,0 +1,145 @@
+package hal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Prosody is how the speech is spoken, the empty fields are the defaults of the voice.
+type Prosody struct {
+	Style       string  `json:"style,omitempty"`       // one of the StyleList of the voice, e.g. cheerful
+	StyleDegree float64 `json:"styleDegree,omitempty"` // the intensity of style, 0.01 ~ 2
+	Rate        string  `json:"rate,omitempty"`        // e.g. +20%, 1.2, fast
+	Pitch       string  `json:"pitch,omitempty"`       // e.g. -2st, +10%, high
+	Volume      string  `json:"volume,omitempty"`      // e.g. +50%, loud
+}
+
+func (p Prosody) IsZero() bool {
+	return p == Prosody{}
+}
+
+// SSMLBuilder builds the SSML (https://learn.microsoft.com/en-us/azure/cognitive-services/speech-service/speech-synthesis-markup)
+// document of a voice, the content is added in order by Text, Break, SayAs and Phoneme.
+type SSMLBuilder struct {
+	language string
+	voice    string
+	prosody  Prosody
+	content  strings.Builder
+}
+
+// NewSSMLBuilder creates the builder of SSML in the language (BCP-47 code), the language of voice if empty.
+func NewSSMLBuilder(language string) *SSMLBuilder {
+	return &SSMLBuilder{language: language}
+}
+
+func (b *SSMLBuilder) Voice(name string) *SSMLBuilder {
+	b.voice = name
+	return b
+}
+
+// Style sets the speaking style of voice, the degree is ignored if it is 0.
+func (b *SSMLBuilder) Style(style string, degree float64) *SSMLBuilder {
+	b.prosody.Style, b.prosody.StyleDegree = style, degree
+	return b
+}
+
+func (b *SSMLBuilder) Rate(rate string) *SSMLBuilder {
+	b.prosody.Rate = rate
+	return b
+}
+
+func (b *SSMLBuilder) Pitch(pitch string) *SSMLBuilder {
+	b.prosody.Pitch = pitch
+	return b
+}
+
+func (b *SSMLBuilder) Volume(volume string) *SSMLBuilder {
+	b.prosody.Volume = volume
+	return b
+}
+
+// Prosody sets the style, rate, pitch and volume at once.
+func (b *SSMLBuilder) Prosody(prosody Prosody) *SSMLBuilder {
+	b.prosody = prosody
+	return b
+}
+
+func (b *SSMLBuilder) Text(text string) *SSMLBuilder {
+	b.content.WriteString(escapeSSML(text))
+	return b
+}
+
+func (b *SSMLBuilder) Break(d time.Duration) *SSMLBuilder {
+	fmt.Fprintf(&b.content, `<break time="%dms"/>`, d.Milliseconds())
+	return b
+}
+
+// SayAs speaks the text as the type, e.g. date, cardinal, telephone. The format is optional, e.g. ymd for date.
+func (b *SSMLBuilder) SayAs(text, interpretAs, format string) *SSMLBuilder {
+	fmt.Fprintf(&b.content, `<say-as interpret-as="%s"`, escapeSSML(interpretAs))
+	if format != "" {
+		fmt.Fprintf(&b.content, ` format="%s"`, escapeSSML(format))
+	}
+
+	fmt.Fprintf(&b.content, `>%s</say-as>`, escapeSSML(text))
+	return b
+}
+
+// Phoneme speaks the text by the pronunciation in the alphabet, e.g. ipa, sapi.
+func (b *SSMLBuilder) Phoneme(text, alphabet, ph string) *SSMLBuilder {
+	fmt.Fprintf(&b.content, `<phoneme alphabet="%s" ph="%s">%s</phoneme>`, escapeSSML(alphabet), escapeSSML(ph), escapeSSML(text))
+	return b
+}
+
+func (b *SSMLBuilder) String() string {
+	language := b.language
+	if language == "" {
+		language = voiceLanguage(b.voice)
+	}
+
+	content := b.content.String()
+	p := b.prosody
+	if p.Rate != "" || p.Pitch != "" || p.Volume != "" {
+		var attrs strings.Builder
+		for _, attr := range [][2]string{{"rate", p.Rate}, {"pitch", p.Pitch}, {"volume", p.Volume}} {
+			if attr[1] != "" {
+				fmt.Fprintf(&attrs, ` %s="%s"`, attr[0], escapeSSML(attr[1]))
+			}
+		}
+
+		content = fmt.Sprintf("<prosody%s>%s</prosody>", attrs.String(), content)
+	}
+
+	if p.Style != "" {
+		degree := ""
+		if p.StyleDegree != 0 {
+			degree = fmt.Sprintf(` styledegree="%g"`, p.StyleDegree)
+		}
+
+		content = fmt.Sprintf(`<mstts:express-as style="%s"%s>%s</mstts:express-as>`, escapeSSML(p.Style), degree, content)
+	}
+
+	if b.voice != "" {
+		content = fmt.Sprintf(`<voice name="%s">%s</voice>`, escapeSSML(b.voice), content)
+	}
+
+	return fmt.Sprintf(`<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xmlns:mstts="https://www.w3.org/2001/mstts" xml:lang="%s">%s</speak>`,
+		language, content)
+}
+
+var ssmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+
+func escapeSSML(text string) string {
+	return ssmlEscaper.Replace(text)
+}
+
+// voiceLanguage returns the language of azure voice name, e.g. en-US for en-US-JennyNeural.
+func voiceLanguage(voice string) string {
+	parts := strings.Split(voice, "-")
+	if len(parts) < 3 {
+		return "en-US"
+	}
+
+	return strings.Join(parts[:len(parts)-1], "-")
+}
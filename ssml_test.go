@@ -0,0 +1,77 @@
+package hal
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSMLBuilder(t *testing.T) {
+	ssml := NewSSMLBuilder("").Voice("en-US-JennyNeural").Style("cheerful", 1.5).Rate("+20%").
+		Text("Tom & Jerry").Break(500*time.Millisecond).SayAs("2023-05-01", "date", "ymd").Phoneme("tomato", "ipa", "təˈmeɪtoʊ").String()
+
+	assert.Equal(t, `<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xmlns:mstts="https://www.w3.org/2001/mstts" xml:lang="en-US">`+
+		`<voice name="en-US-JennyNeural"><mstts:express-as style="cheerful" styledegree="1.5"><prosody rate="+20%">`+
+		`Tom &amp; Jerry<break time="500ms"/><say-as interpret-as="date" format="ymd">2023-05-01</say-as>`+
+		`<phoneme alphabet="ipa" ph="təˈmeɪtoʊ">tomato</phoneme>`+
+		`</prosody></mstts:express-as></voice></speak>`, ssml)
+
+	ssml = NewSSMLBuilder("fr-FR").Text("<bonjour>").String()
+	assert.Equal(t, `<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xmlns:mstts="https://www.w3.org/2001/mstts" xml:lang="fr-FR">`+
+		`&lt;bonjour&gt;</speak>`, ssml)
+}
+
+func TestVoiceLanguage(t *testing.T) {
+	assert.Equal(t, "en-US", voiceLanguage("en-US-JennyNeural"))
+	assert.Equal(t, "zh-CN-sichuan", voiceLanguage("zh-CN-sichuan-YunxiNeural"))
+	assert.Equal(t, "en-US", voiceLanguage(""))
+}
+
+type fakeSSMLSpeechSynthesis struct {
+	voice string
+	text  string
+	ssml  string
+}
+
+func (f *fakeSSMLSpeechSynthesis) TextToSpeech(text string) error {
+	f.text = text
+	return nil
+}
+
+func (f *fakeSSMLSpeechSynthesis) SSMLToSpeech(ssml string) error {
+	f.ssml = ssml
+	return nil
+}
+
+func (f *fakeSSMLSpeechSynthesis) VoiceName() string {
+	return f.voice
+}
+
+func (f *fakeSSMLSpeechSynthesis) Result() (*WordBoundery, []byte, error) {
+	return nil, nil, io.EOF
+}
+
+func (f *fakeSSMLSpeechSynthesis) Error() error {
+	return nil
+}
+
+func (f *fakeSSMLSpeechSynthesis) Close() error {
+	return nil
+}
+
+func TestSpeakWithProsody(t *testing.T) {
+	ss := &fakeSSMLSpeechSynthesis{voice: "en-US-JennyNeural"}
+	assert.Nil(t, SpeakWithProsody(ss, "hello", nil))
+	assert.Equal(t, "hello", ss.text)
+	assert.Equal(t, "", ss.ssml)
+
+	assert.Nil(t, SpeakWithProsody(ss, "fast", &Prosody{Rate: "fast"}))
+	assert.Contains(t, ss.ssml, `<voice name="en-US-JennyNeural"><prosody rate="fast">fast</prosody></voice>`)
+
+	// the voice is auto detected
+	ss = &fakeSSMLSpeechSynthesis{}
+	assert.Nil(t, SpeakWithProsody(ss, "hello", &Prosody{Rate: "fast"}))
+	assert.Equal(t, "hello", ss.text)
+}
@@ -0,0 +1,278 @@
+package hal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Microsoft/cognitive-services-speech-sdk-go/common"
+)
+
+// Cue is a line of subtitles shown from Start to End of the audio.
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// TimedSpeechSynthesis is a speech synthesis knows the duration of the audio it speaks.
+type TimedSpeechSynthesis interface {
+	// AudioDuration is the duration of the last speech.
+	AudioDuration() time.Duration
+}
+
+// SpeechDuration returns the duration of the last speech of ss, 0 if it is unknown.
+func SpeechDuration(ss SpeechSynthesis) time.Duration {
+	if t, ok := ss.(TimedSpeechSynthesis); ok {
+		return t.AudioDuration()
+	}
+
+	return 0
+}
+
+// Subtitles groups the word boundaries of speeches into cues, a cue ends by the end of sentence, a long pause,
+// or it is too long. The offsets of word boundaries are from the beginning of each speech, so EndSpeech must be
+// called after a speech to put the next one behind it.
+type Subtitles struct {
+	MaxChars    int           // the max characters of a cue
+	MaxDuration time.Duration // the max duration of a cue
+	MaxPause    time.Duration // the pause between words ends a cue
+
+	cues   []Cue
+	cue    *Cue
+	base   time.Duration // the offset of the current speech
+	end    time.Duration // the end of the last word in the current speech
+	last   string        // the last word of the current cue
+	length int
+}
+
+func NewSubtitles() *Subtitles {
+	return &Subtitles{MaxChars: 42, MaxDuration: 5 * time.Second, MaxPause: 800 * time.Millisecond}
+}
+
+// Add puts the word into the cues, the sentence boundaries are ignored.
+func (s *Subtitles) Add(w *WordBoundery) {
+	if w == nil || w.BounderyType == common.SentenceBoundary || strings.TrimSpace(w.Text) == "" {
+		return
+	}
+
+	start := s.base + time.Duration(w.AudioOffset*float64(time.Millisecond))
+	end := start + time.Duration(w.Duration*float64(time.Millisecond))
+	punctuation := w.BounderyType == common.PunctuationBoundary || isPunctuation(w.Text)
+	if s.cue != nil && !punctuation {
+		if s.length+utf8.RuneCountInString(w.Text)+1 > s.MaxChars || end-s.cue.Start > s.MaxDuration ||
+			start-s.cue.End > s.MaxPause {
+			s.flush()
+		}
+	}
+
+	if s.cue == nil {
+		if punctuation {
+			// a punctuation never starts a cue
+			return
+		}
+
+		s.cue = &Cue{Start: start}
+	}
+
+	text := w.Text
+	if s.last != "" && needSpace(s.last, text) && !punctuation {
+		text = " " + text
+	}
+
+	s.cue.Text += text
+	s.length += utf8.RuneCountInString(text)
+	s.last = w.Text
+	if end > s.cue.End {
+		s.cue.End = end
+	}
+
+	if end-s.base > s.end {
+		s.end = end - s.base
+	}
+
+	if punctuation && endsSentence(w.Text) {
+		s.flush()
+	}
+}
+
+// EndSpeech ends the current speech lasting duration, the following words are behind it. The end of the last
+// word is used if the duration is unknown (0).
+func (s *Subtitles) EndSpeech(duration time.Duration) {
+	if duration < s.end {
+		duration = s.end
+	}
+
+	s.flush()
+	s.base += duration
+	s.end = 0
+}
+
+// Cues returns the cues of the speeches.
+func (s *Subtitles) Cues() []Cue {
+	s.flush()
+	return s.cues
+}
+
+// Reset drops the cues.
+func (s *Subtitles) Reset() {
+	s.cues, s.cue, s.base, s.end = nil, nil, 0, 0
+}
+
+func (s *Subtitles) flush() {
+	if s.cue != nil {
+		s.cues = append(s.cues, *s.cue)
+	}
+
+	s.cue, s.last, s.length = nil, "", 0
+}
+
+// WriteSRT writes the cues in SubRip format.
+func (s *Subtitles) WriteSRT(w io.Writer) error {
+	for i, c := range s.Cues() {
+		_, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", i+1, formatCueTime(c.Start, ","), formatCueTime(c.End, ","), c.Text)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteVTT writes the cues in WebVTT format.
+func (s *Subtitles) WriteVTT(w io.Writer) error {
+	if _, err := fmt.Fprint(w, "WEBVTT\n\n"); err != nil {
+		return err
+	}
+
+	for _, c := range s.Cues() {
+		_, err := fmt.Fprintf(w, "%s --> %s\n%s\n\n", formatCueTime(c.Start, "."), formatCueTime(c.End, "."), c.Text)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Save writes the cues to file, in WebVTT format if its extension is .vtt, otherwise SubRip.
+func (s *Subtitles) Save(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(file), ".vtt") {
+		err = s.WriteVTT(f)
+	} else {
+		err = s.WriteSRT(f)
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func formatCueTime(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+func isPunctuation(text string) bool {
+	for _, r := range text {
+		if !unicode.IsPunct(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func endsSentence(text string) bool {
+	return strings.ContainsAny(text, ".!?。！？")
+}
+
+// needSpace reports whether there is a space between the words, not for han characters.
+func needSpace(last, next string) bool {
+	l, _ := utf8.DecodeLastRuneInString(last)
+	n, _ := utf8.DecodeRuneInString(next)
+	return !unicode.Is(unicode.Han, l) && !unicode.Is(unicode.Han, n)
+}
+
+// Karaoke shows the words on the terminal when they are spoken, the word speaking is highlighted.
+type Karaoke struct {
+	w      io.Writer
+	start  time.Time
+	words  []string
+	length int
+}
+
+// MaxKaraokeWidth is the max characters of a line of karaoke, a new line starts if it is exceeded.
+var MaxKaraokeWidth = 60
+
+func NewKaraoke(w io.Writer) *Karaoke {
+	return &Karaoke{w: w}
+}
+
+// Show waits until the word is spoken (by its offset from the first word of the speech), then highlights it.
+func (k *Karaoke) Show(w *WordBoundery) {
+	if w == nil || w.BounderyType == common.SentenceBoundary || strings.TrimSpace(w.Text) == "" {
+		return
+	}
+
+	if k.start.IsZero() {
+		k.start = time.Now().Add(-time.Duration(w.AudioOffset * float64(time.Millisecond)))
+	}
+
+	time.Sleep(time.Until(k.start.Add(time.Duration(w.AudioOffset * float64(time.Millisecond)))))
+	text := w.Text
+	punctuation := w.BounderyType == common.PunctuationBoundary || isPunctuation(text)
+	if !punctuation && k.length+utf8.RuneCountInString(text) > MaxKaraokeWidth {
+		k.newLine()
+	}
+
+	if len(k.words) > 0 && !punctuation && needSpace(k.words[len(k.words)-1], text) {
+		text = " " + text
+	}
+
+	k.words = append(k.words, text)
+	k.length += utf8.RuneCountInString(text)
+	k.render(true)
+}
+
+// End shows the last line without highlight, the next speech starts at a new line.
+func (k *Karaoke) End() {
+	k.newLine()
+	k.start = time.Time{}
+}
+
+func (k *Karaoke) newLine() {
+	if len(k.words) > 0 {
+		k.render(false)
+		fmt.Fprintln(k.w)
+	}
+
+	k.words, k.length = nil, 0
+}
+
+func (k *Karaoke) render(highlight bool) {
+	var line strings.Builder
+	line.WriteString("\r\033[K")
+	for i, w := range k.words {
+		if highlight && i == len(k.words)-1 {
+			trimmed := strings.TrimLeft(w, " ")
+			line.WriteString(w[:len(w)-len(trimmed)] + "\033[7m" + trimmed + "\033[0m")
+		} else {
+			line.WriteString(w)
+		}
+	}
+
+	fmt.Fprint(k.w, line.String())
+}
@@ -0,0 +1,95 @@
+package hal
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/cognitive-services-speech-sdk-go/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func word(text string, offset, duration float64) *WordBoundery {
+	w := &WordBoundery{BounderyType: common.WordBoundary, AudioOffset: offset, Duration: duration, Text: text}
+	if isPunctuation(text) {
+		w.BounderyType = common.PunctuationBoundary
+	}
+
+	return w
+}
+
+func TestSubtitles(t *testing.T) {
+	s := NewSubtitles()
+	s.Add(word("Hello", 0, 400))
+	s.Add(word(",", 400, 0))
+	s.Add(word("Dave", 500, 300))
+	s.Add(word(".", 800, 0))
+	s.Add(&WordBoundery{BounderyType: common.SentenceBoundary, Text: "I am HAL."})
+	s.Add(word("I", 1000, 100))
+	s.Add(word("am", 1200, 200))
+	// a long pause
+	s.Add(word("HAL", 3000, 500))
+	s.EndSpeech(4 * time.Second)
+
+	// the next speech is behind the last one
+	s.Add(word("你", 0, 200))
+	s.Add(word("好", 200, 200))
+	s.Add(word("。", 400, 0))
+	s.EndSpeech(0)
+
+	cues := s.Cues()
+	assert.Equal(t, []Cue{
+		{Start: 0, End: 800 * time.Millisecond, Text: "Hello, Dave."},
+		{Start: time.Second, End: 1400 * time.Millisecond, Text: "I am"},
+		{Start: 3 * time.Second, End: 3500 * time.Millisecond, Text: "HAL"},
+		{Start: 4 * time.Second, End: 4400 * time.Millisecond, Text: "你好。"},
+	}, cues)
+
+	var srt bytes.Buffer
+	assert.Nil(t, s.WriteSRT(&srt))
+	assert.True(t, strings.HasPrefix(srt.String(), "1\n00:00:00,000 --> 00:00:00,800\nHello, Dave.\n\n2\n"))
+
+	var vtt bytes.Buffer
+	assert.Nil(t, s.WriteVTT(&vtt))
+	assert.True(t, strings.HasPrefix(vtt.String(), "WEBVTT\n\n00:00:00.000 --> 00:00:00.800\nHello, Dave.\n\n"))
+	assert.True(t, strings.HasSuffix(vtt.String(), "00:00:04.000 --> 00:00:04.400\n你好。\n\n"))
+
+	f, err := os.CreateTemp("./test_data", "subtitles*.vtt")
+	assert.Nil(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	assert.Nil(t, s.Save(f.Name()))
+	data, _ := os.ReadFile(f.Name())
+	assert.Equal(t, vtt.String(), string(data))
+
+	s.Reset()
+	assert.Empty(t, s.Cues())
+}
+
+func TestSubtitlesMaxChars(t *testing.T) {
+	s := NewSubtitles()
+	s.MaxChars = 10
+	for i, w := range []string{"one", "two", "three", "four"} {
+		s.Add(word(w, float64(i*300), 250))
+	}
+
+	cues := s.Cues()
+	assert.Equal(t, 2, len(cues))
+	assert.Equal(t, "one two", cues[0].Text)
+	assert.Equal(t, "three four", cues[1].Text)
+}
+
+func TestKaraoke(t *testing.T) {
+	var out bytes.Buffer
+	k := NewKaraoke(&out)
+	k.Show(word("Hi", 0, 10))
+	k.Show(word(",", 10, 0))
+	k.Show(word("Dave", 20, 10))
+	k.End()
+
+	lines := strings.Split(out.String(), "\r\033[K")
+	assert.Equal(t, []string{"", "\033[7mHi\033[0m", "Hi\033[7m,\033[0m", "Hi, \033[7mDave\033[0m", "Hi, Dave\n"}, lines)
+}
@@ -0,0 +1,161 @@
+package hal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Transcribe pushes the audio (in DefaultPCMFormat) to sr, recognizes it continuously, and writes the timestamped
+// text to w. It returns the whole text.
+func Transcribe(sr ContinuousSpeechRecognition, audio io.Reader, w io.Writer) (string, error) {
+	err := sr.StartContinuous()
+	if err != nil {
+		return "", err
+	}
+
+	pushed := make(chan error, 1)
+	go func() {
+		defer sr.CloseStream()
+
+		data := make([]byte, 3200) // 100ms
+		for {
+			n, err := io.ReadFull(audio, data)
+			if n > 0 {
+				if err := sr.SpeechToText(data[:n]); err != nil {
+					pushed <- err
+					return
+				}
+			}
+
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				pushed <- nil
+				return
+			}
+
+			if err != nil {
+				pushed <- err
+				return
+			}
+		}
+	}()
+
+	var texts []string
+	for res := range sr.Recognized() {
+		if !res.Final {
+			continue
+		}
+
+		texts = append(texts, res.Text)
+		fmt.Fprintf(w, "[%s --> %s] %s\n", FormatTimestamp(res.Offset), FormatTimestamp(res.Offset+res.Duration), res.Text)
+	}
+
+	err = <-pushed
+	if stopErr := sr.StopContinuous(); err == nil {
+		err = stopErr
+	}
+
+	return strings.Join(texts, " "), err
+}
+
+// Dictate recognizes the speech continuously and shows the live captions on w, it returns the whole speech after
+// the speaker keeps silent for DictationSilenceTimeoutMs, so a long prompt can be dictated across pauses.
+func Dictate(sr ContinuousSpeechRecognition, w io.Writer) (RecognitionResult, error) {
+	err := sr.StartContinuous()
+	if err != nil {
+		return RecognitionResult{}, err
+	}
+
+	timeouts := timeoutsOf(sr)
+	timer := time.NewTimer(time.Duration(timeouts.InitialSilenceTimeoutMs) * time.Millisecond)
+	defer timer.Stop()
+
+	var finals []RecognitionResult
+	var interim string
+	recognized := sr.Recognized()
+loop:
+	for {
+		select {
+		case res, ok := <-recognized:
+			if !ok {
+				break loop
+			}
+
+			if res.Final {
+				finals, interim = append(finals, res), ""
+			} else {
+				interim = res.Text
+			}
+
+			caption := joinResults(finals).Text
+			if interim != "" {
+				caption += " " + interim
+			}
+			fmt.Fprintf(w, "\r\033[K%s", strings.TrimSpace(caption))
+
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(time.Duration(timeouts.DictationSilenceTimeoutMs) * time.Millisecond)
+		case <-timer.C:
+			// the silence is counted after the speech ends, e.g. whisper recognizes an utterance after it is spoken
+			if isSpeaking(sr) {
+				timer.Reset(time.Duration(timeouts.DictationSilenceTimeoutMs) * time.Millisecond)
+				continue
+			}
+
+			break loop
+		}
+	}
+
+	// the utterances recognized while stopping are kept
+	stopped := make(chan error, 1)
+	go func() { stopped <- sr.StopContinuous() }()
+	for res := range recognized {
+		if res.Final {
+			finals, interim = append(finals, res), ""
+		}
+	}
+
+	if len(finals) != 0 || interim != "" {
+		fmt.Fprintln(w)
+	}
+
+	return joinResults(finals), <-stopped
+}
+
+// joinResults merges the final results to one, the confidence is the average of them.
+func joinResults(results []RecognitionResult) RecognitionResult {
+	res := RecognitionResult{Final: true}
+	if len(results) == 0 {
+		return res
+	}
+
+	var texts []string
+	for _, r := range results {
+		texts = append(texts, r.Text)
+		res.Confidence += r.Confidence
+		if r.Language != "" {
+			res.Language = r.Language
+		}
+	}
+
+	last := results[len(results)-1]
+	res.Text = strings.Join(texts, " ")
+	res.Offset = results[0].Offset
+	res.Duration = last.Offset + last.Duration - res.Offset
+	res.Confidence /= float64(len(results))
+
+	return res
+}
+
+// FormatTimestamp formats the duration as hh:mm:ss.mmm
+func FormatTimestamp(d time.Duration) string {
+	h := d / time.Hour
+	m := d % time.Hour / time.Minute
+	s := d % time.Minute / time.Second
+	ms := d % time.Second / time.Millisecond
+
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, ms)
+}
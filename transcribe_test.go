@@ -0,0 +1,145 @@
+package hal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeContinuousSpeechRecognition struct {
+	audio      bytes.Buffer
+	recognized chan RecognitionResult
+}
+
+func (f *fakeContinuousSpeechRecognition) StartContinuous() error {
+	f.recognized = make(chan RecognitionResult)
+	return nil
+}
+
+func (f *fakeContinuousSpeechRecognition) SpeechToText(data []byte) error {
+	_, err := f.audio.Write(data)
+	return err
+}
+
+func (f *fakeContinuousSpeechRecognition) CloseStream() error {
+	go func() {
+		defer close(f.recognized)
+		f.recognized <- RecognitionResult{Text: "Hel", Offset: 500 * time.Millisecond, Duration: 300 * time.Millisecond}
+		f.recognized <- RecognitionResult{Text: "Hello.", Offset: 500 * time.Millisecond, Duration: time.Second, Final: true}
+		f.recognized <- RecognitionResult{Text: fmt.Sprintf("%d bytes.", f.audio.Len()), Offset: 2 * time.Second, Duration: time.Second, Final: true}
+	}()
+
+	return nil
+}
+
+func (f *fakeContinuousSpeechRecognition) Recognized() <-chan RecognitionResult {
+	return f.recognized
+}
+
+func (f *fakeContinuousSpeechRecognition) StopContinuous() error {
+	return nil
+}
+
+func (f *fakeContinuousSpeechRecognition) Close() error {
+	return nil
+}
+
+func TestTranscribe(t *testing.T) {
+	var out strings.Builder
+	text, err := Transcribe(&fakeContinuousSpeechRecognition{}, bytes.NewReader(make([]byte, 10000)), &out)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello. 10000 bytes.", text)
+	assert.Equal(t, "[00:00:00.500 --> 00:00:01.500] Hello.\n[00:00:02.000 --> 00:00:03.000] 10000 bytes.\n", out.String())
+}
+
+func TestTranscribeWav(t *testing.T) {
+	sr, err := NewContinuousSpeechRecognitionFromParams(PARAMS)
+	if errors.Is(err, ErrWhisperNotFound) {
+		t.Skip(err)
+	}
+	assert.Nil(t, err)
+	defer sr.Close()
+
+	f, err := os.Open("./test_data/jfk.wav")
+	assert.Nil(t, err)
+	defer f.Close()
+
+	_, audio, err := ReadWav(f)
+	assert.Nil(t, err)
+
+	text, err := Transcribe(sr, audio, os.Stdout)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(strings.ToLower(text), "your country"))
+}
+
+func TestDictate(t *testing.T) {
+	sr := &fakeContinuousSpeechRecognition{}
+	sr.audio.WriteString("speech")
+	sr.StartContinuous()
+	sr.CloseStream()
+
+	var out strings.Builder
+	res, err := Dictate(&startedSpeechRecognition{sr}, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, RecognitionResult{Text: "Hello. 6 bytes.", Offset: 500 * time.Millisecond, Duration: 2500 * time.Millisecond, Final: true}, res)
+	assert.Equal(t, "\r\033[KHel\r\033[KHello.\r\033[KHello. 6 bytes.\n", out.String())
+}
+
+// startedSpeechRecognition is already recognizing when StartContinuous is called.
+type startedSpeechRecognition struct {
+	*fakeContinuousSpeechRecognition
+}
+
+func (s *startedSpeechRecognition) StartContinuous() error {
+	return nil
+}
+
+// slowSpeechRecognition recognizes an utterance after it is spoken (e.g. whisper), and the last one while stopping.
+type slowSpeechRecognition struct {
+	fakeContinuousSpeechRecognition
+	speaking int32
+}
+
+func (s *slowSpeechRecognition) StartContinuous() error {
+	s.recognized = make(chan RecognitionResult, 1)
+	atomic.StoreInt32(&s.speaking, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		s.recognized <- RecognitionResult{Text: "A long utterance.", Final: true}
+		atomic.StoreInt32(&s.speaking, 0)
+	}()
+
+	return nil
+}
+
+func (s *slowSpeechRecognition) Speaking() bool {
+	return atomic.LoadInt32(&s.speaking) == 1
+}
+
+func (s *slowSpeechRecognition) StopContinuous() error {
+	s.recognized <- RecognitionResult{Text: "The last one.", Final: true}
+	close(s.recognized)
+	return nil
+}
+
+func TestDictateSlowRecognition(t *testing.T) {
+	defer func(timeouts Timeouts) { TIMEOUTS = timeouts }(TIMEOUTS)
+	TIMEOUTS.InitialSilenceTimeoutMs, TIMEOUTS.DictationSilenceTimeoutMs = 20, 20
+
+	var out strings.Builder
+	res, err := Dictate(&slowSpeechRecognition{}, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, "A long utterance. The last one.", res.Text)
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	assert.Equal(t, "00:00:00.000", FormatTimestamp(0))
+	assert.Equal(t, "01:02:03.040", FormatTimestamp(time.Hour+2*time.Minute+3*time.Second+40*time.Millisecond))
+}
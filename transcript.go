@@ -0,0 +1,83 @@
+package hal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Transcript logs the conversation of a session to a text file, one line for a turn. The audio of turns
+// are saved in the directory named by the session beside the file.
+type Transcript struct {
+	dir     string
+	session string
+}
+
+// NewTranscript creates the transcript of session in dir, the lines are appended to the existing one.
+func NewTranscript(dir, session string) (*Transcript, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transcript{dir: dir, session: session}, nil
+}
+
+// AudioFile returns the path of the audio of a turn, e.g. the prompt or answer.
+func (t *Transcript) AudioFile(role, ext string) (string, error) {
+	dir := filepath.Join(t.dir, t.session)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, time.Now().Format("20060102-150405.000")+"-"+role+ext), nil
+}
+
+// LogPrompt logs what is recognized, with the language and confidence if they are known, and the
+// audio file if it is recorded.
+func (t *Transcript) LogPrompt(res RecognitionResult, audio string) error {
+	var details []string
+	if res.Language != "" {
+		details = append(details, res.Language)
+	}
+
+	if res.Confidence > 0 {
+		details = append(details, fmt.Sprintf("%.0f%%", res.Confidence*100))
+	}
+
+	role := "user"
+	if len(details) > 0 {
+		role += " (" + strings.Join(details, ", ") + ")"
+	}
+
+	return t.log(role, res.Text, audio)
+}
+
+// LogAnswer logs the answer of chatgpt, and the audio file if it is recorded.
+func (t *Transcript) LogAnswer(text, audio string) error {
+	return t.log("assistant", text, audio)
+}
+
+func (t *Transcript) log(role, text, audio string) error {
+	f, err := os.OpenFile(filepath.Join(t.dir, t.session+".log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	line := fmt.Sprintf("%s [%s] %s", time.Now().Format("2006-01-02 15:04:05"), role, strings.TrimSpace(text))
+	if audio != "" {
+		// relative to the transcript, so the directory can be moved
+		if rel, err := filepath.Rel(t.dir, audio); err == nil {
+			audio = rel
+		}
+
+		line += fmt.Sprintf(" <%s>", audio)
+	}
+
+	_, err = fmt.Fprintln(f, line)
+	return err
+}
@@ -0,0 +1,37 @@
+package hal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscript(t *testing.T) {
+	dir, err := os.MkdirTemp("./test_data", "transcripts")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	tr, err := NewTranscript(dir, "default")
+	assert.Nil(t, err)
+
+	audio, err := tr.AudioFile("answer", ".mp3")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "default"), filepath.Dir(audio))
+	assert.True(t, strings.HasSuffix(audio, "-answer.mp3"))
+
+	assert.Nil(t, tr.LogPrompt(RecognitionResult{Text: "Bonjour.", Language: "fr-FR", Confidence: 0.934}, ""))
+	assert.Nil(t, tr.LogPrompt(RecognitionResult{Text: "Hello."}, ""))
+	assert.Nil(t, tr.LogAnswer("Salut !\n", audio))
+
+	data, err := os.ReadFile(filepath.Join(dir, "default.log"))
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.True(t, strings.HasSuffix(lines[0], " [user (fr-FR, 93%)] Bonjour."))
+	assert.True(t, strings.HasSuffix(lines[1], " [user] Hello."))
+	assert.True(t, strings.HasSuffix(lines[2], " [assistant] Salut ! <default/"+filepath.Base(audio)+">"))
+}
@@ -0,0 +1,148 @@
+package hal
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const (
+	// DefaultVADSensitivity detects the speech about SpeechEnergyThreshold in a quiet room.
+	DefaultVADSensitivity = 0.5
+	// maxSpeechZeroCrossing is the zero-crossing rate above which a frame is hiss or clicks rather than speech.
+	maxSpeechZeroCrossing = 0.5
+	// vadPreRoll is the audio kept before the speech is detected, so its beginning is not cut.
+	vadPreRoll = 300 * time.Millisecond
+)
+
+// VoiceActivityDetector detects the speech in frames of 16 bits mono PCM (DefaultPCMFormat) by their energy and
+// zero-crossing rate. The energy of speech must be above both the threshold of Sensitivity and the noise floor
+// estimated from the frames heard.
+type VoiceActivityDetector struct {
+	Sensitivity float64       // 0 to 1, the higher the quieter speech is detected
+	Silence     time.Duration // the silence ending an utterance, SegmentationSilenceTimeoutMs of TIMEOUTS if 0
+
+	noise     float64       // the RMS level of the noise floor
+	pending   [][]byte      // the frames before the speech is detected, vadPreRoll at most
+	utterance bool          // the audio is passed by Gate until the silence ends the utterance
+	silence   time.Duration // the silence after the last frame of speech in the utterance
+}
+
+func NewVoiceActivityDetector(sensitivity float64) *VoiceActivityDetector {
+	return &VoiceActivityDetector{Sensitivity: sensitivity}
+}
+
+// threshold returns the RMS level of speech, SpeechEnergyThreshold at DefaultVADSensitivity, 4 times higher at 0
+// and 4 times lower at 1.
+func (d *VoiceActivityDetector) threshold() float64 {
+	threshold := SpeechEnergyThreshold * math.Pow(4, 2*(DefaultVADSensitivity-d.Sensitivity))
+	if noise := 3 * d.noise; noise > threshold {
+		return noise
+	}
+
+	return threshold
+}
+
+// IsSpeech reports whether the frame is speech, the weaker frames (e.g. fricatives) are speech as well in an
+// utterance (see Gate).
+func (d *VoiceActivityDetector) IsSpeech(frame []byte) bool {
+	level, threshold := pcmLevel(frame), d.threshold()
+	if d.utterance {
+		threshold /= 2
+	}
+
+	speech := level >= threshold && zeroCrossingRate(frame) <= maxSpeechZeroCrossing
+	// follows the noise floor in silence, and very slowly in speech, so a steady noise (e.g. a fan) louder than
+	// the threshold is not speech for long
+	rate := 0.05
+	if speech {
+		rate = 0.002
+	}
+
+	d.noise = (1-rate)*d.noise + rate*level
+	return speech
+}
+
+// Gate returns the audio of the frame to be sent to the speech recognition, nothing in silence. The frames before
+// the speech (vadPreRoll) are returned with the first frame of speech (started is true). The audio is returned
+// until the silence after the speech lasts Silence, so the pauses of slow speakers don't end the utterance, and
+// the speech recognition ends it by the silence heard.
+func (d *VoiceActivityDetector) Gate(frame []byte) (audio []byte, started bool) {
+	speech := d.IsSpeech(frame)
+	if d.utterance {
+		d.silence += pcmDuration(frame)
+		if speech {
+			d.silence = 0
+		}
+
+		if d.silence >= d.segmentation() {
+			d.utterance, d.silence = false, 0
+		}
+
+		return frame, false
+	}
+
+	if speech {
+		for _, f := range d.pending {
+			audio = append(audio, f...)
+		}
+
+		d.pending, d.utterance, d.silence = nil, true, 0
+		return append(audio, frame...), true
+	}
+
+	d.pending = append(d.pending, frame)
+	var kept time.Duration
+	for i := len(d.pending) - 1; i >= 0; i-- {
+		if kept += pcmDuration(d.pending[i]); kept > vadPreRoll {
+			d.pending = d.pending[i+1:]
+			break
+		}
+	}
+
+	return nil, false
+}
+
+func (d *VoiceActivityDetector) segmentation() time.Duration {
+	if d.Silence > 0 {
+		return d.Silence
+	}
+
+	return time.Duration(TIMEOUTS.SegmentationSilenceTimeoutMs) * time.Millisecond
+}
+
+// Utterance reports whether the audio is passed by Gate, from the speech detected to the silence ending it.
+func (d *VoiceActivityDetector) Utterance() bool {
+	return d.utterance
+}
+
+// Reset forgets the speech detected, the noise floor is kept.
+func (d *VoiceActivityDetector) Reset() {
+	d.pending, d.utterance, d.silence = nil, false, 0
+}
+
+// zeroCrossingRate returns the ratio of adjacent samples changing sign in 16 bits mono PCM.
+func zeroCrossingRate(frame []byte) float64 {
+	n := len(frame) / 2
+	if n < 2 {
+		return 0
+	}
+
+	var crossings int
+	prev := int16(binary.LittleEndian.Uint16(frame))
+	for i := 1; i < n; i++ {
+		v := int16(binary.LittleEndian.Uint16(frame[2*i:]))
+		if (v >= 0) != (prev >= 0) {
+			crossings++
+		}
+
+		prev = v
+	}
+
+	return float64(crossings) / float64(n-1)
+}
+
+// pcmDuration returns the duration of the audio in DefaultPCMFormat.
+func pcmDuration(audio []byte) time.Duration {
+	return time.Duration(len(audio)) * time.Second / time.Duration(DefaultPCMFormat.BytesPerSecond())
+}
@@ -0,0 +1,109 @@
+package hal
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// toneFrame returns 30ms of a 200Hz tone in DefaultPCMFormat.
+func toneFrame(amplitude float64) []byte {
+	frame := make([]byte, DefaultPCMFormat.BytesPerSecond()*30/1000)
+	for i := 0; i < len(frame)/2; i++ {
+		v := amplitude * math.Sin(2*math.Pi*200*float64(i)/float64(DefaultPCMFormat.SampleRate))
+		binary.LittleEndian.PutUint16(frame[2*i:], uint16(int16(v)))
+	}
+
+	return frame
+}
+
+// noiseFrame returns 30ms of white noise in DefaultPCMFormat.
+func noiseFrame(amplitude float64) []byte {
+	frame := make([]byte, DefaultPCMFormat.BytesPerSecond()*30/1000)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < len(frame)/2; i++ {
+		binary.LittleEndian.PutUint16(frame[2*i:], uint16(int16(amplitude*(2*r.Float64()-1))))
+	}
+
+	return frame
+}
+
+func TestZeroCrossingRate(t *testing.T) {
+	assert.Equal(t, 0.0, zeroCrossingRate(make([]byte, 960)))
+	assert.InDelta(t, 0.025, zeroCrossingRate(toneFrame(1000)), 0.005)
+	assert.Greater(t, zeroCrossingRate(noiseFrame(1000)), maxSpeechZeroCrossing)
+}
+
+func TestVoiceActivityDetector(t *testing.T) {
+	d := NewVoiceActivityDetector(DefaultVADSensitivity)
+	silence := make([]byte, len(toneFrame(0)))
+	assert.False(t, d.IsSpeech(silence))
+	assert.False(t, d.IsSpeech(noiseFrame(3000)))
+	assert.True(t, d.IsSpeech(toneFrame(3000)))
+	assert.False(t, d.IsSpeech(silence))
+
+	// the quieter speech is detected by the higher sensitivity
+	quiet := toneFrame(400)
+	assert.False(t, NewVoiceActivityDetector(0.2).IsSpeech(quiet))
+	assert.True(t, NewVoiceActivityDetector(0.8).IsSpeech(quiet))
+}
+
+func TestVoiceActivityDetectorNoiseFloor(t *testing.T) {
+	d := NewVoiceActivityDetector(DefaultVADSensitivity)
+	// a steady fan louder than the threshold is not speech after seconds
+	fan := toneFrame(800)
+	assert.True(t, d.IsSpeech(fan))
+	for i := 0; i < 300; i++ {
+		d.IsSpeech(fan)
+	}
+
+	assert.False(t, d.IsSpeech(fan))
+
+	// the speech must be louder than the noise floor
+	assert.False(t, d.IsSpeech(toneFrame(1500)))
+	assert.True(t, d.IsSpeech(toneFrame(5000)))
+}
+
+func TestVoiceActivityDetectorGate(t *testing.T) {
+	TIMEOUTS.SegmentationSilenceTimeoutMs = 150
+	defer func() { TIMEOUTS = DefaultTimeouts }()
+
+	d := NewVoiceActivityDetector(DefaultVADSensitivity)
+	silence, speech := make([]byte, len(toneFrame(0))), toneFrame(3000)
+	for i := 0; i < 20; i++ {
+		audio, started := d.Gate(silence)
+		assert.Empty(t, audio)
+		assert.False(t, started)
+	}
+
+	// the pre-roll is sent with the speech
+	audio, started := d.Gate(speech)
+	assert.True(t, started)
+	assert.Equal(t, 10*len(silence)+len(speech), len(audio))
+	audio, started = d.Gate(speech)
+	assert.False(t, started)
+	assert.Equal(t, speech, audio)
+
+	// a pause shorter than SegmentationSilenceTimeoutMs doesn't end the utterance
+	for i := 0; i < 4; i++ {
+		audio, _ = d.Gate(silence)
+		assert.Equal(t, silence, audio)
+	}
+
+	assert.True(t, d.Utterance())
+	audio, _ = d.Gate(speech)
+	assert.Equal(t, speech, audio)
+
+	// the silence heard ends the utterance after SegmentationSilenceTimeoutMs
+	for i := 0; i < 5; i++ {
+		audio, _ = d.Gate(silence)
+		assert.Equal(t, silence, audio)
+	}
+
+	assert.False(t, d.Utterance())
+	audio, _ = d.Gate(silence)
+	assert.Empty(t, audio)
+}
@@ -0,0 +1,133 @@
+package hal
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrVoicesNotRetrieved = errors.New("voices of speech synthesis not retrieved")
+
+// VoiceCatalogMaxAge is how long the catalog of voices saved is used before it is retrieved again.
+var VoiceCatalogMaxAge = 7 * 24 * time.Hour
+
+// VoiceFilter selects the voices of catalog, the empty fields match any voice.
+type VoiceFilter struct {
+	Locale string // BCP-47 code or the language of it, e.g. en matches en-US and en-GB
+	Gender string // female or male
+	Style  string
+	Neural bool // only the neural voices
+}
+
+func (f VoiceFilter) Match(v *Voice) bool {
+	if f.Locale != "" && !strings.EqualFold(v.Locale, f.Locale) &&
+		!strings.HasPrefix(strings.ToLower(v.Locale), strings.ToLower(f.Locale)+"-") {
+		return false
+	}
+
+	if f.Gender != "" && !strings.EqualFold(v.Gender, f.Gender) {
+		return false
+	}
+
+	if f.Neural && !v.Neural {
+		return false
+	}
+
+	if f.Style == "" {
+		return true
+	}
+
+	for _, s := range v.StyleList {
+		if strings.EqualFold(s, f.Style) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FilterVoices returns the voices matching the filter.
+func FilterVoices(voices []*Voice, f VoiceFilter) []*Voice {
+	var res []*Voice
+	for _, v := range voices {
+		if f.Match(v) {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// LoadVoiceCatalog returns all voices of azure. They are read from VoiceCatalog of params if it is saved in
+// VoiceCatalogMaxAge, otherwise retrieved from azure and saved, or refresh is set.
+func LoadVoiceCatalog(p Params, refresh bool) ([]*Voice, error) {
+	p.VoiceCatalog = DataPath(p.VoiceCatalog)
+	if !refresh && p.VoiceCatalog != "" {
+		if info, err := os.Stat(p.VoiceCatalog); err == nil && time.Since(info.ModTime()) < VoiceCatalogMaxAge {
+			var voices []*Voice
+			data, err := os.ReadFile(p.VoiceCatalog)
+			if err == nil {
+				err = json.Unmarshal(data, &voices)
+			}
+
+			if err == nil {
+				return voices, nil
+			}
+
+			tlog.Errorf("voice catalog %s: %s", p.VoiceCatalog, err)
+		}
+	}
+
+	ss, err := NewAutoDetectedSpeechSynthesisStream(p.SpeechKey, p.SpeechRegion, DefaultAudioFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ss.Close()
+	voices := ss.GetAllSupportVoicesForLanguage("")
+	if len(voices) == 0 {
+		return nil, ErrVoicesNotRetrieved
+	}
+
+	if p.VoiceCatalog != "" {
+		if err = saveVoiceCatalog(p.VoiceCatalog, voices); err != nil {
+			tlog.Errorf("save voice catalog: %s", err)
+		}
+	}
+
+	return voices, nil
+}
+
+func saveVoiceCatalog(file string, voices []*Voice) error {
+	data, err := json.MarshalIndent(voices, "", " ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(file, data)
+}
+
+var voiceSamples = map[string]string{
+	"en": "Hello, I am HAL. How can I help you today?",
+	"zh": "你好，我是 HAL，今天有什么可以帮你的？",
+	"fr": "Bonjour, je suis HAL. Comment puis-je vous aider aujourd'hui ?",
+	"es": "Hola, soy HAL. ¿En qué puedo ayudarte hoy?",
+	"de": "Hallo, ich bin HAL. Wie kann ich dir heute helfen?",
+	"ja": "こんにちは、HAL です。今日は何をお手伝いしましょうか？",
+}
+
+// VoiceSample returns a sentence to preview the voices of locale, in english if the language is unknown.
+func VoiceSample(locale string) string {
+	if s, ok := voiceSamples[strings.ToLower(strings.Split(locale, "-")[0])]; ok {
+		return s
+	}
+
+	return voiceSamples["en"]
+}
@@ -0,0 +1,55 @@
+package hal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testVoices = []*Voice{
+	{Name: "en-US-JennyNeural", Locale: "en-US", Gender: "female", Neural: true, StyleList: []string{"cheerful", "sad"}},
+	{Name: "en-GB-RyanNeural", Locale: "en-GB", Gender: "male", Neural: true, StyleList: []string{"Cheerful"}},
+	{Name: "en-US-Guy", Locale: "en-US", Gender: "male"},
+	{Name: "zh-CN-XiaoxiaoNeural", Locale: "zh-CN", Gender: "female", Neural: true},
+}
+
+func voiceNames(voices []*Voice) []string {
+	var names []string
+	for _, v := range voices {
+		names = append(names, v.Name)
+	}
+
+	return names
+}
+
+func TestFilterVoices(t *testing.T) {
+	for _, c := range []struct {
+		filter   VoiceFilter
+		expected []string
+	}{
+		{VoiceFilter{}, []string{"en-US-JennyNeural", "en-GB-RyanNeural", "en-US-Guy", "zh-CN-XiaoxiaoNeural"}},
+		{VoiceFilter{Locale: "en"}, []string{"en-US-JennyNeural", "en-GB-RyanNeural", "en-US-Guy"}},
+		{VoiceFilter{Locale: "en-us", Gender: "Male"}, []string{"en-US-Guy"}},
+		{VoiceFilter{Style: "cheerful"}, []string{"en-US-JennyNeural", "en-GB-RyanNeural"}},
+		{VoiceFilter{Locale: "e"}, nil},
+		{VoiceFilter{Neural: true, Gender: "female"}, []string{"en-US-JennyNeural", "zh-CN-XiaoxiaoNeural"}},
+	} {
+		assert.Equal(t, c.expected, voiceNames(FilterVoices(testVoices, c.filter)), c.filter)
+	}
+}
+
+func TestLoadVoiceCatalog(t *testing.T) {
+	file := filepath.Join("test_data", "voices.json")
+	defer os.Remove(file)
+	assert.Nil(t, saveVoiceCatalog(file, testVoices))
+	voices, err := LoadVoiceCatalog(Params{VoiceCatalog: file}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, testVoices, voices)
+}
+
+func TestVoiceSample(t *testing.T) {
+	assert.Equal(t, "你好，我是 HAL，今天有什么可以帮你的？", VoiceSample("zh-CN"))
+	assert.Equal(t, VoiceSample("en-US"), VoiceSample("ko-KR"))
+}
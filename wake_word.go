@@ -0,0 +1,152 @@
+package hal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// maxWakeWordErrors is the consecutive errors of speech recognition the detector gives up after, e.g. a bad key
+	// or a missing whisper binary.
+	maxWakeWordErrors = 5
+	// maxWakeWordRetryDelay is the longest wait before the speech recognition is retried after an error.
+	maxWakeWordRetryDelay = 10 * time.Second
+)
+
+// WakeWordDetector waits for the activation phrase (keyword) of HAL.
+type WakeWordDetector interface {
+	Start() error
+	// Result blocks until the keyword is detected, and returns it.
+	Result() (string, error)
+	Close() error
+}
+
+// TranscriptionWakeWordDetector detects the keyword by transcribing what is heard, so any phrase can be
+// the keyword without a model. It is better to use with an energy-gated local engine (e.g. whisper),
+// which only transcribes when somebody is talking.
+type TranscriptionWakeWordDetector struct {
+	sr         SpeechRecognition
+	KeyWord    string
+	retryDelay time.Duration // the wait after the first error, doubled after each one
+}
+
+func NewTranscriptionWakeWordDetector(sr SpeechRecognition, keyword string) *TranscriptionWakeWordDetector {
+	return &TranscriptionWakeWordDetector{sr: sr, KeyWord: keyword, retryDelay: 500 * time.Millisecond}
+}
+
+func (d *TranscriptionWakeWordDetector) Start() error {
+	return nil
+}
+
+// Result retries the speech recognition after an error with backoff, and fails after maxWakeWordErrors in a row.
+func (d *TranscriptionWakeWordDetector) Result() (string, error) {
+	var failures int
+	delay := d.retryDelay
+	for {
+		err := d.sr.Start()
+		if err != nil {
+			return "", err
+		}
+
+		res, err := d.sr.Result()
+		if err != nil {
+			if failures++; failures >= maxWakeWordErrors {
+				return "", fmt.Errorf("wake word: %d errors in a row: %w", failures, err)
+			}
+
+			tlog.Warningf("wake word: %s, retry in %s", err, delay)
+			time.Sleep(delay)
+			if delay *= 2; delay > maxWakeWordRetryDelay {
+				delay = maxWakeWordRetryDelay
+			}
+
+			continue
+		}
+
+		failures, delay = 0, d.retryDelay
+
+		if res.Text == "" {
+			continue
+		}
+
+		tlog.Debugf("wake word heard: %s", res.Text)
+		if matchWakeWord(res.Text, d.KeyWord) {
+			return d.KeyWord, nil
+		}
+	}
+}
+
+func (d *TranscriptionWakeWordDetector) Close() error {
+	return d.sr.Close()
+}
+
+// matchWakeWord reports whether the keyword is in text, allowing a few misrecognized letters
+// (e.g. "Harald" for "Harold").
+func matchWakeWord(text, keyword string) bool {
+	t, k := normalize(text), normalize(keyword)
+	if k == "" {
+		return false
+	}
+
+	if strings.Contains(" "+t+" ", " "+k+" ") {
+		return true
+	}
+
+	// languages without space between words, e.g. chinese
+	if len([]rune(k)) != len(k) && strings.Contains(strings.ReplaceAll(t, " ", ""), strings.ReplaceAll(k, " ", "")) {
+		return true
+	}
+
+	maxDistance := len([]rune(k)) / 4
+	if maxDistance == 0 {
+		return false
+	}
+
+	words, n := strings.Fields(t), len(strings.Fields(k))
+	for i := 0; i+n <= len(words); i++ {
+		if editDistance(strings.Join(words[i:i+n], " "), k) <= maxDistance {
+			return true
+		}
+	}
+
+	return false
+}
+
+// editDistance is the levenshtein distance of runes.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+
+	if c < a {
+		a = c
+	}
+
+	return a
+}
@@ -0,0 +1,74 @@
+package hal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSpeechRecognition struct {
+	texts []string
+	err   error
+}
+
+func (f *fakeSpeechRecognition) Start() error {
+	return nil
+}
+
+func (f *fakeSpeechRecognition) SpeechToText(data []byte) error {
+	return nil
+}
+
+func (f *fakeSpeechRecognition) Result() (RecognitionResult, error) {
+	if f.err != nil {
+		return RecognitionResult{}, f.err
+	}
+
+	text := f.texts[0]
+	f.texts = f.texts[1:]
+	return RecognitionResult{Text: text, Final: true}, nil
+}
+
+func (f *fakeSpeechRecognition) Close() error {
+	return nil
+}
+
+func TestMatchWakeWord(t *testing.T) {
+	assert.True(t, matchWakeWord("Harold.", "harold"))
+	assert.True(t, matchWakeWord("Hey, Harald!", "Harold"))
+	assert.True(t, matchWakeWord("ok computer please", "OK computer"))
+	assert.True(t, matchWakeWord("你好小哈", "小哈"))
+	assert.False(t, matchWakeWord("hello world", "harold"))
+	assert.False(t, matchWakeWord("halt", "hal"))
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("harold", "harold"))
+	assert.Equal(t, 1, editDistance("harald", "harold"))
+	assert.Equal(t, 3, editDistance("kitten", "sitting"))
+	assert.Equal(t, 2, editDistance("你好", ""))
+}
+
+func TestTranscriptionWakeWordDetector(t *testing.T) {
+	sr := &fakeSpeechRecognition{texts: []string{"", "what's the weather", "Harold?"}}
+	d := NewTranscriptionWakeWordDetector(sr, "harold")
+	assert.Nil(t, d.Start())
+
+	r, err := d.Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "harold", r)
+	assert.Empty(t, sr.texts)
+
+	assert.Nil(t, d.Close())
+}
+
+func TestTranscriptionWakeWordDetectorErrors(t *testing.T) {
+	sr := &fakeSpeechRecognition{err: errors.New("bad key")}
+	d := NewTranscriptionWakeWordDetector(sr, "harold")
+	d.retryDelay = time.Millisecond
+
+	_, err := d.Result()
+	assert.ErrorIs(t, err, sr.err)
+}
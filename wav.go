@@ -0,0 +1,107 @@
+package hal
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var ErrInvalidWav = errors.New("invalid wav format")
+
+// PCMFormat describe the format of PCM audio data (little endian, signed).
+type PCMFormat struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+}
+
+// DefaultPCMFormat is the format accepted by speech recognition push streams.
+var DefaultPCMFormat = PCMFormat{SampleRate: 16000, Channels: 1, BitsPerSample: 16}
+
+func (f PCMFormat) BytesPerSecond() int {
+	return f.SampleRate * f.Channels * f.BitsPerSample / 8
+}
+
+// ReadWav reads the header of a wav (RIFF) stream, returns the format and a reader of the PCM data.
+func ReadWav(r io.Reader) (PCMFormat, io.Reader, error) {
+	var format PCMFormat
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return format, nil, err
+	}
+
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return format, nil, ErrInvalidWav
+	}
+
+	var chunk [8]byte
+	for {
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return format, nil, ErrInvalidWav
+		}
+
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		switch string(chunk[:4]) {
+		case "fmt ":
+			fmtChunk := make([]byte, size)
+			if _, err := io.ReadFull(r, fmtChunk); err != nil || size < 16 {
+				return format, nil, ErrInvalidWav
+			}
+
+			// only PCM (1) or extensible (0xFFFE) are supported
+			if tag := binary.LittleEndian.Uint16(fmtChunk); tag != 1 && tag != 0xFFFE {
+				return format, nil, ErrInvalidWav
+			}
+
+			format.Channels = int(binary.LittleEndian.Uint16(fmtChunk[2:]))
+			format.SampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:]))
+			format.BitsPerSample = int(binary.LittleEndian.Uint16(fmtChunk[14:]))
+		case "data":
+			if format.SampleRate == 0 {
+				return format, nil, ErrInvalidWav
+			}
+
+			// size is 0 or 0xFFFFFFFF when written by a stream, read until EOF
+			if size == 0 || size == 0xFFFFFFFF {
+				return format, r, nil
+			}
+
+			return format, io.LimitReader(r, size), nil
+		default:
+			// chunks are word aligned
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return format, nil, ErrInvalidWav
+			}
+		}
+	}
+}
+
+// WriteWavHeader writes a wav header for dataSize bytes PCM data.
+func WriteWavHeader(w io.Writer, format PCMFormat, dataSize int) error {
+	header := make([]byte, 44)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+dataSize))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1)
+	binary.LittleEndian.PutUint16(header[22:], uint16(format.Channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(format.SampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(format.BytesPerSecond()))
+	binary.LittleEndian.PutUint16(header[32:], uint16(format.Channels*format.BitsPerSample/8))
+	binary.LittleEndian.PutUint16(header[34:], uint16(format.BitsPerSample))
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(dataSize))
+
+	_, err := w.Write(header)
+	return err
+}
+
+// WriteWav writes PCM data as a wav file.
+func WriteWav(w io.Writer, format PCMFormat, data []byte) error {
+	if err := WriteWavHeader(w, format, len(data)); err != nil {
+		return err
+	}
+
+	_, err := w.Write(data)
+	return err
+}
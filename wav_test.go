@@ -0,0 +1,45 @@
+package hal
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadWav(t *testing.T) {
+	f, err := os.Open("./test_data/jfk.wav")
+	assert.Nil(t, err)
+	defer f.Close()
+
+	format, data, err := ReadWav(f)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultPCMFormat, format)
+
+	pcm, err := io.ReadAll(data)
+	assert.Nil(t, err)
+	// 11 seconds
+	assert.Equal(t, 11, len(pcm)/format.BytesPerSecond())
+}
+
+func TestWriteWav(t *testing.T) {
+	pcm := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	format := PCMFormat{SampleRate: 8000, Channels: 2, BitsPerSample: 16}
+
+	var b bytes.Buffer
+	assert.Nil(t, WriteWav(&b, format, pcm))
+	assert.Equal(t, 44+len(pcm), b.Len())
+
+	actual, data, err := ReadWav(&b)
+	assert.Nil(t, err)
+	assert.Equal(t, format, actual)
+
+	res, err := io.ReadAll(data)
+	assert.Nil(t, err)
+	assert.Equal(t, pcm, res)
+
+	_, _, err = ReadWav(bytes.NewReader([]byte("RIFF....WAVX")))
+	assert.ErrorIs(t, err, ErrInvalidWav)
+}
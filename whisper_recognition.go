@@ -0,0 +1,596 @@
+package hal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrWhisperNotFound = errors.New("whisper binary or model not found")
+	// SpeechEnergyThreshold is the RMS level of 16 bits PCM above which a frame is treated as speech.
+	SpeechEnergyThreshold = 500.0
+)
+
+// WhisperSpeechRecognition is an offline speech recognition running whisper.cpp (https://github.com/ggerganov/whisper.cpp)
+// as a subprocess. Audio pushed by SpeechToText must be in DefaultPCMFormat.
+type WhisperSpeechRecognition struct {
+	binary     string
+	model      string
+	languages  []string
+	prompt     string // the initial prompt of whisper.cpp, for the phrases
+	recorder   *AudioRecorder
+	mu         sync.Mutex
+	audio      bytes.Buffer
+	recognized chan RecognitionResult
+	cmd        *exec.Cmd
+	exited     chan error // the error of cmd transcribing the stream, sent when it exits
+	err        error      // the error of continuous recognition from microphone, see WhisperSpeechRecognitionStandalone
+	speechTimeouts
+}
+
+func NewWhisperSpeechRecognition(binary, model string, languages []string) (*WhisperSpeechRecognition, error) {
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrWhisperNotFound, err)
+	}
+
+	if _, err = os.Stat(model); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrWhisperNotFound, err)
+	}
+
+	return &WhisperSpeechRecognition{binary: path, model: model, languages: languages}, nil
+}
+
+func NewAutoDetectedWhisperSpeechRecognition(binary, model string) (*WhisperSpeechRecognition, error) {
+	return NewWhisperSpeechRecognition(binary, model, GetAutoDetectedLanguages())
+}
+
+func (s *WhisperSpeechRecognition) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.audio.Reset()
+	return nil
+}
+
+func (s *WhisperSpeechRecognition) SpeechToText(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.audio.Write(data)
+	return err
+}
+
+func (s *WhisperSpeechRecognition) Result() (RecognitionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.record()
+	return s.transcribe(s.audio.Bytes())
+}
+
+func (s *WhisperSpeechRecognition) Record(r *AudioRecorder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recorder = r
+}
+
+// record saves the audio heard, it must be called with mu held.
+func (s *WhisperSpeechRecognition) record() {
+	if s.recorder == nil || s.audio.Len() == 0 {
+		return
+	}
+
+	if err := s.recorder.WritePCM(DefaultPCMFormat, s.audio.Bytes()); err != nil {
+		tlog.Errorf("record speech: %s", err)
+	}
+}
+
+func (s *WhisperSpeechRecognition) Close() error {
+	return nil
+}
+
+func (s *WhisperSpeechRecognition) StartContinuous() error {
+	s.recognized = make(chan RecognitionResult, 64)
+
+	return s.Start()
+}
+
+// CloseStream starts to transcribe the pushed audio, because whisper.cpp can't recognize a stream.
+func (s *WhisperSpeechRecognition) CloseStream() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.record()
+	f, err := os.CreateTemp("", "hal*.wav")
+	if err != nil {
+		return err
+	}
+
+	err = WriteWav(f, DefaultPCMFormat, s.audio.Bytes())
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	var stderr whisperStderr
+	s.cmd = exec.Command(s.binary, s.args(f.Name(), "-np")...)
+	s.cmd.Stderr = &stderr
+	stdout, err := s.cmd.StdoutPipe()
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err = s.cmd.Start(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	s.exited = make(chan error, 1)
+	go func(cmd *exec.Cmd, recognized chan RecognitionResult, exited chan error) {
+		defer os.Remove(f.Name())
+		defer close(recognized)
+
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if res, ok := parseWhisperSegment(scanner.Text()); ok {
+				tlog.Debugf("Recognized: %s", res.Text)
+				res.Language = s.sourceLanguage(stderr.String())
+				recognized <- res
+			}
+		}
+
+		err := cmd.Wait()
+		if err != nil {
+			err = fmt.Errorf("whisper: %s: %s", err, strings.TrimSpace(stderr.String()))
+		}
+
+		exited <- err
+	}(s.cmd, s.recognized, s.exited)
+
+	return nil
+}
+
+func (s *WhisperSpeechRecognition) Recognized() <-chan RecognitionResult {
+	return s.recognized
+}
+
+// StopContinuous kills whisper.cpp if it is still transcribing, the error is returned if it exited by itself.
+func (s *WhisperSpeechRecognition) StopContinuous() error {
+	s.mu.Lock()
+	cmd, exited := s.cmd, s.exited
+	s.cmd, s.exited = nil, nil
+	s.mu.Unlock()
+
+	if cmd == nil {
+		return nil
+	}
+
+	select {
+	case err := <-exited:
+		return err
+	default:
+	}
+
+	cmd.Process.Kill()
+	<-exited
+	return nil
+}
+
+// SetPhrases hints whisper.cpp the phrases by the initial prompt.
+func (s *WhisperSpeechRecognition) SetPhrases(phrases []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prompt = strings.Join(phrases, ", ")
+	return nil
+}
+
+// args returns the arguments of whisper.cpp to transcribe the wav file.
+func (s *WhisperSpeechRecognition) args(file string, flags ...string) []string {
+	args := []string{"-m", s.model, "-f", file, "-l", s.language()}
+	if s.prompt != "" {
+		args = append(args, "--prompt", s.prompt)
+	}
+
+	return append(args, flags...)
+}
+
+// language converts the BCP-47 code to whisper language, auto for more than one language.
+func (s *WhisperSpeechRecognition) language() string {
+	if len(s.languages) != 1 || s.languages[0] == "" {
+		return "auto"
+	}
+
+	return strings.ToLower(strings.Split(s.languages[0], "-")[0])
+}
+
+// sourceLanguage returns the BCP-47 code of the language detected in the log of whisper.cpp, it is one of
+// the configured languages if they have the same language code.
+func (s *WhisperSpeechRecognition) sourceLanguage(log string) string {
+	if len(s.languages) == 1 {
+		return s.languages[0]
+	}
+
+	detected, _ := parseWhisperLanguage(log)
+	if detected == "" {
+		return ""
+	}
+
+	for _, l := range s.languages {
+		if strings.EqualFold(strings.Split(l, "-")[0], detected) {
+			return l
+		}
+	}
+
+	return detected
+}
+
+func (s *WhisperSpeechRecognition) transcribe(pcm []byte) (RecognitionResult, error) {
+	res := RecognitionResult{Duration: time.Duration(len(pcm)) * time.Second / time.Duration(DefaultPCMFormat.BytesPerSecond()), Final: true}
+	if len(pcm) == 0 {
+		return res, nil
+	}
+
+	f, err := os.CreateTemp("", "hal*.wav")
+	if err != nil {
+		return res, err
+	}
+
+	defer os.Remove(f.Name())
+	err = WriteWav(f, DefaultPCMFormat, pcm)
+	f.Close()
+	if err != nil {
+		return res, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeouts().recognitionDelay())
+	defer cancel()
+
+	var stderr whisperStderr
+	cmd := exec.CommandContext(ctx, s.binary, s.args(f.Name(), "-nt", "-np")...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return res, ErrSpeechRecognitionTimeout
+	}
+
+	if err != nil {
+		return res, fmt.Errorf("whisper: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	res.Text = parseWhisperOutput(string(out))
+	if res.Text != "" {
+		res.Language = s.sourceLanguage(stderr.String())
+	}
+
+	tlog.Debugf("Recognized: %s (%s)", res.Text, res.Language)
+
+	return res, nil
+}
+
+// whisperStderr keeps the log of whisper.cpp, it can be read while whisper.cpp is running.
+type whisperStderr struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *whisperStderr) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.buf.Write(p)
+}
+
+func (w *whisperStderr) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.buf.String()
+}
+
+// parseWhisperLanguage finds the auto detected language in the log of whisper.cpp,
+// e.g. "whisper_full_with_state: auto-detected language: en (p = 0.976807)".
+func parseWhisperLanguage(log string) (string, float64) {
+	const prefix = "auto-detected language: "
+	i := strings.Index(log, prefix)
+	if i < 0 {
+		return "", 0
+	}
+
+	var language string
+	var p float64
+	fmt.Sscanf(log[i+len(prefix):], "%s (p = %f)", &language, &p)
+	return language, p
+}
+
+// parseWhisperOutput joins the text lines, and drops the annotations like [BLANK_AUDIO] or (music).
+func parseWhisperOutput(out string) string {
+	var res []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || isWhisperAnnotation(line) {
+			continue
+		}
+
+		res = append(res, line)
+	}
+
+	return strings.Join(res, " ")
+}
+
+// parseWhisperSegment parses the output line with timestamps, e.g. "[00:00:00.000 --> 00:00:02.500]   Hello."
+func parseWhisperSegment(line string) (RecognitionResult, bool) {
+	var res RecognitionResult
+	line = strings.TrimSpace(line)
+	end := strings.Index(line, "]")
+	if !strings.HasPrefix(line, "[") || end < 0 {
+		return res, false
+	}
+
+	times := strings.Split(line[1:end], " --> ")
+	if len(times) != 2 {
+		return res, false
+	}
+
+	from, err := parseWhisperTimestamp(times[0])
+	if err != nil {
+		return res, false
+	}
+
+	to, err := parseWhisperTimestamp(times[1])
+	if err != nil {
+		return res, false
+	}
+
+	res.Text = strings.TrimSpace(line[end+1:])
+	if res.Text == "" || isWhisperAnnotation(res.Text) {
+		return res, false
+	}
+
+	res.Offset, res.Duration, res.Final = from, to-from, true
+	return res, true
+}
+
+// parseWhisperTimestamp parses hh:mm:ss.mmm
+func parseWhisperTimestamp(t string) (time.Duration, error) {
+	var h, m, sec, ms int
+	_, err := fmt.Sscanf(strings.TrimSpace(t), "%d:%d:%d.%d", &h, &m, &sec, &ms)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second + time.Duration(ms)*time.Millisecond, nil
+}
+
+func isWhisperAnnotation(line string) bool {
+	return (strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]")) ||
+		(strings.HasPrefix(line, "(") && strings.HasSuffix(line, ")"))
+}
+
+// WhisperSpeechRecognitionStandalone records an utterance from the microphone (by AudioCapture), and
+// recognizes it by whisper.cpp.
+type WhisperSpeechRecognitionStandalone struct {
+	WhisperSpeechRecognition
+	VAD      *VoiceActivityDetector // detects the speech starting and ending an utterance
+	capture  AudioCapture
+	done     chan error
+	stop     chan struct{}
+	finished chan struct{} // closed after the continuous recognition ends
+	speaking int32         // 1 if the speech is heard and not ended, accessed atomically
+}
+
+func NewWhisperSpeechRecognitionStandalone(binary, model string, languages []string) (*WhisperSpeechRecognitionStandalone, error) {
+	capture, err := NewArecordCapture(DefaultPCMFormat, 30*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrWhisperNotFound, err)
+	}
+
+	if _, err = os.Stat(model); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrWhisperNotFound, err)
+	}
+
+	res := &WhisperSpeechRecognitionStandalone{VAD: NewVoiceActivityDetector(DefaultVADSensitivity), capture: capture}
+	res.binary = path
+	res.model = model
+	res.languages = languages
+
+	return res, nil
+}
+
+func NewAutoDetectedWhisperSpeechRecognitionStandalone(binary, model string) (*WhisperSpeechRecognitionStandalone, error) {
+	return NewWhisperSpeechRecognitionStandalone(binary, model, GetAutoDetectedLanguages())
+}
+
+func (s *WhisperSpeechRecognitionStandalone) Start() error {
+	return s.startRecording(nil)
+}
+
+func (s *WhisperSpeechRecognitionStandalone) startRecording(stop <-chan struct{}) error {
+	s.WhisperSpeechRecognition.Start()
+
+	frames, err := s.capture.Start()
+	if err != nil {
+		return err
+	}
+
+	s.done = make(chan error, 1)
+	go func() {
+		err := s.record(frames, stop)
+		if stopErr := s.capture.Stop(); err == nil {
+			err = stopErr
+		}
+
+		s.done <- err
+	}()
+
+	return nil
+}
+
+// StartContinuous recognizes the utterances from microphone one by one, until StopContinuous.
+func (s *WhisperSpeechRecognitionStandalone) StartContinuous() error {
+	s.recognized = make(chan RecognitionResult, 64)
+	s.stop, s.finished = make(chan struct{}), make(chan struct{})
+	s.err = nil
+
+	go func(recognized chan RecognitionResult, stop, finished chan struct{}) {
+		defer close(finished)
+		defer close(recognized)
+
+		started := time.Now()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			offset := time.Since(started)
+			if err := s.startRecording(stop); err != nil {
+				s.err = err
+				return
+			}
+
+			res, err := s.Result()
+			if err != nil {
+				s.err = err
+				return
+			}
+
+			if res.Text != "" {
+				res.Offset, res.Duration = offset, time.Since(started)-offset
+				recognized <- res
+			}
+		}
+	}(s.recognized, s.stop, s.finished)
+
+	return nil
+}
+
+// CloseStream does nothing, the continuous recognition from microphone ends by StopContinuous.
+func (s *WhisperSpeechRecognitionStandalone) CloseStream() error {
+	return nil
+}
+
+// StopContinuous waits the last utterance being recognized, the results not read yet are kept in Recognized.
+func (s *WhisperSpeechRecognitionStandalone) StopContinuous() error {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+		<-s.finished
+	}
+
+	return s.err
+}
+
+func (s *WhisperSpeechRecognitionStandalone) Speaking() bool {
+	return atomic.LoadInt32(&s.speaking) == 1
+}
+
+// record reads the microphone until the speaker stop talking (silence longer than SegmentationSilenceTimeoutMs),
+// or nobody talks in InitialSilenceTimeoutMs.
+func (s *WhisperSpeechRecognitionStandalone) record(frames <-chan []byte, stop <-chan struct{}) error {
+	timeouts := s.timeouts()
+	segmentation, initial := timeouts.SegmentationSilenceTimeoutMs, timeouts.InitialSilenceTimeoutMs
+
+	var pending bytes.Buffer // silent frames before speech is started
+	var speaking bool
+	var silence, total int
+	defer atomic.StoreInt32(&s.speaking, 0)
+	for total < timeouts.MaxSpeechRecognitionDelay*1000 {
+		var frame []byte
+		var ok bool
+		select {
+		case <-stop:
+			return nil
+		case frame, ok = <-frames:
+			if !ok {
+				// the error of capturing is returned by Stop
+				return nil
+			}
+		}
+
+		frameMs := len(frame) * 1000 / DefaultPCMFormat.BytesPerSecond()
+		total += frameMs
+		if s.VAD.IsSpeech(frame) {
+			speaking, silence = true, 0
+			atomic.StoreInt32(&s.speaking, 1)
+		} else {
+			silence += frameMs
+		}
+
+		if !speaking {
+			if total >= initial {
+				return nil
+			}
+
+			// keep a little audio before the speech starts
+			pending.Write(frame)
+			if pending.Len() > 10*len(frame) {
+				pending.Next(len(frame))
+			}
+
+			continue
+		}
+
+		if pending.Len() > 0 {
+			s.SpeechToText(pending.Bytes())
+			pending.Reset()
+		}
+
+		s.SpeechToText(frame)
+		if silence >= segmentation {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *WhisperSpeechRecognitionStandalone) Result() (RecognitionResult, error) {
+	select {
+	case err := <-s.done:
+		if err != nil {
+			return RecognitionResult{}, err
+		}
+	case <-time.After(2 * s.timeouts().recognitionDelay()):
+		return RecognitionResult{}, ErrSpeechRecognitionTimeout
+	}
+
+	return s.WhisperSpeechRecognition.Result()
+}
+
+// pcmLevel returns the RMS level of 16 bits mono PCM.
+func pcmLevel(frame []byte) float64 {
+	n := len(frame) / 2
+	if n == 0 {
+		return 0
+	}
+
+	var sum float64
+	for i := 0; i < n; i++ {
+		v := float64(int16(binary.LittleEndian.Uint16(frame[2*i:])))
+		sum += v * v
+	}
+
+	return math.Sqrt(sum / float64(n))
+}
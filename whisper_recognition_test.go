@@ -0,0 +1,122 @@
+package hal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWhisperSpeechRecognitionStream(t *testing.T) {
+	sr, err := NewWhisperSpeechRecognition(PARAMS.WhisperBinary, PARAMS.WhisperModel, []string{"en-US"})
+	if errors.Is(err, ErrWhisperNotFound) {
+		t.Skip(err)
+	}
+	assert.Nil(t, err)
+
+	err = sr.Start()
+	assert.Nil(t, err)
+
+	sendWav("./test_data/jfk.wav", sr, t)
+
+	r, err := sr.Result()
+	fmt.Println(r)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(strings.ToLower(r.Text), "your country"))
+	assert.Equal(t, "en-US", r.Language)
+
+	assert.Nil(t, sr.Close())
+}
+
+func TestParseWhisperOutput(t *testing.T) {
+	assert.Equal(t, "", parseWhisperOutput("\n [BLANK_AUDIO]\n"))
+	assert.Equal(t, "Hello. How are you?", parseWhisperOutput(" Hello.\n (music)\n How are you?\n"))
+}
+
+func TestParseWhisperLanguage(t *testing.T) {
+	language, p := parseWhisperLanguage("whisper_full_with_state: auto-detected language: fr (p = 0.976807)\n")
+	assert.Equal(t, "fr", language)
+	assert.InDelta(t, 0.976807, p, 1e-6)
+
+	language, _ = parseWhisperLanguage("whisper_init_from_file: loading model\n")
+	assert.Equal(t, "", language)
+
+	sr := &WhisperSpeechRecognition{languages: []string{"en-US", "fr-FR"}}
+	assert.Equal(t, "fr-FR", sr.sourceLanguage("auto-detected language: fr (p = 0.9)"))
+	assert.Equal(t, "de", sr.sourceLanguage("auto-detected language: de (p = 0.9)"))
+}
+
+func TestParseWhisperSegment(t *testing.T) {
+	res, ok := parseWhisperSegment("[00:00:01.000 --> 00:00:03.500]   And so my fellow Americans")
+	assert.True(t, ok)
+	assert.Equal(t, RecognitionResult{Text: "And so my fellow Americans", Offset: time.Second, Duration: 2500 * time.Millisecond, Final: true}, res)
+
+	_, ok = parseWhisperSegment("[00:00:03.500 --> 00:00:05.000]   [BLANK_AUDIO]")
+	assert.False(t, ok)
+
+	_, ok = parseWhisperSegment("whisper_init_from_file: loading model")
+	assert.False(t, ok)
+}
+
+func TestWhisperArgs(t *testing.T) {
+	sr := &WhisperSpeechRecognition{model: "model.bin", languages: []string{"en-US"}}
+	assert.Equal(t, []string{"-m", "model.bin", "-f", "a.wav", "-l", "en", "-np"}, sr.args("a.wav", "-np"))
+
+	assert.Nil(t, SetPhrases(sr, []string{"Kubernetes", "HAL"}))
+	assert.Equal(t, []string{"-m", "model.bin", "-f", "a.wav", "-l", "en", "--prompt", "Kubernetes, HAL", "-nt"}, sr.args("a.wav", "-nt"))
+}
+
+func TestPCMLevel(t *testing.T) {
+	assert.Equal(t, 0.0, pcmLevel([]byte{0, 0, 0, 0}))
+	// samples 1000 and -1000
+	assert.Equal(t, 1000.0, pcmLevel([]byte{0xe8, 0x03, 0x18, 0xfc}))
+}
+
+func sendWav(audioFile string, sr SpeechRecognition, t *testing.T) {
+	f, err := os.Open(audioFile)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	_, pcm, err := ReadWav(f)
+	assert.Nil(t, err)
+
+	data := make([]byte, 1024)
+	n, err := pcm.Read(data)
+	for ; err == nil; n, err = pcm.Read(data) {
+		assert.Nil(t, sr.SpeechToText(data[:n]))
+	}
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestWhisperStopContinuous(t *testing.T) {
+	dir, err := os.MkdirTemp("./test_data", "whisper")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// whisper.cpp still transcribing is killed
+	binary := filepath.Join(dir, "whisper-cli")
+	assert.Nil(t, os.WriteFile(binary, []byte("#!/bin/sh\nexec sleep 10\n"), 0o700))
+	sr := &WhisperSpeechRecognition{binary: binary, languages: []string{"en-US"}}
+	assert.Nil(t, sr.StartContinuous())
+	assert.Nil(t, sr.CloseStream())
+	started := time.Now()
+	assert.Nil(t, sr.StopContinuous())
+	assert.Less(t, time.Since(started), 5*time.Second)
+
+	// the error of whisper.cpp exited by itself
+	assert.Nil(t, os.WriteFile(binary, []byte("#!/bin/sh\necho 'failed to load model' >&2\nexit 1\n"), 0o700))
+	assert.Nil(t, sr.StartContinuous())
+	assert.Nil(t, sr.CloseStream())
+	for range sr.Recognized() {
+	}
+
+	err = sr.StopContinuous()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to load model")
+}